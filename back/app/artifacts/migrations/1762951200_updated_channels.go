@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3009067695")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(10, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text2744374011",
+			"max": 0,
+			"min": 0,
+			"name": "user_agent",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(11, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1957281016",
+			"max": 0,
+			"min": 0,
+			"name": "referrer",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3009067695")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("text2744374011")
+
+		// remove field
+		collection.Fields.RemoveById("text1957281016")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3009067695")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(12, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1806356537",
+			"max": 0,
+			"min": 0,
+			"name": "feed",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(13, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text1602912115",
+			"max": 0,
+			"min": 0,
+			"name": "source",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(14, []byte(`{
+			"hidden": false,
+			"id": "bool2904931377",
+			"name": "is_retired",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "bool"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3009067695")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("text1806356537")
+
+		// remove field
+		collection.Fields.RemoveById("text1602912115")
+
+		// remove field
+		collection.Fields.RemoveById("bool2904931377")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,152 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		jsonData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text1432145930",
+					"max": 0,
+					"min": 0,
+					"name": "job",
+					"pattern": "",
+					"presentable": true,
+					"primaryKey": false,
+					"required": true,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "select2063623452",
+					"maxSelect": 1,
+					"name": "status",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "select",
+					"values": [
+						"running",
+						"success",
+						"failed"
+					]
+				},
+				{
+					"hidden": false,
+					"id": "date1367012871",
+					"max": "",
+					"min": "",
+					"name": "started",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "date"
+				},
+				{
+					"hidden": false,
+					"id": "date2675529103",
+					"max": "",
+					"min": "",
+					"name": "finished",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "date"
+				},
+				{
+					"hidden": false,
+					"id": "json1294165296",
+					"maxSize": 0,
+					"name": "counts",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "json"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text1574812785",
+					"max": 0,
+					"min": 0,
+					"name": "error",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_1947306152",
+			"indexes": [
+				"CREATE INDEX ` + "`" + `idx_job_runs_job_started` + "`" + ` ON ` + "`" + `job_runs` + "`" + ` (\n  ` + "`" + `job` + "`" + `,\n  ` + "`" + `started` + "`" + `\n)"
+			],
+			"listRule": null,
+			"name": "job_runs",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": null
+		}`
+
+		collection := &core.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_1947306152")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
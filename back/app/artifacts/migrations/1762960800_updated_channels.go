@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3009067695")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(16, []byte(`{
+			"hidden": false,
+			"id": "json2406358227",
+			"maxSize": 0,
+			"name": "variants",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "json"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(17, []byte(`{
+			"hidden": false,
+			"id": "number1985283047",
+			"max": null,
+			"min": 0,
+			"name": "throughput",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3009067695")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("json2406358227")
+
+		// remove field
+		collection.Fields.RemoveById("number1985283047")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// channels_fts is the full-text index of the channels search, kept in sync by record hooks.
+		// Words are indexed without diacritics, and 2 and 3 letter prefixes are indexed for prefix queries.
+		queries := []string{
+			`CREATE VIRTUAL TABLE channels_fts USING fts5(
+				id UNINDEXED,
+				title,
+				channel,
+				category,
+				country,
+				language,
+				tokenize = 'unicode61 remove_diacritics 2',
+				prefix = '2 3'
+			)`,
+			`CREATE VIRTUAL TABLE channels_fts_vocab USING fts5vocab('channels_fts', 'row')`,
+			`INSERT INTO channels_fts (id, title, channel, category, country, language)
+			SELECT
+				c.id,
+				c.title,
+				c.channel,
+				trim(coalesce(cat.name_1, '') || ' ' || coalesce(cat.name_2, '') || ' ' || coalesce(cat.name_3, '')),
+				coalesce(co.name, ''),
+				coalesce(l.name, '')
+			FROM channels c
+			LEFT JOIN categories cat ON cat.id = c.category
+			LEFT JOIN countries co ON co.id = c.country
+			LEFT JOIN languages l ON l.id = c.language`,
+		}
+
+		for _, query := range queries {
+			if _, err := app.DB().NewQuery(query).Execute(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		for _, query := range []string{
+			`DROP TABLE IF EXISTS channels_fts_vocab`,
+			`DROP TABLE IF EXISTS channels_fts`,
+		} {
+			if _, err := app.DB().NewQuery(query).Execute(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
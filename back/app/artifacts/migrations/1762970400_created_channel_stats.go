@@ -0,0 +1,138 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		jsonData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "pbc_3009067695",
+					"hidden": false,
+					"id": "relation2734263879",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "channel",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"hidden": false,
+					"id": "date3437146025",
+					"max": "",
+					"min": "",
+					"name": "hour",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "date"
+				},
+				{
+					"hidden": false,
+					"id": "number1716519305",
+					"max": null,
+					"min": 0,
+					"name": "plays",
+					"onlyInt": true,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "number3860294839",
+					"max": null,
+					"min": 0,
+					"name": "watch_seconds",
+					"onlyInt": true,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "number2809573561",
+					"max": null,
+					"min": 0,
+					"name": "peak_viewers",
+					"onlyInt": true,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_1872009285",
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_channel_stats_channel_hour` + "`" + ` ON ` + "`" + `channel_stats` + "`" + ` (\n  ` + "`" + `channel` + "`" + `,\n  ` + "`" + `hour` + "`" + `\n)",
+				"CREATE INDEX ` + "`" + `idx_channel_stats_hour` + "`" + ` ON ` + "`" + `channel_stats` + "`" + ` (` + "`" + `hour` + "`" + `)"
+			],
+			"listRule": null,
+			"name": "channel_stats",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": null
+		}`
+
+		collection := &core.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_1872009285")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
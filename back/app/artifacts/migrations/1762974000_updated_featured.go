@@ -0,0 +1,112 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2086470093")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(2, []byte(`{
+			"hidden": false,
+			"id": "number4271542021",
+			"max": null,
+			"min": 0,
+			"name": "position",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(3, []byte(`{
+			"hidden": false,
+			"id": "date1330585311",
+			"max": "",
+			"min": "",
+			"name": "starts_at",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(4, []byte(`{
+			"hidden": false,
+			"id": "date2360484126",
+			"max": "",
+			"min": "",
+			"name": "ends_at",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(5, []byte(`{
+			"cascadeDelete": false,
+			"collectionId": "pbc_961350965",
+			"hidden": false,
+			"id": "relation1952698285",
+			"maxSelect": 999,
+			"minSelect": 0,
+			"name": "countries",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "relation"
+		}`)); err != nil {
+			return err
+		}
+
+		collection.AddIndex("idx_featured_position", false, "`position`", "")
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// Keep the current order, most recently featured first
+		_, err = app.DB().NewQuery(`UPDATE featured SET position = (
+			SELECT COUNT(*) FROM featured f WHERE f.created > featured.created OR (f.created = featured.created AND f.id < featured.id)
+		)`).Execute()
+
+		return err
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2086470093")
+		if err != nil {
+			return err
+		}
+
+		collection.RemoveIndex("idx_featured_position")
+
+		// remove field
+		collection.Fields.RemoveById("number4271542021")
+
+		// remove field
+		collection.Fields.RemoveById("date1330585311")
+
+		// remove field
+		collection.Fields.RemoveById("date2360484126")
+
+		// remove field
+		collection.Fields.RemoveById("relation1952698285")
+
+		return app.Save(collection)
+	})
+}
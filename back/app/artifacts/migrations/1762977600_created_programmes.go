@@ -0,0 +1,184 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		jsonData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text2734263879",
+					"max": 0,
+					"min": 0,
+					"name": "channel",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": true,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "date2675529103",
+					"max": "",
+					"min": "",
+					"name": "start",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "date"
+				},
+				{
+					"hidden": false,
+					"id": "date3109426870",
+					"max": "",
+					"min": "",
+					"name": "stop",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "date"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text724990059",
+					"max": 0,
+					"min": 0,
+					"name": "title",
+					"pattern": "",
+					"presentable": true,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text3346144466",
+					"max": 0,
+					"min": 0,
+					"name": "sub_title",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text1843675174",
+					"max": 0,
+					"min": 0,
+					"name": "description",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text105650625",
+					"max": 0,
+					"min": 0,
+					"name": "category",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text1704208859",
+					"max": 0,
+					"min": 0,
+					"name": "icon",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_909245503",
+			"indexes": [
+				"CREATE UNIQUE INDEX ` + "`" + `idx_programmes_channel_start` + "`" + ` ON ` + "`" + `programmes` + "`" + ` (\n  ` + "`" + `channel` + "`" + `,\n  ` + "`" + `start` + "`" + `\n)",
+				"CREATE INDEX ` + "`" + `idx_programmes_stop` + "`" + ` ON ` + "`" + `programmes` + "`" + ` (` + "`" + `stop` + "`" + `)"
+			],
+			"listRule": null,
+			"name": "programmes",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": null
+		}`
+
+		collection := &core.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_909245503")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
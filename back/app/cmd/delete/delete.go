@@ -4,71 +4,130 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
 	"github.com/spf13/cobra"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
 )
 
 func DeleteCommand(app *pocketbase.PocketBase) *cobra.Command {
 	return &cobra.Command{
 		Use:   "delete",
-		Short: "Delete all broken channels (is_working = false)",
+		Short: "Retire broken channels that failed several consecutive health checks",
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := runDelete(app); err != nil {
+			if _, err := runDelete(app); err != nil {
 				log.Fatal(err)
 			}
 		},
 	}
 }
 
-func runDelete(app *pocketbase.PocketBase) error {
-	fmt.Println("🗑️  Starting deletion of broken channels...")
+// Run retires the broken channels, as the scheduled cleanup does
+func Run(app *pocketbase.PocketBase) (map[string]int, error) {
+	return runDelete(app)
+}
+
+func runDelete(app *pocketbase.PocketBase) (map[string]int, error) {
+	cfg := config.GetConfig()
+	failures := cfg.RetireAfterFailures
+	if failures < 1 {
+		failures = 1
+	}
+
+	fmt.Printf("🗑️  Retiring channels that failed %d consecutive checks in the last %s...\n", failures, cfg.HealthWindow)
 
 	// Get channels collection
 	channelsCollection, err := app.FindCollectionByNameOrId("channels")
 	if err != nil {
-		return fmt.Errorf("failed to find channels collection: %w", err)
+		return nil, fmt.Errorf("failed to find channels collection: %w", err)
 	}
 
-	// Fetch all broken channels (is_working = false)
+	// Fetch all broken channels that are still active
 	records, err := app.FindRecordsByFilter(
 		channelsCollection.Name,
-		"is_working = false",
+		"is_working = false && is_retired = false",
 		"",
 		0,
 		0,
 		nil,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to fetch broken channels: %w", err)
+		return nil, fmt.Errorf("failed to fetch broken channels: %w", err)
 	}
 
 	totalBroken := len(records)
-	fmt.Printf("📊 Found %d broken channels to delete\n\n", totalBroken)
+	fmt.Printf("📊 Found %d broken channels to review\n\n", totalBroken)
 
 	if totalBroken == 0 {
-		fmt.Println("✨ No broken channels to delete!")
-		return nil
+		fmt.Println("✨ No broken channels to retire!")
+		return map[string]int{"retired": 0, "kept": 0, "failed": 0}, nil
 	}
 
-	// Delete each broken channel
-	deleted := 0
+	since := types.NowDateTime().Add(-cfg.HealthWindow).String()
+
+	retired := 0
+	kept := 0
 	failed := 0
 
 	for _, record := range records {
 		title := record.GetString("title")
 		url := record.GetString("url")
 
-		if err := app.Delete(record); err != nil {
-			fmt.Printf("❌ Failed to delete: %s (%s) - %v\n", title, url, err)
+		consecutive, err := failedConsecutively(app, record, since, failures)
+		if err != nil {
+			fmt.Printf("❌ Failed to read checks of: %s (%s) - %v\n", title, url, err)
+			failed++
+			continue
+		}
+		if !consecutive {
+			kept++
+			continue
+		}
+
+		record.Set("is_retired", true)
+		record.Set("retired_reason", model.RetiredHealth)
+		if err := app.Save(record); err != nil {
+			fmt.Printf("❌ Failed to retire: %s (%s) - %v\n", title, url, err)
 			failed++
 		} else {
-			fmt.Printf("🗑️  Deleted: %s (%s)\n", title, url)
-			deleted++
+			fmt.Printf("🗑️  Retired: %s (%s)\n", title, url)
+			retired++
 		}
 	}
 
-	fmt.Printf("\n✨ Deletion complete!\n")
-	fmt.Printf("📊 Results: 🗑️  %d deleted | ❌ %d failed\n", deleted, failed)
+	fmt.Printf("\n✨ Retirement complete!\n")
+	fmt.Printf("📊 Results: 🗑️  %d retired | ⏳ %d kept | ❌ %d failed\n", retired, kept, failed)
+
+	return map[string]int{"retired": retired, "kept": kept, "failed": failed}, nil
+}
+
+// failedConsecutively reports whether the latest checks of the channel since the
+// given date are all failures and there are at least the required number of them
+func failedConsecutively(app *pocketbase.PocketBase, channel *core.Record, since string, failures int) (bool, error) {
+	checks, err := app.FindRecordsByFilter(
+		model.ChannelChecksCollection,
+		"channel = {:channel} && created >= {:since}",
+		"-created",
+		failures,
+		0,
+		dbx.Params{"channel": channel.Id, "since": since},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	if len(checks) < failures {
+		return false, nil
+	}
+
+	for _, check := range checks {
+		if check.GetBool("works") {
+			return false, nil
+		}
+	}
 
-	return nil
+	return true, nil
 }
@@ -0,0 +1,330 @@
+package epg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cobra"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/pkg/xmltv"
+)
+
+const (
+	// fetchTimeout bounds the download of a remote guide
+	fetchTimeout = 5 * time.Minute
+
+	// maxTextLength is the default limit of PocketBase text fields, longer texts are cut
+	maxTextLength = 5000
+)
+
+// programmeImport is a parsed programme of a channel of the catalog
+type programmeImport struct {
+	start       time.Time
+	stop        time.Time
+	title       string
+	subTitle    string
+	description string
+	category    string
+	icon        string
+}
+
+func EPGCommand(app *pocketbase.PocketBase) *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "epg",
+		Short: "Import an XMLTV programme guide for the channels of the catalog",
+		Run: func(cmd *cobra.Command, args []string) {
+			if file == "" {
+				file = config.GetConfig().EPGURL
+			}
+			if _, err := runEPG(app, file); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&file, "file", "", "XMLTV guide to import, a path, an http(s) URL or \"-\" for stdin, may be gzipped (defaults to EPG_URL)")
+
+	return cmd
+}
+
+// Run imports the guide of EPG_URL, as the scheduled import does
+func Run(app *pocketbase.PocketBase) (map[string]int, error) {
+	return runEPG(app, config.GetConfig().EPGURL)
+}
+
+func runEPG(app core.App, source string) (map[string]int, error) {
+	if source == "" {
+		return nil, errors.New("no guide to import, pass --file or set EPG_URL")
+	}
+
+	retention := config.GetConfig().EPGRetention
+	prunedBefore := time.Now().Add(-retention)
+
+	fmt.Printf("📺 Importing programme guide from %s...\n", source)
+
+	channels, err := channelIdentifiers(app)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := openGuide(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open guide: %w", err)
+	}
+	defer input.Close()
+
+	reader, err := xmltv.NewReader(input)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{"imported": 0, "channels": 0, "unmatched": 0, "invalid": 0, "failed": 0, "pruned": 0}
+	programmes := make(map[string][]*programmeImport)
+	for {
+		p, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read guide: %w", err)
+		}
+
+		channel, ok := channels[strings.ToLower(strings.TrimSpace(p.Channel))]
+		if !ok {
+			counts["unmatched"]++
+			continue
+		}
+
+		item, err := parseProgramme(p)
+		if err != nil {
+			counts["invalid"]++
+			continue
+		}
+		programmes[channel] = append(programmes[channel], item)
+	}
+
+	fmt.Printf("📊 Found programmes for %d channels of the catalog\n", len(programmes))
+
+	collection, err := app.FindCollectionByNameOrId(model.ProgrammesCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find programmes collection: %w", err)
+	}
+
+	// Each channel is replaced in a transaction of its own, so that the guide is served
+	// while it is imported and a channel failing to import leaves the others imported
+	names := make([]string, 0, len(programmes))
+	for channel := range programmes {
+		names = append(names, channel)
+	}
+	sort.Strings(names)
+
+	for _, channel := range names {
+		items := schedule(programmes[channel], prunedBefore)
+		if len(items) == 0 {
+			continue
+		}
+
+		var saved int
+		err := app.RunInTransaction(func(txApp core.App) error {
+			var err error
+			saved, err = replaceProgrammes(txApp, collection, channel, items)
+			return err
+		})
+		if err != nil {
+			fmt.Printf("❌ Failed to import programmes of %s - %v\n", channel, err)
+			counts["failed"] += len(items)
+			continue
+		}
+		counts["imported"] += saved
+		counts["failed"] += len(items) - saved
+		counts["channels"]++
+	}
+
+	result, err := app.DB().Delete(model.ProgrammesCollection, dbx.NewExp("[[stop]] < {:before}", dbx.Params{
+		"before": prunedBefore.UTC().Format(types.DefaultDateLayout),
+	})).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune programmes: %w", err)
+	}
+	pruned, _ := result.RowsAffected()
+	counts["pruned"] = int(pruned)
+
+	fmt.Printf("\n✨ Guide import complete!\n")
+	fmt.Printf("📊 Results: ✅ %d programmes of %d channels | ❓ %d unmatched | ❌ %d invalid | ❌ %d failed | 🗑️  %d pruned\n",
+		counts["imported"], counts["channels"], counts["unmatched"], counts["invalid"], counts["failed"], counts["pruned"])
+
+	return counts, nil
+}
+
+// channelIdentifiers maps the lowercased channel identifiers of the active channels
+// to the identifiers as stored, which XMLTV channel ids are matched against
+func channelIdentifiers(app core.App) (map[string]string, error) {
+	var identifiers []string
+	err := app.DB().Select("channel").Distinct(true).From("channels").
+		Where(dbx.And(dbx.NewExp("[[channel]] != ''"), dbx.HashExp{"is_retired": false})).
+		Column(&identifiers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load channel identifiers: %w", err)
+	}
+
+	channels := make(map[string]string, len(identifiers))
+	for _, identifier := range identifiers {
+		channels[strings.ToLower(identifier)] = identifier
+	}
+
+	return channels, nil
+}
+
+// openGuide opens a guide from a path, an http(s) URL or stdin
+func openGuide(source string) (io.ReadCloser, error) {
+	if source == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.Open(source)
+	}
+
+	client := &http.Client{Timeout: fetchTimeout}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.Body, nil
+}
+
+func parseProgramme(p *xmltv.Programme) (*programmeImport, error) {
+	start, err := xmltv.ParseTime(p.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &programmeImport{
+		start:       start,
+		title:       truncate(p.Title()),
+		subTitle:    truncate(p.SubTitle()),
+		description: truncate(p.Desc()),
+		category:    truncate(p.Category()),
+	}
+	if item.title == "" {
+		return nil, errors.New("programme without title")
+	}
+
+	if p.Stop != "" {
+		if item.stop, err = xmltv.ParseTime(p.Stop); err != nil {
+			return nil, err
+		}
+		if !item.stop.After(item.start) {
+			return nil, errors.New("programme stops before it starts")
+		}
+	}
+
+	if p.Icon != nil {
+		item.icon = truncate(p.Icon.Src)
+	}
+
+	return item, nil
+}
+
+func truncate(text string) string {
+	if runes := []rune(text); len(runes) > maxTextLength {
+		return string(runes[:maxTextLength])
+	}
+	return text
+}
+
+// schedule sorts the programmes of a channel, keeping the first of those starting at
+// the same time. Programmes without a stop end when the next one starts, the last of them
+// is dropped. Programmes ended before the retention are dropped too.
+func schedule(items []*programmeImport, prunedBefore time.Time) []*programmeImport {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].start.Before(items[j].start) })
+
+	kept := make([]*programmeImport, 0, len(items))
+	for i, item := range items {
+		if i > 0 && item.start.Equal(items[i-1].start) {
+			continue
+		}
+
+		if item.stop.IsZero() {
+			for _, next := range items[i+1:] {
+				if next.start.After(item.start) {
+					item.stop = next.start
+					break
+				}
+			}
+			if item.stop.IsZero() {
+				continue
+			}
+		}
+
+		if item.stop.Before(prunedBefore) {
+			continue
+		}
+		kept = append(kept, item)
+	}
+
+	return kept
+}
+
+// replaceProgrammes replaces the programmes a channel had in the period of the imported ones
+// and returns how many were saved. Programmes failing to save are logged and skipped.
+func replaceProgrammes(txApp core.App, collection *core.Collection, channel string, items []*programmeImport) (int, error) {
+	from := items[0].start
+	to := items[len(items)-1].stop
+	for _, item := range items {
+		if item.stop.After(to) {
+			to = item.stop
+		}
+	}
+
+	_, err := txApp.DB().Delete(model.ProgrammesCollection, dbx.And(
+		dbx.HashExp{"channel": channel},
+		dbx.NewExp("[[start]] >= {:from} AND [[start]] < {:to}", dbx.Params{
+			"from": from.UTC().Format(types.DefaultDateLayout),
+			"to":   to.UTC().Format(types.DefaultDateLayout),
+		}),
+	)).Execute()
+	if err != nil {
+		return 0, err
+	}
+
+	saved := 0
+	for _, item := range items {
+		record := core.NewRecord(collection)
+		record.Set("channel", channel)
+		record.Set("start", item.start)
+		record.Set("stop", item.stop)
+		record.Set("title", item.title)
+		record.Set("sub_title", item.subTitle)
+		record.Set("description", item.description)
+		record.Set("category", item.category)
+		record.Set("icon", item.icon)
+
+		if err := txApp.Save(record); err != nil {
+			fmt.Printf("❌ Failed to save programme: %s %s (%s) - %v\n", channel, item.start.Format(time.RFC3339), item.title, err)
+			continue
+		}
+		saved++
+	}
+
+	return saved, nil
+}
@@ -0,0 +1,134 @@
+package epg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/testutil"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/pkg/xmltv"
+)
+
+// newGuideApp creates an app with the channels France24.fr, BBCNews.uk and the retired
+// Old.fr, and a programme of France24.fr that ended two days ago
+func newGuideApp(t *testing.T) *tests.TestApp {
+	t.Helper()
+
+	channels := core.NewBaseCollection("channels")
+	channels.Fields.Add(&core.TextField{Name: "channel"}, &core.BoolField{Name: "is_retired"})
+	programmes := core.NewBaseCollection(model.ProgrammesCollection)
+	programmes.Fields.Add(
+		&core.TextField{Name: "channel"},
+		&core.DateField{Name: "start"},
+		&core.DateField{Name: "stop"},
+		&core.TextField{Name: "title"},
+		&core.TextField{Name: "sub_title"},
+		&core.TextField{Name: "description"},
+		&core.TextField{Name: "category"},
+		&core.TextField{Name: "icon"},
+	)
+	app := testutil.NewApp(t, channels, programmes)
+
+	for identifier, retired := range map[string]bool{"France24.fr": false, "BBCNews.uk": false, "Old.fr": true} {
+		testutil.SaveRecord(t, app, channels, map[string]any{"channel": identifier, "is_retired": retired})
+	}
+
+	testutil.SaveRecord(t, app, programmes, map[string]any{
+		"channel": "France24.fr",
+		"start":   time.Now().Add(-49 * time.Hour),
+		"stop":    time.Now().Add(-48 * time.Hour),
+		"title":   "Ended",
+	})
+
+	return app
+}
+
+// testGuide lists programmes of the catalog under identifiers of any case, a programme
+// of a channel out of the catalog, of a retired one and a programme without title
+func testGuide() []byte {
+	now := time.Now().Truncate(time.Hour)
+	at := func(hours int) string { return xmltv.FormatTime(now.Add(time.Duration(hours) * time.Hour)) }
+
+	var guide strings.Builder
+	guide.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n<tv>\n")
+	programme := func(channel, start, stop, title string) {
+		fmt.Fprintf(&guide, "<programme start=%q stop=%q channel=%q><title>%s</title></programme>\n", start, stop, channel, title)
+	}
+	programme("France24.fr", at(0), at(1), "Le Journal")
+	programme("France24.fr", at(1), at(2), "Le Débat")
+	programme("bbcnews.uk", at(0), at(1), "BBC News at One")
+	programme("Unknown.fr", at(0), at(1), "Unknown")
+	programme("Old.fr", at(0), at(1), "Retired")
+	programme("France24.fr", at(2), at(3), "")
+	guide.WriteString("</tv>\n")
+
+	return []byte(guide.String())
+}
+
+func TestRunEPG(t *testing.T) {
+	guide := testGuide()
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	if _, err := gz.Write(guide); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/guide.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(guide)
+	})
+	mux.HandleFunc("/guide.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(gzipped.Bytes())
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, path := range []string{"/guide.xml", "/guide.xml.gz"} {
+		app := newGuideApp(t)
+
+		counts, err := runEPG(app, server.URL+path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		want := map[string]int{"imported": 3, "channels": 2, "unmatched": 2, "invalid": 1, "failed": 0, "pruned": 1}
+		for key, value := range want {
+			if counts[key] != value {
+				t.Errorf("%s: counts = %v, want %v", path, counts, want)
+				break
+			}
+		}
+
+		// Importing again replaces the programmes instead of duplicating them
+		if _, err := runEPG(app, server.URL+path); err != nil {
+			t.Fatalf("%s: second import: %v", path, err)
+		}
+		records, err := app.FindRecordsByFilter(model.ProgrammesCollection, "", "start,channel", 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, record := range records {
+			titles = append(titles, record.GetString("channel")+" "+record.GetString("title"))
+		}
+		if got, want := strings.Join(titles, ", "), "BBCNews.uk BBC News at One, France24.fr Le Journal, France24.fr Le Débat"; got != want {
+			t.Errorf("%s: programmes = %s, want %s", path, got, want)
+		}
+	}
+
+	if _, err := runEPG(newGuideApp(t), server.URL+"/missing.xml"); err == nil {
+		t.Error("importing a missing guide didn't fail")
+	}
+}
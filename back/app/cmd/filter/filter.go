@@ -2,6 +2,7 @@ package filter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,113 +12,351 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/search"
 	"github.com/spf13/cobra"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/pkg/hls"
 )
 
 type ChannelURL struct {
-	ID  string
-	URL string
+	ID        string
+	URL       string
+	UserAgent string
+	Referrer  string
 }
 
 type Result struct {
-	ChannelID string
-	URL       string
-	Works     bool
-	Reason    string
+	ChannelID  string
+	URL        string
+	Works      bool
+	Reason     string
+	StatusCode int
+	Latency    time.Duration
+	// Throughput is the best segment download speed in kbit/s
+	Throughput int64
+	// Quality is measured from the highest working variant, e.g. "1080p"
+	Quality  string
+	Variants []VariantCheck
+	Host     string
+	// Throttled is set when the host still throttled the check after being paused
+	Throttled bool
+
+	// throttledBy is the response that throttled the check, of the stream or of one of its resources
+	throttledBy *statusError
+}
+
+// VariantCheck is the outcome of validating one variant of a master playlist
+type VariantCheck struct {
+	Resolution string `json:"resolution,omitempty"`
+	Bandwidth  int    `json:"bandwidth,omitempty"`
+	Codecs     string `json:"codecs,omitempty"`
+	Works      bool   `json:"works"`
+	Reason     string `json:"reason"`
+	Throughput int64  `json:"throughput,omitempty"`
+
+	throttledBy *statusError
+}
+
+const (
+	// maxVariants bounds the variants followed per master playlist
+	maxVariants      = 8
+	maxPlaylistSize  = 1024 * 1024
+	maxKeySize       = 1024
+	maxSegmentSample = 2 * 1024 * 1024
+)
+
+// Options select the channels a filter run checks and what happens to the results
+type Options struct {
+	Workers int
+	Timeout time.Duration
+	// PerHost caps the concurrent checks of channels served from the same host
+	PerHost   int
+	HostDelay time.Duration
+	// Filter is a PocketBase filter expression on the channels collection
+	Filter      string
+	Category    string
+	Country     string
+	OnlyBroken  bool
+	OnlyWorking bool
+	// DryRun checks the channels and reports without saving anything
+	DryRun bool
+	// Report is the file the results are written to, "-" for stdout
+	Report       string
+	ReportFormat string
+}
+
+func defaultOptions() Options {
+	return Options{
+		Workers:   10,
+		Timeout:   8 * time.Second,
+		PerHost:   2,
+		HostDelay: 250 * time.Millisecond,
+	}
 }
 
 func FilterCommand(app *pocketbase.PocketBase) *cobra.Command {
-	return &cobra.Command{
+	opts := defaultOptions()
+
+	cmd := &cobra.Command{
 		Use:   "filter",
 		Short: "Validate stream URLs and update channel status",
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := runFilter(app); err != nil {
+			if _, err := runFilter(app, opts); err != nil {
 				log.Fatal(err)
 			}
 		},
 	}
+
+	cmd.Flags().IntVar(&opts.Workers, "workers", opts.Workers, "number of channels checked concurrently")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", opts.Timeout, "timeout of every request of a check")
+	cmd.Flags().IntVar(&opts.PerHost, "per-host", opts.PerHost, "number of channels of the same host checked concurrently")
+	cmd.Flags().DurationVar(&opts.HostDelay, "host-delay", opts.HostDelay, "minimum delay between two checks of the same host")
+	cmd.Flags().StringVar(&opts.Filter, "filter", "", "PocketBase filter expression limiting the checked channels, e.g. \"source = 'streams.json'\"")
+	cmd.Flags().StringVar(&opts.Category, "category", "", "only check channels of this category")
+	cmd.Flags().StringVar(&opts.Country, "country", "", "only check channels of this country")
+	cmd.Flags().BoolVar(&opts.OnlyBroken, "only-broken", false, "only recheck channels currently marked as broken")
+	cmd.Flags().BoolVar(&opts.OnlyWorking, "only-working", false, "only recheck channels currently marked as working")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "check and report without saving the results")
+	cmd.Flags().StringVar(&opts.Report, "report", "", "write a report of the results to this file, \"-\" for stdout")
+	cmd.Flags().StringVar(&opts.ReportFormat, "report-format", "", "report format: json or csv (defaults to the report file extension, else json)")
+
+	return cmd
+}
+
+// Run validates every channel stream and stores the results, as the scheduled health check does
+func Run(app *pocketbase.PocketBase) (map[string]int, error) {
+	return runFilter(app, defaultOptions())
+}
+
+// channelsFilter builds the conditions selecting the channels of a run besides the
+// --filter expression, nil when there are none. Values are bound as SQL parameters.
+func channelsFilter(opts Options) (dbx.Expression, error) {
+	if opts.OnlyBroken && opts.OnlyWorking {
+		return nil, fmt.Errorf("--only-broken and --only-working can't be combined")
+	}
+
+	var exps []dbx.Expression
+
+	if opts.Category != "" {
+		exps = append(exps, dbx.NewExp(
+			"[[channels.category]] IN (SELECT [[id]] FROM {{categories}} WHERE [[name_1]] = {:category})",
+			dbx.Params{"category": strings.ToLower(opts.Category)},
+		))
+	}
+	if opts.Country != "" {
+		exps = append(exps, dbx.NewExp(
+			"[[channels.country]] IN (SELECT [[id]] FROM {{countries}} WHERE [[name]] = {:country})",
+			dbx.Params{"country": opts.Country},
+		))
+	}
+	if opts.OnlyBroken {
+		exps = append(exps, dbx.HashExp{"channels.is_working": false})
+	}
+	if opts.OnlyWorking {
+		exps = append(exps, dbx.HashExp{"channels.is_working": true})
+	}
+
+	if len(exps) == 0 {
+		return nil, nil
+	}
+	return dbx.And(exps...), nil
+}
+
+// findChannels returns the channels of a run. The --filter expression is written by the
+// operator in the PocketBase filter syntax, the other options are bound as parameters.
+func findChannels(app core.App, collection *core.Collection, where dbx.Expression, opts Options) ([]*core.Record, error) {
+	query := app.RecordQuery(collection)
+	if where != nil {
+		query.AndWhere(where)
+	}
+	if opts.Filter != "" {
+		resolver := core.NewRecordFieldResolver(app, collection, nil, true)
+		expr, err := search.FilterData(opts.Filter).BuildExpr(resolver)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --filter expression: %w", err)
+		}
+		query.AndWhere(expr)
+		resolver.UpdateQuery(query)
+	}
+
+	var records []*core.Record
+	if err := query.All(&records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
 }
 
-func runFilter(app *pocketbase.PocketBase) error {
+func runFilter(app *pocketbase.PocketBase, opts Options) (map[string]int, error) {
+	if opts.Workers < 1 {
+		return nil, fmt.Errorf("--workers must be at least 1")
+	}
+
+	where, err := channelsFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	fmt.Println("📡 Connecting to PocketBase")
 
 	// Get channels collection
 	channelsCollection, err := app.FindCollectionByNameOrId("channels")
 	if err != nil {
-		return fmt.Errorf("failed to find channels collection: %w", err)
+		return nil, fmt.Errorf("failed to find channels collection: %w", err)
 	}
 
-	// Fetch all channels
-	records, err := app.FindAllRecords(channelsCollection.Name)
+	// Fetch the channels of this run
+	if opts.Filter != "" {
+		fmt.Printf("🔎 Filter: %s\n", opts.Filter)
+	}
+	records, err := findChannels(app, channelsCollection, where, opts)
 	if err != nil {
-		return fmt.Errorf("failed to fetch channels: %w", err)
+		return nil, fmt.Errorf("failed to fetch channels: %w", err)
 	}
 
 	channels := make([]ChannelURL, 0)
+	recordsByID := make(map[string]*core.Record, len(records))
 	for _, record := range records {
 		url := record.GetString("url")
 		if url != "" {
 			channels = append(channels, ChannelURL{
-				ID:  record.Id,
-				URL: url,
+				ID:        record.Id,
+				URL:       url,
+				UserAgent: record.GetString("user_agent"),
+				Referrer:  record.GetString("referrer"),
 			})
+			recordsByID[record.Id] = record
 		}
 	}
 
 	fmt.Printf("🚀 Starting validation of %d channels\n", len(channels))
+	fmt.Printf("⚙️  Workers: %d, Timeout: %v, Per host: %d, Host delay: %v\n", opts.Workers, opts.Timeout, opts.PerHost, opts.HostDelay)
+	if opts.DryRun {
+		fmt.Println("🧪 Dry run, results are not saved")
+	}
+	fmt.Println()
 
-	workers := 10
-	timeoutSec := 8 * time.Second
+	history, err := newHistory(app, config.GetConfig().HealthWindow)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Printf("⚙️  Workers: %d, Timeout: %v\n\n", workers, timeoutSec)
+	qualities, err := newQualities(app)
+	if err != nil {
+		return nil, err
+	}
 
 	startTime := time.Now()
 
-	results := processURLsConcurrently(channels, workers, timeoutSec)
+	results := processURLsConcurrently(channels, opts)
 
 	working := 0
 	broken := 0
+	throttled := 0
+	var checked []Result
+	var entries []ReportEntry
 
 	// Update database with results
 	for result := range results {
-		// Find the record
-		record, err := app.FindRecordById(channelsCollection.Name, result.ChannelID)
-		if err != nil {
-			fmt.Printf("⚠️  Failed to find channel %s: %v\n", result.ChannelID, err)
+		record := recordsByID[result.ChannelID]
+
+		switch {
+		case result.Works:
+			fmt.Printf("✅ %s — %s\n", result.URL, result.Reason)
+			working++
+		case result.Throttled:
+			fmt.Printf("🚧 %s — %s\n", result.URL, result.Reason)
+			throttled++
+		default:
+			fmt.Printf("❌ %s — %s\n", result.URL, result.Reason)
+			broken++
+		}
+		checked = append(checked, result)
+
+		if opts.Report != "" {
+			entries = append(entries, newReportEntry(record, result))
+		}
+
+		if opts.DryRun {
 			continue
 		}
 
-		// Update is_working field
-		record.Set("is_working", result.Works)
+		// Keep the probe in the channel history and derive the uptime from it.
+		// A throttled probe says nothing about the stream and isn't kept.
+		if !result.Throttled {
+			if err := history.record(result); err != nil {
+				fmt.Printf("⚠️  Failed to record check of channel %s: %v\n", result.ChannelID, err)
+			}
+		}
+
+		uptime, err := history.uptime(result.ChannelID)
+		if err != nil {
+			fmt.Printf("⚠️  Failed to compute uptime of channel %s: %v\n", result.ChannelID, err)
+		} else {
+			record.Set("uptime", uptime)
+		}
+
+		// A host that keeps throttling says nothing about the stream, its status is left as is
+		if !result.Throttled {
+			record.Set("is_working", result.Works)
+		}
+
+		// Keep what the stream was measured to deliver
+		if result.Works {
+			record.Set("variants", result.Variants)
+			record.Set("throughput", result.Throughput)
+			if result.Quality != "" {
+				qualityID, err := qualities.id(result.Quality)
+				if err != nil {
+					fmt.Printf("⚠️  Failed to store quality of channel %s: %v\n", result.ChannelID, err)
+				} else {
+					record.Set("quality", qualityID)
+				}
+			}
+		}
 
 		if err := app.Save(record); err != nil {
 			fmt.Printf("⚠️  Failed to update channel %s: %v\n", result.ChannelID, err)
-			continue
 		}
+	}
 
-		if result.Works {
-			fmt.Printf("✅ %s — %s\n", result.URL, result.Reason)
-			working++
-		} else {
-			fmt.Printf("❌ %s — %s\n", result.URL, result.Reason)
-			broken++
+	// Checks older than the health window are never read again
+	pruned := 0
+	if !opts.DryRun {
+		if pruned, err = history.prune(); err != nil {
+			fmt.Printf("⚠️  Failed to prune channel checks: %v\n", err)
 		}
 	}
 
 	elapsed := time.Since(startTime)
 	fmt.Printf("\n✨ Done in %s!\n", elapsed.Round(time.Second))
-	fmt.Printf("📊 Results: ✅ %d working | ❌ %d broken\n", working, broken)
+	fmt.Printf("📊 Results: ✅ %d working | ❌ %d broken | 🚧 %d throttled | 🗑️  %d checks pruned\n", working, broken, throttled, pruned)
 
-	return nil
+	hosts := summarizeHosts(checked)
+	printHostSummary(hosts)
+
+	if opts.Report != "" {
+		if err := writeReport(opts.Report, opts.ReportFormat, entries, hosts); err != nil {
+			return nil, fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+
+	return map[string]int{"working": working, "broken": broken, "throttled": throttled, "pruned": pruned}, nil
 }
 
-func processURLsConcurrently(channelURLs []ChannelURL, workers int, timeout time.Duration) <-chan Result {
+// processURLsConcurrently checks the channels with a pool of workers. Channels are
+// interleaved by host and every host is rate limited and paused when it throttles.
+func processURLsConcurrently(channelURLs []ChannelURL, opts Options) <-chan Result {
 	results := make(chan Result, len(channelURLs))
 	urlChan := make(chan ChannelURL, len(channelURLs))
+	limiter := newHostLimiter(opts.PerHost, opts.HostDelay)
+	timeout := opts.Timeout
 	var wg sync.WaitGroup
 
-	for i := 0; i < workers; i++ {
+	for i := 0; i < opts.Workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -132,19 +371,48 @@ func processURLsConcurrently(channelURLs []ChannelURL, workers int, timeout time
 			}
 
 			for ch := range urlChan {
-				works, reason := checkURL(ch.URL, client, timeout)
-				results <- Result{
-					ChannelID: ch.ID,
-					URL:       ch.URL,
-					Works:     works,
-					Reason:    reason,
+				host := hostOf(ch.URL)
+
+				var result Result
+				for attempt := 0; ; attempt++ {
+					state := limiter.acquire(host)
+					started := time.Now()
+					result = checkURL(ch, client, timeout)
+					result.Latency = time.Since(started)
+
+					// The breaker of the host that throttled is fed, which may serve the
+					// variants or segments of the stream rather than the stream itself
+					throttledHost := ""
+					if result.throttledBy != nil {
+						throttledHost = hostOf(result.throttledBy.URL)
+					}
+					if pause := limiter.release(state, throttledHost == host); pause > 0 {
+						fmt.Printf("🚧 %s is throttling, pausing it for %s\n", host, pause)
+					}
+					if throttledHost != "" && throttledHost != host {
+						if pause := limiter.throttle(throttledHost); pause > 0 {
+							fmt.Printf("🚧 %s is throttling, pausing it for %s\n", throttledHost, pause)
+						}
+					}
+					if throttledHost == "" {
+						break
+					}
+					if attempt >= maxThrottleRetries {
+						result.Throttled = true
+						break
+					}
 				}
+
+				result.ChannelID = ch.ID
+				result.URL = ch.URL
+				result.Host = host
+				results <- result
 			}
 		}()
 	}
 
 	go func() {
-		for _, ch := range channelURLs {
+		for _, ch := range interleaveByHost(channelURLs) {
 			urlChan <- ch
 		}
 		close(urlChan)
@@ -158,55 +426,32 @@ func processURLsConcurrently(channelURLs []ChannelURL, workers int, timeout time
 	return results
 }
 
-func checkURL(urlStr string, client *http.Client, timeout time.Duration) (bool, string) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+// checkURL probes the stream and returns whether it works, the reason and the HTTP status
+// of the response. HLS streams are validated down to a real segment of every variant.
+func checkURL(ch ChannelURL, client *http.Client, timeout time.Duration) Result {
+	resp, cancel, err := fetch(ch, ch.URL, client, timeout)
 	if err != nil {
-		return false, "request error"
-	}
-
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)")
-	req.Header.Set("Accept", "*/*")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, "connection error"
+		return Result{Reason: err.Error()}
 	}
+	defer cancel()
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
-		return false, fmt.Sprintf("status %d", resp.StatusCode)
+		err := &statusError{URL: resp.Request.URL.String(), StatusCode: resp.StatusCode}
+		return Result{Reason: err.Error(), StatusCode: resp.StatusCode, throttledBy: throttling(err)}
 	}
 
 	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
-	isPlaylist := strings.Contains(contentType, "mpegurl") ||
-		strings.Contains(contentType, "application/vnd.apple.mpegurl") ||
-		strings.Contains(urlStr, ".m3u8")
 
-	if isPlaylist {
-		body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if hls.IsPlaylist(contentType, ch.URL) {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize))
 		if err != nil {
-			return false, "read error"
-		}
-
-		content := string(body)
-		if !strings.Contains(content, "#EXTM3U") {
-			return false, "invalid m3u8"
-		}
-
-		segmentURL := extractFirstSegment(content, urlStr)
-		if segmentURL == "" {
-			return false, "no segments"
-		}
-
-		segmentWorks, _ := checkSegment(segmentURL, client, timeout)
-		if !segmentWorks {
-			return false, "segments broken"
+			return Result{Reason: "read error", StatusCode: resp.StatusCode}
 		}
 
-		return true, "ok"
+		result := checkPlaylist(ch, resp.Request.URL, string(body), client, timeout)
+		result.StatusCode = resp.StatusCode
+		return result
 	}
 
 	validTypes := []string{"video/", "audio/"}
@@ -219,68 +464,228 @@ func checkURL(urlStr string, client *http.Client, timeout time.Duration) (bool,
 	}
 
 	if !hasValidType {
-		return false, "invalid type"
+		return Result{Reason: "invalid type", StatusCode: resp.StatusCode}
 	}
 
 	buf := make([]byte, 1024)
 	n, err := io.ReadAtLeast(resp.Body, buf, 10)
 	if (err != nil && err != io.EOF && err != io.ErrUnexpectedEOF) || n < 10 {
-		return false, "no data"
+		return Result{Reason: "no data", StatusCode: resp.StatusCode}
 	}
 
-	return true, "ok"
+	return Result{Works: true, Reason: "ok", StatusCode: resp.StatusCode}
 }
 
-func extractFirstSegment(playlist string, baseURL string) string {
-	lines := strings.Split(playlist, "\n")
+// checkPlaylist validates a master playlist by following each of its variants,
+// or a media playlist by fetching its key, init section and a segment
+func checkPlaylist(ch ChannelURL, base *url.URL, content string, client *http.Client, timeout time.Duration) Result {
+	playlist, err := hls.Parse(content, base)
+	if err != nil {
+		return Result{Reason: "invalid m3u8"}
+	}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+	if !playlist.IsMaster() {
+		check := checkMedia(ch, playlist, client, timeout)
+		return Result{
+			Works:       check.Works,
+			Reason:      check.Reason,
+			Throughput:  check.Throughput,
+			throttledBy: check.throttledBy,
 		}
+	}
 
-		if strings.HasSuffix(line, ".ts") || strings.HasSuffix(line, ".m4s") ||
-			strings.HasSuffix(line, ".mp4") || strings.Contains(line, "segment") ||
-			strings.HasSuffix(line, ".m3u8") {
+	variants := playlist.Variants
+	if len(variants) > maxVariants {
+		variants = variants[:maxVariants]
+	}
 
-			if !strings.HasPrefix(line, "http") {
-				baseURLParsed, err := url.Parse(baseURL)
-				if err != nil {
-					return ""
-				}
-				segmentURL, err := baseURLParsed.Parse(line)
-				if err != nil {
-					return ""
-				}
-				return segmentURL.String()
+	result := Result{Reason: "variants broken"}
+	bestHeight := 0
+	for i, variant := range variants {
+		check := checkVariant(ch, variant, client, timeout)
+		result.Variants = append(result.Variants, check)
+
+		if !check.Works {
+			if i == 0 {
+				result.Reason = check.Reason
+			}
+			if result.throttledBy == nil {
+				result.throttledBy = check.throttledBy
 			}
-			return line
+			continue
+		}
+
+		result.Works = true
+		result.Reason = "ok"
+		if check.Throughput > result.Throughput {
+			result.Throughput = check.Throughput
+		}
+		if height := variant.Height(); height > bestHeight {
+			bestHeight = height
+		}
+	}
+	result.Quality = hls.Quality(bestHeight)
+
+	// Variants throttled along working ones don't make the stream throttled
+	if result.Works {
+		result.throttledBy = nil
+	}
+
+	return result
+}
+
+// checkVariant fetches the media playlist of a variant and validates it
+func checkVariant(ch ChannelURL, variant hls.Variant, client *http.Client, timeout time.Duration) VariantCheck {
+	check := VariantCheck{
+		Resolution: variant.Resolution,
+		Bandwidth:  variant.Bandwidth,
+		Codecs:     variant.Codecs,
+	}
+
+	body, base, err := fetchBody(ch, variant.URI, client, timeout, maxPlaylistSize)
+	if err != nil {
+		check.Reason = "variant " + err.Error()
+		check.throttledBy = throttling(err)
+		return check
+	}
+
+	playlist, err := hls.Parse(string(body), base)
+	if err != nil || playlist.IsMaster() {
+		check.Reason = "invalid variant"
+		return check
+	}
+
+	media := checkMedia(ch, playlist, client, timeout)
+	check.Works = media.Works
+	check.Reason = media.Reason
+	check.Throughput = media.Throughput
+	check.throttledBy = media.throttledBy
+
+	return check
+}
+
+// checkMedia validates a media playlist: the AES-128 key and the fMP4 init section must be
+// reachable, and its first segment must download; the download measures the throughput
+func checkMedia(ch ChannelURL, playlist *hls.Playlist, client *http.Client, timeout time.Duration) VariantCheck {
+	if len(playlist.Segments) == 0 {
+		return VariantCheck{Reason: "no segments"}
+	}
+
+	for _, key := range playlist.Keys {
+		// SAMPLE-AES keys are usually DRM URIs (skd:// and alike) that can't be fetched
+		if key.Method != "AES-128" {
+			continue
+		}
+		if key.URI == "" {
+			return VariantCheck{Reason: "key unreachable"}
+		}
+		if _, _, err := fetchBody(ch, key.URI, client, timeout, maxKeySize); err != nil {
+			return VariantCheck{Reason: "key unreachable", throttledBy: throttling(err)}
+		}
+	}
+
+	if playlist.Map != "" {
+		if _, _, err := fetchBody(ch, playlist.Map, client, timeout, maxSegmentSample); err != nil {
+			return VariantCheck{Reason: "init segment broken", throttledBy: throttling(err)}
 		}
 	}
-	return ""
+
+	started := time.Now()
+	body, _, err := fetchBody(ch, playlist.Segments[0], client, timeout, maxSegmentSample)
+	if err != nil {
+		return VariantCheck{Reason: "segments broken", throttledBy: throttling(err)}
+	}
+	if len(body) == 0 {
+		return VariantCheck{Reason: "empty segment"}
+	}
+
+	return VariantCheck{
+		Works:      true,
+		Reason:     "ok",
+		Throughput: throughput(len(body), time.Since(started)),
+	}
 }
 
-func checkSegment(segmentURL string, client *http.Client, timeout time.Duration) (bool, string) {
+// fetch sends a GET request with the headers of the channel. The returned cancel
+// func releases the request context once the body has been read.
+func fetch(ch ChannelURL, rawURL string, client *http.Client, timeout time.Duration) (*http.Response, context.CancelFunc, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "HEAD", segmentURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
 	if err != nil {
-		return false, "request error"
+		cancel()
+		return nil, nil, fmt.Errorf("request error")
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0")
+	setChannelHeaders(req, ch)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return false, "unreachable"
+		cancel()
+		return nil, nil, fmt.Errorf("connection error")
 	}
+
+	return resp, cancel, nil
+}
+
+// fetchBody downloads up to limit bytes of a resource and returns them with the final URL
+func fetchBody(ch ChannelURL, rawURL string, client *http.Client, timeout time.Duration, limit int64) ([]byte, *url.URL, error) {
+	resp, cancel, err := fetch(ch, rawURL, client, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cancel()
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
-		return false, fmt.Sprintf("status %d", resp.StatusCode)
+		return nil, nil, &statusError{URL: resp.Request.URL.String(), StatusCode: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil && len(body) == 0 {
+		return nil, nil, fmt.Errorf("read error")
 	}
 
-	return true, "ok"
+	return body, resp.Request.URL, nil
+}
+
+// statusError is a resource of a stream answered with an error status
+type statusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d", e.StatusCode)
+}
+
+// throttling returns the status error when it is the way hosts rate limit clients
+func throttling(err error) *statusError {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && isThrottled(statusErr.StatusCode) {
+		return statusErr
+	}
+	return nil
+}
+
+// throughput converts a download to kbit/s
+func throughput(bytes int, elapsed time.Duration) int64 {
+	if elapsed <= 0 {
+		elapsed = time.Millisecond
+	}
+	return int64(float64(bytes*8) / elapsed.Seconds() / 1000)
+}
+
+// setChannelHeaders sends the User-Agent and Referer the channel requires, if any
+func setChannelHeaders(req *http.Request, ch ChannelURL) {
+	userAgent := ch.UserAgent
+	if userAgent == "" {
+		userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64)"
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "*/*")
+
+	if ch.Referrer != "" {
+		req.Header.Set("Referer", ch.Referrer)
+	}
 }
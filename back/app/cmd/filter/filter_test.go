@@ -0,0 +1,169 @@
+package filter
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/testutil"
+)
+
+// maliciousInputs try to close a quoted value and rewrite the rest of the condition.
+// A value ending with a backslash escaped the closing quote of PocketBase filter strings.
+var maliciousInputs = []string{
+	`x\`,
+	`news\`,
+	` || is_working = true || name_1 = '`,
+	`' || 1=1 || '`,
+	`" || 1=1 || "`,
+	`{:country}`,
+}
+
+// newCatalogApp creates an app with the channel_checks collection and a catalog of the
+// working France24.fr and BBCNews.uk of the news category, and the broken Gulli.fr
+func newCatalogApp(t *testing.T) *tests.TestApp {
+	t.Helper()
+
+	checks := core.NewBaseCollection(model.ChannelChecksCollection)
+	checks.Fields.Add(
+		&core.TextField{Name: "channel"},
+		&core.BoolField{Name: "works"},
+		&core.NumberField{Name: "status"},
+		&core.NumberField{Name: "latency"},
+		&core.TextField{Name: "reason"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+	)
+	categories := core.NewBaseCollection("categories")
+	categories.Fields.Add(&core.TextField{Name: "name_1"})
+	countries := core.NewBaseCollection("countries")
+	countries.Fields.Add(&core.TextField{Name: "name"})
+	qualities := core.NewBaseCollection("qualities")
+	qualities.Fields.Add(&core.TextField{Name: "quality"})
+	channels := core.NewBaseCollection("channels")
+	channels.Fields.Add(
+		&core.TextField{Name: "channel"},
+		&core.TextField{Name: "url"},
+		&core.TextField{Name: "source"},
+		&core.RelationField{Name: "category", CollectionId: categories.Id, MaxSelect: 1},
+		&core.RelationField{Name: "country", CollectionId: countries.Id, MaxSelect: 1},
+		&core.BoolField{Name: "is_working"},
+	)
+	app := testutil.NewApp(t, checks, categories, countries, qualities, channels)
+
+	news := testutil.SaveRecord(t, app, categories, map[string]any{"name_1": "news"}).Id
+	kids := testutil.SaveRecord(t, app, categories, map[string]any{"name_1": "kids"}).Id
+	france := testutil.SaveRecord(t, app, countries, map[string]any{"name": "France"}).Id
+	uk := testutil.SaveRecord(t, app, countries, map[string]any{"name": "United Kingdom"}).Id
+	for _, channel := range []map[string]any{
+		{"channel": "France24.fr", "source": "streams.json", "category": news, "country": france, "is_working": true},
+		{"channel": "BBCNews.uk", "source": "m3u", "category": news, "country": uk, "is_working": true},
+		{"channel": "Gulli.fr", "source": "m3u", "category": kids, "country": france, "is_working": false},
+	} {
+		testutil.SaveRecord(t, app, channels, channel)
+	}
+
+	return app
+}
+
+func TestFindChannels(t *testing.T) {
+	app := newCatalogApp(t)
+	collection, err := app.FindCollectionByNameOrId("channels")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	find := func(opts Options) ([]string, error) {
+		where, err := channelsFilter(opts)
+		if err != nil {
+			return nil, err
+		}
+		records, err := findChannels(app, collection, where, opts)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, record := range records {
+			names = append(names, record.GetString("channel"))
+		}
+		slices.Sort(names)
+		return names, nil
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"all", Options{}, []string{"BBCNews.uk", "France24.fr", "Gulli.fr"}},
+		{"category of any case", Options{Category: "News"}, []string{"BBCNews.uk", "France24.fr"}},
+		{"country", Options{Country: "France"}, []string{"France24.fr", "Gulli.fr"}},
+		{"category and country", Options{Category: "news", Country: "France"}, []string{"France24.fr"}},
+		{"only broken", Options{OnlyBroken: true}, []string{"Gulli.fr"}},
+		{"only working", Options{OnlyWorking: true, Country: "France"}, []string{"France24.fr"}},
+		{"filter expression", Options{Filter: "source = 'm3u' && category.name_1 = 'news'"}, []string{"BBCNews.uk"}},
+		{"filter expression and options", Options{Filter: "source = 'm3u'", OnlyWorking: true}, []string{"BBCNews.uk"}},
+	}
+	for _, tt := range tests {
+		got, err := find(tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Malicious values, alone or followed by another one, match nothing instead of rewriting the condition
+	for _, category := range maliciousInputs {
+		for _, country := range append([]string{""}, maliciousInputs...) {
+			got, err := find(Options{Category: category, Country: country})
+			if err != nil {
+				t.Fatalf("category %q, country %q: %v", category, country, err)
+			}
+			if len(got) != 0 {
+				t.Errorf("category %q, country %q: got %v, want none", category, country, got)
+			}
+		}
+	}
+
+	if _, err := find(Options{OnlyBroken: true, OnlyWorking: true}); err == nil {
+		t.Error("combining --only-broken and --only-working didn't fail")
+	}
+}
+
+func TestQualitiesID(t *testing.T) {
+	app := newCatalogApp(t)
+	qualities, err := newQualities(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]string)
+	for _, quality := range append([]string{"720p", "1080p"}, maliciousInputs...) {
+		id, err := qualities.id(quality)
+		if err != nil {
+			t.Fatalf("%q: %v", quality, err)
+		}
+		ids[quality] = id
+	}
+
+	// Each label has its own record, found again from the database once the cache is gone
+	qualities.ids = make(map[string]string)
+	seen := make(map[string]bool)
+	for quality, id := range ids {
+		if seen[id] {
+			t.Errorf("%q shares its record with another quality", quality)
+		}
+		seen[id] = true
+
+		got, err := qualities.id(quality)
+		if err != nil {
+			t.Fatalf("%q: %v", quality, err)
+		}
+		if got != id {
+			t.Errorf("%q resolved to %s, want its record %s", quality, got, id)
+		}
+	}
+}
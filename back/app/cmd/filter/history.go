@@ -0,0 +1,84 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+// history keeps the probe results of the health window in the channel_checks collection
+type history struct {
+	app        core.App
+	collection *core.Collection
+	window     time.Duration
+}
+
+func newHistory(app core.App, window time.Duration) (*history, error) {
+	collection, err := app.FindCollectionByNameOrId(model.ChannelChecksCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find channel_checks collection: %w", err)
+	}
+
+	return &history{
+		app:        app,
+		collection: collection,
+		window:     window,
+	}, nil
+}
+
+// record saves the result of a single probe
+func (h *history) record(result Result) error {
+	check := core.NewRecord(h.collection)
+	check.Set("channel", result.ChannelID)
+	check.Set("works", result.Works)
+	check.Set("status", result.StatusCode)
+	check.Set("latency", result.Latency.Milliseconds())
+	check.Set("reason", result.Reason)
+
+	return h.app.Save(check)
+}
+
+// uptime returns the percentage of working checks of the channel within the window
+func (h *history) uptime(channelID string) (float64, error) {
+	since := dbx.NewExp("created >= {:since}", dbx.Params{
+		"since": types.NowDateTime().Add(-h.window).String(),
+	})
+
+	total, err := h.app.CountRecords(h.collection, dbx.HashExp{"channel": channelID}, since)
+	if err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, nil
+	}
+
+	working, err := h.app.CountRecords(h.collection, dbx.HashExp{"channel": channelID, "works": true}, since)
+	if err != nil {
+		return 0, err
+	}
+
+	return math.Round(float64(working)/float64(total)*1000) / 10, nil
+}
+
+// prune deletes the checks older than the window, which neither the uptime nor
+// the retirement of channels look at, and returns how many were deleted
+func (h *history) prune() (int, error) {
+	result, err := h.app.DB().Delete(h.collection.Name, dbx.NewExp("[[created]] < {:before}", dbx.Params{
+		"before": types.NowDateTime().Add(-h.window).String(),
+	})).Execute()
+	if err != nil {
+		return 0, err
+	}
+
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(pruned), nil
+}
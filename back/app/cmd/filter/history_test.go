@@ -0,0 +1,56 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+func TestHistoryPrune(t *testing.T) {
+	app := newCatalogApp(t)
+
+	history, err := newHistory(app, 72*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two checks of ch1 left the window, the latest failed
+	for _, check := range []struct {
+		age   time.Duration
+		works bool
+	}{
+		{100 * time.Hour, true},
+		{80 * time.Hour, true},
+		{time.Hour, true},
+		{0, false},
+	} {
+		_, err := app.DB().Insert(model.ChannelChecksCollection, dbx.Params{
+			"id":      core.GenerateDefaultRandomId(),
+			"channel": "ch1",
+			"works":   check.works,
+			"created": types.NowDateTime().Add(-check.age).String(),
+		}).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned, err := history.prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 2 {
+		t.Errorf("pruned %d checks, want the 2 out of the window", pruned)
+	}
+
+	if total, _ := app.CountRecords(model.ChannelChecksCollection); total != 2 {
+		t.Errorf("%d checks left, want 2", total)
+	}
+	if uptime, err := history.uptime("ch1"); err != nil || uptime != 50 {
+		t.Errorf("uptime = %v, %v, want 50 from the checks of the window", uptime, err)
+	}
+}
@@ -0,0 +1,230 @@
+package filter
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// breakerThreshold is the number of consecutive throttled responses that pause a host
+	breakerThreshold = 3
+	breakerCooldown  = 30 * time.Second
+	maxCooldown      = 5 * time.Minute
+	// maxThrottleRetries is how often a throttled channel is checked again after its host was paused
+	maxThrottleRetries = 2
+)
+
+// hostLimiter caps the concurrent checks per host, spaces them by a politeness delay,
+// and pauses a host that keeps answering with throttling status codes
+type hostLimiter struct {
+	perHost int
+	delay   time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	slots chan struct{}
+
+	mu        sync.Mutex
+	next      time.Time
+	openUntil time.Time
+	throttled int
+	cooldown  time.Duration
+}
+
+func newHostLimiter(perHost int, delay time.Duration) *hostLimiter {
+	if perHost < 1 {
+		perHost = 1
+	}
+
+	return &hostLimiter{
+		perHost: perHost,
+		delay:   delay,
+		hosts:   make(map[string]*hostState),
+	}
+}
+
+func (l *hostLimiter) state(host string) *hostState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostState{
+			slots:    make(chan struct{}, l.perHost),
+			cooldown: breakerCooldown,
+		}
+		l.hosts[host] = h
+	}
+
+	return h
+}
+
+// acquire blocks until the host has a free slot, is not paused and the politeness delay passed
+func (l *hostLimiter) acquire(host string) *hostState {
+	h := l.state(host)
+	h.slots <- struct{}{}
+
+	for {
+		h.mu.Lock()
+		now := time.Now()
+		var wait time.Duration
+		switch {
+		case h.openUntil.After(now):
+			wait = h.openUntil.Sub(now)
+		case h.next.After(now):
+			wait = h.next.Sub(now)
+		default:
+			h.next = now.Add(l.delay)
+			h.mu.Unlock()
+			return h
+		}
+		h.mu.Unlock()
+
+		time.Sleep(wait)
+	}
+}
+
+// release frees the slot and feeds the breaker. It returns the pause when the breaker tripped.
+func (l *hostLimiter) release(h *hostState, throttled bool) time.Duration {
+	defer func() { <-h.slots }()
+
+	return h.feed(throttled)
+}
+
+// throttle feeds the breaker of a host that throttled a resource of a stream served from
+// another host, e.g. the CDN of its segments. It returns the pause when the breaker tripped.
+func (l *hostLimiter) throttle(host string) time.Duration {
+	return l.state(host).feed(true)
+}
+
+// feed counts a response of the host and pauses the host once it throttled
+// breakerThreshold times in a row, for longer every time
+func (h *hostState) feed(throttled bool) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !throttled {
+		h.throttled = 0
+		h.cooldown = breakerCooldown
+		return 0
+	}
+
+	h.throttled++
+	if h.throttled < breakerThreshold {
+		return 0
+	}
+
+	pause := h.cooldown
+	h.openUntil = time.Now().Add(pause)
+	h.throttled = 0
+	h.cooldown = min(h.cooldown*2, maxCooldown)
+
+	return pause
+}
+
+// isThrottled reports whether the status code is the way hosts rate limit clients.
+// 403 is not throttling: geo-blocked and forbidden streams are broken for us and are
+// recorded as failures so that they get retired.
+func isThrottled(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests ||
+		statusCode == http.StatusServiceUnavailable
+}
+
+// hostOf returns the host a channel stream is served from
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// interleaveByHost orders channels round-robin across hosts,
+// so that the workers spread over providers instead of queueing on one
+func interleaveByHost(channels []ChannelURL) []ChannelURL {
+	var hosts []string
+	byHost := make(map[string][]ChannelURL)
+	for _, ch := range channels {
+		host := hostOf(ch.URL)
+		if _, ok := byHost[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], ch)
+	}
+
+	ordered := make([]ChannelURL, 0, len(channels))
+	for len(ordered) < len(channels) {
+		for _, host := range hosts {
+			if queue := byHost[host]; len(queue) > 0 {
+				ordered = append(ordered, queue[0])
+				byHost[host] = queue[1:]
+			}
+		}
+	}
+
+	return ordered
+}
+
+// HostSummary is the outcome of a run for the channels of one host
+type HostSummary struct {
+	Host      string `json:"host"`
+	Working   int    `json:"working"`
+	Broken    int    `json:"broken"`
+	Throttled int    `json:"throttled"`
+}
+
+// summarizeHosts groups results by host, hosts with the most broken channels first
+func summarizeHosts(results []Result) []*HostSummary {
+	byHost := make(map[string]*HostSummary)
+	var summaries []*HostSummary
+
+	for _, result := range results {
+		summary, ok := byHost[result.Host]
+		if !ok {
+			summary = &HostSummary{Host: result.Host}
+			byHost[result.Host] = summary
+			summaries = append(summaries, summary)
+		}
+
+		switch {
+		case result.Works:
+			summary.Working++
+		case result.Throttled:
+			summary.Throttled++
+		default:
+			summary.Broken++
+		}
+	}
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if failedI, failedJ := summaries[i].Broken+summaries[i].Throttled, summaries[j].Broken+summaries[j].Throttled; failedI != failedJ {
+			return failedI > failedJ
+		}
+		return summaries[i].Host < summaries[j].Host
+	})
+
+	return summaries
+}
+
+// printHostSummary prints the hosts that had broken or throttled channels
+func printHostSummary(summaries []*HostSummary) {
+	printed := false
+	for _, summary := range summaries {
+		if summary.Broken == 0 && summary.Throttled == 0 {
+			continue
+		}
+		if !printed {
+			fmt.Println("\n🌐 Hosts with failed channels:")
+			printed = true
+		}
+		fmt.Printf("   %s — ✅ %d | ❌ %d | 🚧 %d\n", summary.Host, summary.Working, summary.Broken, summary.Throttled)
+	}
+}
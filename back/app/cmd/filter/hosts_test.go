@@ -0,0 +1,94 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsThrottled(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		want       bool
+	}{
+		{http.StatusTooManyRequests, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusForbidden, false},
+		{http.StatusNotFound, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		if got := isThrottled(tt.statusCode); got != tt.want {
+			t.Errorf("isThrottled(%d) = %t, want %t", tt.statusCode, got, tt.want)
+		}
+	}
+}
+
+func TestCheckURLThrottledResource(t *testing.T) {
+	// A master playlist of two variants whose segments answer with the status of the test
+	var segmentStatus int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Write([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\nlow.m3u8\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720\nhigh.m3u8\n"))
+	})
+	for _, variant := range []string{"low", "high"} {
+		mux.HandleFunc("/"+variant+".m3u8", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6,\n" + variant + ".ts\n"))
+		})
+	}
+	mux.HandleFunc("/low.ts", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(segmentStatus)
+		w.Write(make([]byte, 1024))
+	})
+	mux.HandleFunc("/high.ts", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		segmentStatus int
+		works         bool
+		throttledBy   string
+	}{
+		{"one variant throttled", http.StatusOK, true, ""},
+		{"every variant failing, one throttled", http.StatusNotFound, false, server.URL + "/high.ts"},
+		{"every variant throttled", http.StatusServiceUnavailable, false, server.URL + "/low.ts"},
+	}
+	for _, tt := range tests {
+		segmentStatus = tt.segmentStatus
+		result := checkURL(ChannelURL{ID: "ch1", URL: server.URL + "/master.m3u8"}, server.Client(), 5*time.Second)
+
+		throttledBy := ""
+		if result.throttledBy != nil {
+			throttledBy = result.throttledBy.URL
+		}
+		if result.Works != tt.works || throttledBy != tt.throttledBy {
+			t.Errorf("%s: works = %t, throttled by %q, want %t, %q", tt.name, result.Works, throttledBy, tt.works, tt.throttledBy)
+		}
+	}
+}
+
+func TestHostLimiterThrottle(t *testing.T) {
+	limiter := newHostLimiter(1, 0)
+
+	// A host throttling the resources of streams of other hosts trips its breaker too
+	for i := 1; i < breakerThreshold; i++ {
+		if pause := limiter.throttle("cdn.example"); pause != 0 {
+			t.Fatalf("throttle %d paused the host for %s, want no pause yet", i, pause)
+		}
+	}
+	if pause := limiter.throttle("cdn.example"); pause != breakerCooldown {
+		t.Errorf("throttle %d paused the host for %s, want %s", breakerThreshold, pause, breakerCooldown)
+	}
+	if state := limiter.state("origin.example"); !state.openUntil.IsZero() {
+		t.Error("another host was paused")
+	}
+}
@@ -0,0 +1,53 @@
+package filter
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
+)
+
+// qualities resolves measured quality labels to records of the qualities collection
+type qualities struct {
+	app        core.App
+	collection *core.Collection
+	ids        map[string]string
+}
+
+func newQualities(app core.App) (*qualities, error) {
+	collection, err := app.FindCollectionByNameOrId("qualities")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find qualities collection: %w", err)
+	}
+
+	return &qualities{
+		app:        app,
+		collection: collection,
+		ids:        make(map[string]string),
+	}, nil
+}
+
+// id returns the id of the quality record, creating it when it doesn't exist yet
+func (q *qualities) id(quality string) (string, error) {
+	if id, ok := q.ids[quality]; ok {
+		return id, nil
+	}
+
+	record, err := repository.FindFirstRecord(q.app, q.collection.Name, repository.NewFilter().Eq("quality", quality))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		record = core.NewRecord(q.collection)
+		record.Set("quality", quality)
+		if err := q.app.Save(record); err != nil {
+			return "", err
+		}
+	case err != nil:
+		return "", fmt.Errorf("failed to find quality %q: %w", quality, err)
+	}
+
+	q.ids[quality] = record.Id
+
+	return record.Id, nil
+}
@@ -0,0 +1,158 @@
+package filter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ReportEntry is a line of the filter report
+type ReportEntry struct {
+	ChannelID  string `json:"channel_id"`
+	Title      string `json:"title"`
+	URL        string `json:"url"`
+	Host       string `json:"host"`
+	Works      bool   `json:"works"`
+	Reason     string `json:"reason"`
+	StatusCode int    `json:"status"`
+	LatencyMs  int64  `json:"latency_ms"`
+	Throughput int64  `json:"throughput"`
+	Quality    string `json:"quality,omitempty"`
+	Throttled  bool   `json:"throttled,omitempty"`
+}
+
+// hostReport groups the report entries of one host
+type hostReport struct {
+	*HostSummary
+	Channels []ReportEntry `json:"channels"`
+}
+
+func newReportEntry(record *core.Record, result Result) ReportEntry {
+	return ReportEntry{
+		ChannelID:  result.ChannelID,
+		Title:      record.GetString("title"),
+		URL:        result.URL,
+		Host:       result.Host,
+		Works:      result.Works,
+		Reason:     result.Reason,
+		StatusCode: result.StatusCode,
+		LatencyMs:  result.Latency.Milliseconds(),
+		Throughput: result.Throughput,
+		Quality:    result.Quality,
+		Throttled:  result.Throttled,
+	}
+}
+
+// writeReport writes the entries grouped by host as JSON or CSV to path, "-" meaning stdout.
+// Without an explicit format the extension of path decides, JSON being the default.
+func writeReport(path, format string, entries []ReportEntry, hosts []*HostSummary) error {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if format != "csv" {
+			format = "json"
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	groups := groupByHost(entries, hosts)
+
+	var err error
+	switch format {
+	case "json":
+		err = writeJSONReport(w, groups)
+	case "csv":
+		err = writeCSVReport(w, groups)
+	default:
+		return fmt.Errorf("unknown report format %q, expected json or csv", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if path != "-" {
+		fmt.Printf("📝 Report written to %s\n", path)
+	}
+
+	return nil
+}
+
+// groupByHost orders the entries by the hosts of the summary
+func groupByHost(entries []ReportEntry, hosts []*HostSummary) []hostReport {
+	groups := make([]hostReport, 0, len(hosts))
+	index := make(map[string]int, len(hosts))
+	for i, summary := range hosts {
+		groups = append(groups, hostReport{HostSummary: summary, Channels: []ReportEntry{}})
+		index[summary.Host] = i
+	}
+
+	for _, entry := range entries {
+		if i, ok := index[entry.Host]; ok {
+			groups[i].Channels = append(groups[i].Channels, entry)
+		}
+	}
+
+	return groups
+}
+
+func writeJSONReport(w io.Writer, groups []hostReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(map[string][]hostReport{"hosts": groups})
+}
+
+func writeCSVReport(w io.Writer, groups []hostReport) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"host", "channel_id", "title", "url", "works", "reason", "status", "latency_ms", "throughput", "quality", "throttled"}); err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		if err := writeCSVEntries(cw, group.Channels); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+func writeCSVEntries(cw *csv.Writer, entries []ReportEntry) error {
+	for _, entry := range entries {
+		if err := cw.Write([]string{
+			entry.Host,
+			entry.ChannelID,
+			entry.Title,
+			entry.URL,
+			strconv.FormatBool(entry.Works),
+			entry.Reason,
+			strconv.Itoa(entry.StatusCode),
+			strconv.FormatInt(entry.LatencyMs, 10),
+			strconv.FormatInt(entry.Throughput, 10),
+			entry.Quality,
+			strconv.FormatBool(entry.Throttled),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
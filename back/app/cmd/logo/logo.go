@@ -28,24 +28,29 @@ func LogoCommand(app *pocketbase.PocketBase) *cobra.Command {
 		Use:   "logo",
 		Short: "Parse logos.json and import to PocketBase",
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := runLogo(app); err != nil {
+			if _, err := runLogo(app); err != nil {
 				log.Fatal(err)
 			}
 		},
 	}
 }
 
-func runLogo(app *pocketbase.PocketBase) error {
+// Run imports logos.json for channels without a logo, as the scheduled logo import does
+func Run(app *pocketbase.PocketBase) (map[string]int, error) {
+	return runLogo(app)
+}
+
+func runLogo(app *pocketbase.PocketBase) (map[string]int, error) {
 	// Read JSON file
 	jsonPath := filepath.Join("pkg", "json", "logos.json")
 	data, err := os.ReadFile(jsonPath)
 	if err != nil {
-		return fmt.Errorf("failed to read JSON file: %w", err)
+		return nil, fmt.Errorf("failed to read JSON file: %w", err)
 	}
 
 	var logos []LogoEntry
 	if err := json.Unmarshal(data, &logos); err != nil {
-		return fmt.Errorf("failed to parse JSON: %w", err)
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
 	}
 
 	log.Printf("Found %d logos in JSON file\n", len(logos))
@@ -53,12 +58,12 @@ func runLogo(app *pocketbase.PocketBase) error {
 	// Get collections
 	channelsCollection, err := app.FindCollectionByNameOrId("channels")
 	if err != nil {
-		return fmt.Errorf("failed to find channels collection: %w", err)
+		return nil, fmt.Errorf("failed to find channels collection: %w", err)
 	}
 
 	logosCollection, err := app.FindCollectionByNameOrId("logos")
 	if err != nil {
-		return fmt.Errorf("failed to find logos collection: %w", err)
+		return nil, fmt.Errorf("failed to find logos collection: %w", err)
 	}
 
 	// Build a map of all channels (lowercase channel name -> record)
@@ -74,7 +79,7 @@ func runLogo(app *pocketbase.PocketBase) error {
 		nil,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to load channels: %w", err)
+		return nil, fmt.Errorf("failed to load channels: %w", err)
 	}
 	
 	for _, ch := range allChannels {
@@ -151,7 +156,7 @@ func runLogo(app *pocketbase.PocketBase) error {
 	log.Printf("Not found in database: %d channels\n", notFound)
 	log.Printf("Skipped: %d entries (total)\n", skipped)
 
-	return nil
+	return map[string]int{"imported": imported, "not_found": notFound, "skipped": skipped}, nil
 }
 
 // normalizeChannelName normalizes the channel name for comparison
@@ -4,6 +4,7 @@ import (
 	"log"
 
 	"gitlab.yurtal.tech/company/blitz/business-card/back/cmd/delete"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/cmd/epg"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/cmd/filter"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/cmd/logo"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/cmd/parse"
@@ -33,6 +34,9 @@ func main() {
 	// Register delete command
 	app.RootCmd.AddCommand(delete.DeleteCommand(app))
 
+	// Register epg command
+	app.RootCmd.AddCommand(epg.EPGCommand(app))
+
 	if err := app.Start(); err != nil {
 		log.Fatal(err)
 	}
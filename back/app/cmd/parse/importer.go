@@ -0,0 +1,296 @@
+package parse
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+// defaultSource is the source name of the bundled streams.json import.
+// Channels imported before sources were tracked belong to it.
+const defaultSource = "streams.json"
+
+// channelImport is a parsed stream with its relations resolved, ready to be saved as a channel
+type channelImport struct {
+	Channel    string
+	Feed       string
+	Title      string
+	URL        string
+	QualityID  string
+	CountryID  string
+	LanguageID string
+	CategoryID string
+	UserAgent  string
+	Referrer   string
+	LogoURL    string
+	LogoWidth  float64
+	LogoHeight float64
+}
+
+// importer saves parsed streams as channel records. In upsert mode existing channels
+// are matched by URL or by channel + feed and updated in place, and channels of the
+// same source that are missing from the import are retired.
+type importer struct {
+	app                *pocketbase.PocketBase
+	channelsCollection *core.Collection
+	logosCollection    *core.Collection
+	source             string
+	upsert             bool
+
+	existing []*core.Record
+	byURL    map[string]*core.Record
+	byKey    map[string][]*core.Record
+	seen     map[string]bool
+
+	created       int
+	updated       int
+	unchanged     int
+	retired       int
+	skipped       int
+	logosImported int
+}
+
+func newImporter(app *pocketbase.PocketBase, source string, upsert bool) (*importer, error) {
+	channelsCollection, err := app.FindCollectionByNameOrId("channels")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find channels collection: %w", err)
+	}
+
+	logosCollection, err := app.FindCollectionByNameOrId("logos")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find logos collection: %w", err)
+	}
+
+	im := &importer{
+		app:                app,
+		channelsCollection: channelsCollection,
+		logosCollection:    logosCollection,
+		source:             source,
+		upsert:             upsert,
+		byURL:              make(map[string]*core.Record),
+		byKey:              make(map[string][]*core.Record),
+		seen:               make(map[string]bool),
+	}
+
+	if !upsert {
+		return im, nil
+	}
+
+	im.existing, err = app.FindAllRecords(channelsCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load existing channels: %w", err)
+	}
+
+	for _, record := range im.existing {
+		if url := record.GetString("url"); url != "" {
+			if _, ok := im.byURL[url]; !ok {
+				im.byURL[url] = record
+			}
+		}
+		key := channelKey(record.GetString("channel"), record.GetString("feed"))
+		im.byKey[key] = append(im.byKey[key], record)
+	}
+
+	log.Printf("Loaded %d existing channels for upsert\n", len(im.existing))
+
+	return im, nil
+}
+
+// channelKey identifies a channel feed across imports
+func channelKey(channel, feed string) string {
+	return strings.ToLower(channel) + "@" + strings.ToLower(feed)
+}
+
+// match finds the existing channel an imported stream updates. The same URL always
+// means the same stream, otherwise the first unclaimed channel with the same channel + feed is used.
+func (im *importer) match(item *channelImport) *core.Record {
+	if record, ok := im.byURL[item.URL]; ok && !im.seen[record.Id] {
+		return record
+	}
+
+	for _, record := range im.byKey[channelKey(item.Channel, item.Feed)] {
+		if !im.seen[record.Id] {
+			return record
+		}
+	}
+
+	return nil
+}
+
+// save creates or updates the channel record and the logo of an imported stream
+func (im *importer) save(item *channelImport) {
+	var record *core.Record
+	if im.upsert {
+		record = im.match(item)
+	}
+
+	isNew := record == nil
+	if isNew {
+		record = core.NewRecord(im.channelsCollection)
+	} else {
+		// Claim the record up front so that a failed save doesn't get it retired
+		im.seen[record.Id] = true
+	}
+
+	changed := im.apply(record, item)
+	if changed {
+		if err := im.app.Save(record); err != nil {
+			log.Printf("Warning: failed to save channel %s: %v\n", item.Title, err)
+			im.skipped++
+			return
+		}
+	}
+	im.seen[record.Id] = true
+
+	logoChanged, err := im.saveLogo(record, item)
+	if err != nil {
+		log.Printf("Warning: failed to save logo for channel %s: %v\n", item.Title, err)
+	}
+
+	switch {
+	case isNew:
+		im.created++
+	case changed || logoChanged:
+		im.updated++
+	default:
+		im.unchanged++
+	}
+
+	if total := im.created + im.updated + im.unchanged; total%100 == 0 {
+		log.Printf("Processed %d channels, %d logos...\n", total, im.logosImported)
+	}
+}
+
+// apply copies the imported values onto the record and reports whether anything changed
+func (im *importer) apply(record *core.Record, item *channelImport) bool {
+	fields := map[string]string{
+		"channel":    item.Channel,
+		"feed":       item.Feed,
+		"title":      item.Title,
+		"url":        item.URL,
+		"country":    item.CountryID,
+		"language":   item.LanguageID,
+		"category":   item.CategoryID,
+		"user_agent": item.UserAgent,
+		"referrer":   item.Referrer,
+		"source":     im.source,
+	}
+
+	// The health check measures the quality of working streams, which wins over the imported label
+	if record.GetFloat("throughput") == 0 || record.GetString("url") != item.URL {
+		fields["quality"] = item.QualityID
+	}
+
+	changed := record.IsNew()
+	for field, value := range fields {
+		if record.GetString(field) != value {
+			record.Set(field, value)
+			changed = true
+		}
+	}
+
+	// Channels retired for failing health checks stay retired, a new import doesn't revive them
+	if record.GetBool("is_retired") && record.GetString("retired_reason") != model.RetiredHealth {
+		record.Set("is_retired", false)
+		record.Set("retired_reason", "")
+		changed = true
+	}
+
+	return changed
+}
+
+// saveLogo creates the logo of a channel or updates it when the imported logo differs
+func (im *importer) saveLogo(record *core.Record, item *channelImport) (bool, error) {
+	if item.LogoURL == "" {
+		return false, nil
+	}
+
+	var logoRecord *core.Record
+	if logoID := record.GetString("logo"); logoID != "" {
+		logoRecord, _ = im.app.FindRecordById(im.logosCollection, logoID)
+	}
+
+	if logoRecord != nil &&
+		logoRecord.GetString("logo_url") == item.LogoURL &&
+		logoRecord.GetFloat("width") == item.LogoWidth &&
+		logoRecord.GetFloat("height") == item.LogoHeight {
+		return false, nil
+	}
+
+	isNew := logoRecord == nil
+	if isNew {
+		logoRecord = core.NewRecord(im.logosCollection)
+		logoRecord.Set("channel", record.Id)
+	}
+	logoRecord.Set("logo_url", item.LogoURL)
+	logoRecord.Set("width", item.LogoWidth)
+	logoRecord.Set("height", item.LogoHeight)
+
+	if err := im.app.Save(logoRecord); err != nil {
+		return false, err
+	}
+	im.logosImported++
+
+	if isNew {
+		// Update channel with logo relation
+		record.Set("logo", logoRecord.Id)
+		if err := im.app.Save(record); err != nil {
+			return true, fmt.Errorf("failed to update channel with logo relation: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
+// retireMissing retires the channels of this source that the import no longer contains
+func (im *importer) retireMissing() {
+	if !im.upsert {
+		return
+	}
+
+	for _, record := range im.existing {
+		if im.seen[record.Id] || record.GetBool("is_retired") {
+			continue
+		}
+
+		source := record.GetString("source")
+		if source == "" && im.source == defaultSource {
+			source = defaultSource
+		}
+		if source != im.source {
+			continue
+		}
+
+		record.Set("is_retired", true)
+		record.Set("retired_reason", model.RetiredMissing)
+		if err := im.app.Save(record); err != nil {
+			log.Printf("Warning: failed to retire channel %s: %v\n", record.GetString("title"), err)
+			continue
+		}
+		im.retired++
+	}
+}
+
+// counts returns the outcome of the import for job run records
+func (im *importer) counts() map[string]int {
+	return map[string]int{
+		"created":   im.created,
+		"updated":   im.updated,
+		"unchanged": im.unchanged,
+		"retired":   im.retired,
+		"skipped":   im.skipped,
+		"logos":     im.logosImported,
+	}
+}
+
+// printSummary logs the outcome of the import
+func (im *importer) printSummary() {
+	log.Printf("\nImport of %s complete!\n", im.source)
+	log.Printf("Created: %d | Updated: %d | Unchanged: %d | Retired: %d | Skipped: %d\n",
+		im.created, im.updated, im.unchanged, im.retired, im.skipped)
+	log.Printf("Logos created or updated: %d\n", im.logosImported)
+}
@@ -0,0 +1,40 @@
+package parse
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+func TestApplyRevivesOnlyImportRetirement(t *testing.T) {
+	channels := core.NewBaseCollection("channels")
+	channels.Fields.Add(
+		&core.TextField{Name: "channel"},
+		&core.TextField{Name: "url"},
+		&core.BoolField{Name: "is_retired"},
+		&core.TextField{Name: "retired_reason"},
+	)
+	im := &importer{source: defaultSource}
+	item := &channelImport{Channel: "France24.fr", URL: "https://upstream.example/france24.m3u8"}
+
+	tests := []struct {
+		reason  string
+		retired bool
+	}{
+		{model.RetiredMissing, false},
+		// Retired before the reason was recorded
+		{"", false},
+		{model.RetiredHealth, true},
+	}
+	for _, tt := range tests {
+		record := core.NewRecord(channels)
+		record.Set("is_retired", true)
+		record.Set("retired_reason", tt.reason)
+
+		im.apply(record, item)
+		if got := record.GetBool("is_retired"); got != tt.retired {
+			t.Errorf("reason %q: is_retired = %v after the import, want %v", tt.reason, got, tt.retired)
+		}
+	}
+}
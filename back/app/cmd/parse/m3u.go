@@ -0,0 +1,297 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/pocketbase/pocketbase"
+)
+
+// M3UEntry is a single stream of an #EXTM3U playlist
+type M3UEntry struct {
+	TvgID       string
+	TvgName     string
+	TvgLogo     string
+	GroupTitle  string
+	TvgCountry  string
+	TvgLanguage string
+	Title       string
+	URL         string
+	UserAgent   string
+	Referrer    string
+}
+
+var (
+	// m3uAttrRegex matches key="value" attributes of an #EXTINF line
+	m3uAttrRegex = regexp.MustCompile(`([A-Za-z0-9_-]+)="([^"]*)"`)
+
+	// m3uQualityRegex matches the quality suffix iptv-org puts in titles, e.g. "CNN (1080p)"
+	m3uQualityRegex = regexp.MustCompile(`\((\d{3,4}[pi])\)`)
+)
+
+// parseM3U reads all entries of an #EXTM3U playlist
+func parseM3U(r io.Reader) ([]M3UEntry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var entries []M3UEntry
+	var current *M3UEntry
+	headerSeen := false
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !headerSeen {
+			if !strings.HasPrefix(strings.TrimPrefix(line, "\ufeff"), "#EXTM3U") {
+				return nil, fmt.Errorf("not an M3U playlist: missing #EXTM3U header")
+			}
+			headerSeen = true
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			entry := parseExtInf(line)
+			current = &entry
+		case strings.HasPrefix(line, "#EXTVLCOPT:"):
+			if current == nil {
+				continue
+			}
+			key, value, found := strings.Cut(strings.TrimPrefix(line, "#EXTVLCOPT:"), "=")
+			if !found {
+				continue
+			}
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "http-user-agent":
+				current.UserAgent = strings.TrimSpace(value)
+			case "http-referrer", "http-referer":
+				current.Referrer = strings.TrimSpace(value)
+			}
+		case strings.HasPrefix(line, "#"):
+			// Other directives (#EXTGRP, #KODIPROP, ...) are not imported
+			continue
+		default:
+			if current == nil {
+				continue
+			}
+			current.URL = line
+			entries = append(entries, *current)
+			current = nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read M3U playlist: %w", err)
+	}
+	if !headerSeen {
+		return nil, fmt.Errorf("not an M3U playlist: missing #EXTM3U header")
+	}
+
+	return entries, nil
+}
+
+// parseExtInf parses the attributes and the title of an #EXTINF line
+func parseExtInf(line string) M3UEntry {
+	info := strings.TrimPrefix(line, "#EXTINF:")
+
+	// The title follows the first comma outside of quoted attribute values
+	inQuotes := false
+	titleStart := -1
+	for i, r := range info {
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == ',' && !inQuotes {
+			titleStart = i + 1
+			break
+		}
+	}
+
+	attrs := info
+	title := ""
+	if titleStart >= 0 {
+		attrs = info[:titleStart-1]
+		title = strings.TrimSpace(info[titleStart:])
+	}
+
+	entry := M3UEntry{Title: title}
+	for _, match := range m3uAttrRegex.FindAllStringSubmatch(attrs, -1) {
+		value := strings.TrimSpace(match[2])
+		switch strings.ToLower(match[1]) {
+		case "tvg-id":
+			entry.TvgID = value
+		case "tvg-name":
+			entry.TvgName = value
+		case "tvg-logo":
+			entry.TvgLogo = value
+		case "group-title":
+			entry.GroupTitle = value
+		case "tvg-country":
+			entry.TvgCountry = value
+		case "tvg-language":
+			entry.TvgLanguage = value
+		case "http-user-agent", "user-agent":
+			entry.UserAgent = value
+		case "http-referrer", "http-referer", "referrer":
+			entry.Referrer = value
+		}
+	}
+
+	return entry
+}
+
+// firstListValue returns the first item of a ";" or "," separated attribute value
+func firstListValue(value string) string {
+	value, _, _ = strings.Cut(value, ";")
+	value, _, _ = strings.Cut(value, ",")
+	return strings.TrimSpace(value)
+}
+
+func runParseM3U(app *pocketbase.PocketBase, file, source string, upsert bool) (map[string]int, error) {
+	if file == "" {
+		return nil, fmt.Errorf("--file is required for the m3u format (use \"-\" for stdin)")
+	}
+
+	data, err := readInput(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read M3U playlist: %w", err)
+	}
+
+	entries, err := parseM3U(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Found %d streams in M3U playlist\n", len(entries))
+
+	// Get collections
+	qualitiesCollection, err := app.FindCollectionByNameOrId("qualities")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find qualities collection: %w", err)
+	}
+
+	countriesCollection, err := app.FindCollectionByNameOrId("countries")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find countries collection: %w", err)
+	}
+
+	languagesCollection, err := app.FindCollectionByNameOrId("languages")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find languages collection: %w", err)
+	}
+
+	categoriesCollection, err := app.FindCollectionByNameOrId("categories")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find categories collection: %w", err)
+	}
+
+	// Get or create the "empty" category for channels without group-title
+	emptyCategoryID, err := getOrCreateEmptyCategory(app, categoriesCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get/create empty category: %w", err)
+	}
+
+	im, err := newImporter(app, source, upsert)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.URL == "" || entry.Title == "" {
+			im.skipped++
+			continue
+		}
+
+		// tvg-id is "Channel.cc" or "Channel.cc@Feed", the channel part identifies the channel
+		channelName, _, _ := strings.Cut(entry.TvgID, "@")
+		if channelName == "" {
+			channelName = entry.TvgName
+		}
+		if channelName == "" {
+			channelName = entry.Title
+		}
+
+		// Quality is only known when the title carries it, e.g. "CNN (1080p)"
+		var qualityID string
+		if match := m3uQualityRegex.FindStringSubmatch(entry.Title); match != nil {
+			qualityID, err = getOrCreateQuality(app, qualitiesCollection, match[1])
+			if err != nil {
+				log.Printf("Warning: failed to get/create quality for %s: %v\n", entry.Title, err)
+			}
+		}
+
+		// Country comes from tvg-country, falling back to the tvg-id domain
+		countryName := ""
+		if code := firstListValue(entry.TvgCountry); code != "" {
+			countryName = countryFromCode(code)
+		}
+		if countryName == "" {
+			countryName = extractCountryFromChannel(channelName)
+		}
+		var countryID string
+		if countryName != "" {
+			countryID, err = getOrCreateCountry(app, countriesCollection, countryName)
+			if err != nil {
+				log.Printf("Warning: failed to get/create country for %s: %v\n", entry.Title, err)
+			}
+		}
+
+		// Language comes from tvg-language, falling back to title and tvg-id domain
+		languageName := firstListValue(entry.TvgLanguage)
+		if languageName == "" {
+			languageName = extractLanguage(entry.Title, channelName)
+		}
+		var languageID string
+		if languageName != "" {
+			languageID, err = getOrCreateLanguage(app, languagesCollection, languageName)
+			if err != nil {
+				log.Printf("Warning: failed to get/create language for %s: %v\n", entry.Title, err)
+			}
+		}
+
+		// group-title holds up to three ";" separated categories
+		categoryID := emptyCategoryID
+		var groups []string
+		for _, group := range strings.Split(entry.GroupTitle, ";") {
+			if group = strings.TrimSpace(group); group != "" && !strings.EqualFold(group, "undefined") {
+				groups = append(groups, strings.ToLower(group))
+			}
+		}
+		if len(groups) > 0 {
+			categoryID, err = getOrCreateCategory(app, categoriesCollection, groups)
+			if err != nil {
+				log.Printf("Warning: failed to get/create category for %s: %v\n", entry.Title, err)
+				categoryID = emptyCategoryID
+			}
+		}
+
+		// tvg-id "Channel.cc@Feed" carries the feed after the "@"
+		_, feed, _ := strings.Cut(entry.TvgID, "@")
+
+		im.save(&channelImport{
+			Channel:    channelName,
+			Feed:       feed,
+			Title:      entry.Title,
+			URL:        entry.URL,
+			QualityID:  qualityID,
+			CountryID:  countryID,
+			LanguageID: languageID,
+			CategoryID: categoryID,
+			UserAgent:  entry.UserAgent,
+			Referrer:   entry.Referrer,
+			LogoURL:    entry.TvgLogo,
+		})
+	}
+
+	im.retireMissing()
+	im.printSummary()
+
+	return im.counts(), nil
+}
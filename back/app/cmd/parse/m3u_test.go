@@ -0,0 +1,110 @@
+package parse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExtInf(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want M3UEntry
+	}{
+		{"attributes and title",
+			`#EXTINF:-1 tvg-id="France24.fr" tvg-name="France 24" tvg-logo="https://logos.example/f24.png" group-title="News",France 24 (1080p)`,
+			M3UEntry{TvgID: "France24.fr", TvgName: "France 24", TvgLogo: "https://logos.example/f24.png", GroupTitle: "News", Title: "France 24 (1080p)"}},
+		{"commas in quoted attributes",
+			`#EXTINF:-1 tvg-id="BBCNews.uk" group-title="News,Entertainment" tvg-country="UK,IE",BBC News, London`,
+			M3UEntry{TvgID: "BBCNews.uk", GroupTitle: "News,Entertainment", TvgCountry: "UK,IE", Title: "BBC News, London"}},
+		{"missing tvg-id",
+			`#EXTINF:-1 tvg-name="Local TV" group-title="General",Local TV`,
+			M3UEntry{TvgName: "Local TV", GroupTitle: "General", Title: "Local TV"}},
+		{"no attributes",
+			`#EXTINF:-1,Plain`,
+			M3UEntry{Title: "Plain"}},
+		{"no title",
+			`#EXTINF:-1 tvg-id="NoTitle.fr"`,
+			M3UEntry{TvgID: "NoTitle.fr"}},
+		{"attribute names of any case and headers",
+			`#EXTINF:-1 TVG-ID="Gulli.fr" tvg-language="French;English" http-user-agent="Mozilla/5.0 (X11)" http-referrer="https://gulli.example/",Gulli`,
+			M3UEntry{TvgID: "Gulli.fr", TvgLanguage: "French;English", UserAgent: "Mozilla/5.0 (X11)", Referrer: "https://gulli.example/", Title: "Gulli"}},
+	}
+
+	for _, tt := range tests {
+		if got := parseExtInf(tt.line); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseM3U(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []M3UEntry
+		wantErr bool
+	}{
+		{"entries",
+			"#EXTM3U\n" +
+				`#EXTINF:-1 tvg-id="France24.fr" group-title="News",France 24` + "\n" +
+				"https://upstream.example/france24.m3u8\n" +
+				"\n" +
+				`#EXTINF:-1 group-title="Kids",Gulli` + "\n" +
+				"#EXTGRP:Kids\n" +
+				"https://upstream.example/gulli.m3u8\n",
+			[]M3UEntry{
+				{TvgID: "France24.fr", GroupTitle: "News", Title: "France 24", URL: "https://upstream.example/france24.m3u8"},
+				{GroupTitle: "Kids", Title: "Gulli", URL: "https://upstream.example/gulli.m3u8"},
+			}, false},
+		{"EXTVLCOPT user-agent and referrer",
+			"#EXTM3U\n" +
+				`#EXTINF:-1 tvg-id="BFMTV.fr",BFM TV` + "\n" +
+				"#EXTVLCOPT:http-user-agent=Mozilla/5.0 (Windows NT 10.0)\n" +
+				"#EXTVLCOPT:http-referrer=https://bfmtv.example/\n" +
+				"https://upstream.example/bfmtv.m3u8\n" +
+				`#EXTINF:-1 tvg-id="LEquipe.fr",L'Equipe` + "\n" +
+				"#EXTVLCOPT:http-referer=https://lequipe.example/\n" +
+				"https://upstream.example/lequipe.m3u8\n",
+			[]M3UEntry{
+				{TvgID: "BFMTV.fr", Title: "BFM TV", URL: "https://upstream.example/bfmtv.m3u8",
+					UserAgent: "Mozilla/5.0 (Windows NT 10.0)", Referrer: "https://bfmtv.example/"},
+				{TvgID: "LEquipe.fr", Title: "L'Equipe", URL: "https://upstream.example/lequipe.m3u8", Referrer: "https://lequipe.example/"},
+			}, false},
+		{"CRLF line endings",
+			"#EXTM3U\r\n" +
+				`#EXTINF:-1 tvg-id="France24.fr",France 24` + "\r\n" +
+				"#EXTVLCOPT:http-user-agent=Player/1.0\r\n" +
+				"https://upstream.example/france24.m3u8\r\n",
+			[]M3UEntry{{TvgID: "France24.fr", Title: "France 24", UserAgent: "Player/1.0", URL: "https://upstream.example/france24.m3u8"}},
+			false},
+		{"BOM",
+			"\ufeff#EXTM3U\n" +
+				`#EXTINF:-1 tvg-id="France24.fr",France 24` + "\n" +
+				"https://upstream.example/france24.m3u8\n",
+			[]M3UEntry{{TvgID: "France24.fr", Title: "France 24", URL: "https://upstream.example/france24.m3u8"}},
+			false},
+		{"URL without EXTINF and options before any entry",
+			"#EXTM3U\n" +
+				"#EXTVLCOPT:http-user-agent=Orphan/1.0\n" +
+				"https://upstream.example/orphan.m3u8\n" +
+				`#EXTINF:-1,Kept` + "\n" +
+				"https://upstream.example/kept.m3u8\n",
+			[]M3UEntry{{Title: "Kept", URL: "https://upstream.example/kept.m3u8"}},
+			false},
+		{"missing header", `#EXTINF:-1,France 24` + "\nhttps://upstream.example/france24.m3u8\n", nil, true},
+		{"empty", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseM3U(strings.NewReader(tt.input))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,14 +1,18 @@
 package parse
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/spf13/cobra"
@@ -41,28 +45,59 @@ type CategoryEntry struct {
 }
 
 func ParseCommand(app *pocketbase.PocketBase) *cobra.Command {
-	return &cobra.Command{
+	var format, file, source string
+	var upsert bool
+
+	cmd := &cobra.Command{
 		Use:   "parse",
-		Short: "Parse streams.json and import to PocketBase",
+		Short: "Parse streams.json or an M3U playlist and import to PocketBase",
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := runParse(app); err != nil {
+			if source == "" {
+				source = sourceName(format, file)
+			}
+
+			var err error
+			switch format {
+			case "json":
+				_, err = runParse(app, file, source, upsert)
+			case "m3u":
+				_, err = runParseM3U(app, file, source, upsert)
+			default:
+				err = fmt.Errorf("unknown format %q, expected json or m3u", format)
+			}
+			if err != nil {
 				log.Fatal(err)
 			}
 		},
 	}
+
+	cmd.Flags().StringVar(&format, "format", "json", "input format: json or m3u")
+	cmd.Flags().StringVar(&file, "file", "", "input file, \"-\" reads from stdin (defaults to pkg/json/streams.json for json)")
+	cmd.Flags().BoolVar(&upsert, "upsert", true, "update existing channels in place and retire channels missing from the source")
+	cmd.Flags().StringVar(&source, "source", "", "name of the imported source, channels are only retired by imports of their own source (defaults to the file name)")
+
+	return cmd
 }
 
-func runParse(app *pocketbase.PocketBase) error {
+// Run imports the bundled streams.json in upsert mode, as the scheduled import does
+func Run(app *pocketbase.PocketBase) (map[string]int, error) {
+	return runParse(app, "", defaultSource, true)
+}
+
+func runParse(app *pocketbase.PocketBase, file, source string, upsert bool) (map[string]int, error) {
 	// Read streams JSON file
-	jsonPath := filepath.Join("pkg", "json", "streams.json")
-	data, err := os.ReadFile(jsonPath)
+	jsonPath := file
+	if jsonPath == "" {
+		jsonPath = filepath.Join("pkg", "json", "streams.json")
+	}
+	data, err := readInput(jsonPath)
 	if err != nil {
-		return fmt.Errorf("failed to read streams JSON file: %w", err)
+		return nil, fmt.Errorf("failed to read streams JSON file: %w", err)
 	}
 
 	var streams []StreamEntry
 	if err := json.Unmarshal(data, &streams); err != nil {
-		return fmt.Errorf("failed to parse streams JSON: %w", err)
+		return nil, fmt.Errorf("failed to parse streams JSON: %w", err)
 	}
 
 	log.Printf("Found %d streams in JSON file\n", len(streams))
@@ -71,12 +106,12 @@ func runParse(app *pocketbase.PocketBase) error {
 	logosPath := filepath.Join("pkg", "json", "logos.json")
 	logosData, err := os.ReadFile(logosPath)
 	if err != nil {
-		return fmt.Errorf("failed to read logos JSON file: %w", err)
+		return nil, fmt.Errorf("failed to read logos JSON file: %w", err)
 	}
 
 	var logos []LogoEntry
 	if err := json.Unmarshal(logosData, &logos); err != nil {
-		return fmt.Errorf("failed to parse logos JSON: %w", err)
+		return nil, fmt.Errorf("failed to parse logos JSON: %w", err)
 	}
 
 	log.Printf("Found %d logos in JSON file\n", len(logos))
@@ -95,12 +130,12 @@ func runParse(app *pocketbase.PocketBase) error {
 	categoriesPath := filepath.Join("pkg", "json", "categories.json")
 	categoriesData, err := os.ReadFile(categoriesPath)
 	if err != nil {
-		return fmt.Errorf("failed to read categories JSON file: %w", err)
+		return nil, fmt.Errorf("failed to read categories JSON file: %w", err)
 	}
 
 	var categories []CategoryEntry
 	if err := json.Unmarshal(categoriesData, &categories); err != nil {
-		return fmt.Errorf("failed to parse categories JSON: %w", err)
+		return nil, fmt.Errorf("failed to parse categories JSON: %w", err)
 	}
 
 	log.Printf("Found %d categories in JSON file\n", len(categories))
@@ -116,64 +151,54 @@ func runParse(app *pocketbase.PocketBase) error {
 	log.Printf("Built category map with %d entries\n", len(categoryMap))
 
 	// Get collections
-	channelsCollection, err := app.FindCollectionByNameOrId("channels")
-	if err != nil {
-		return fmt.Errorf("failed to find channels collection: %w", err)
-	}
-
 	qualitiesCollection, err := app.FindCollectionByNameOrId("qualities")
 	if err != nil {
-		return fmt.Errorf("failed to find qualities collection: %w", err)
+		return nil, fmt.Errorf("failed to find qualities collection: %w", err)
 	}
 
 	countriesCollection, err := app.FindCollectionByNameOrId("countries")
 	if err != nil {
-		return fmt.Errorf("failed to find countries collection: %w", err)
+		return nil, fmt.Errorf("failed to find countries collection: %w", err)
 	}
 
 	languagesCollection, err := app.FindCollectionByNameOrId("languages")
 	if err != nil {
-		return fmt.Errorf("failed to find languages collection: %w", err)
-	}
-
-	logosCollection, err := app.FindCollectionByNameOrId("logos")
-	if err != nil {
-		return fmt.Errorf("failed to find logos collection: %w", err)
+		return nil, fmt.Errorf("failed to find languages collection: %w", err)
 	}
 
 	categoriesCollection, err := app.FindCollectionByNameOrId("categories")
 	if err != nil {
-		return fmt.Errorf("failed to find categories collection: %w", err)
+		return nil, fmt.Errorf("failed to find categories collection: %w", err)
 	}
 
 	// Get or create the "empty" category for channels without categories
 	emptyCategoryID, err := getOrCreateEmptyCategory(app, categoriesCollection)
 	if err != nil {
-		return fmt.Errorf("failed to get/create empty category: %w", err)
+		return nil, fmt.Errorf("failed to get/create empty category: %w", err)
 	}
 	log.Printf("Using empty category ID: %s for channels without categories\n", emptyCategoryID)
 
-	imported := 0
-	skipped := 0
-	logosImported := 0
-	logosSkipped := 0
+	im, err := newImporter(app, source, upsert)
+	if err != nil {
+		return nil, err
+	}
 
 	for _, stream := range streams {
 		// Skip if any required field is missing
 		if stream.Channel == nil || *stream.Channel == "" {
-			skipped++
+			im.skipped++
 			continue
 		}
 		if stream.URL == nil || *stream.URL == "" {
-			skipped++
+			im.skipped++
 			continue
 		}
 		if stream.Quality == nil || *stream.Quality == "" {
-			skipped++
+			im.skipped++
 			continue
 		}
 		if stream.Title == "" {
-			skipped++
+			im.skipped++
 			continue
 		}
 
@@ -181,7 +206,7 @@ func runParse(app *pocketbase.PocketBase) error {
 		qualityID, err := getOrCreateQuality(app, qualitiesCollection, *stream.Quality)
 		if err != nil {
 			log.Printf("Warning: failed to get/create quality for %s: %v\n", stream.Title, err)
-			skipped++
+			im.skipped++
 			continue
 		}
 
@@ -219,84 +244,70 @@ func runParse(app *pocketbase.PocketBase) error {
 			categoryID = emptyCategoryID
 		}
 
-		// Create channel record
-		channel := core.NewRecord(channelsCollection)
-		channel.Set("channel", *stream.Channel)
-		channel.Set("title", stream.Title)
-		channel.Set("url", *stream.URL)
-		channel.Set("quality", qualityID)
-		if countryID != "" {
-			channel.Set("country", countryID)
+		item := &channelImport{
+			Channel:    *stream.Channel,
+			Title:      stream.Title,
+			URL:        *stream.URL,
+			QualityID:  qualityID,
+			CountryID:  countryID,
+			LanguageID: languageID,
+			CategoryID: categoryID,
 		}
-		if languageID != "" {
-			channel.Set("language", languageID)
+		if stream.Feed != nil {
+			item.Feed = *stream.Feed
 		}
-		if categoryID != "" {
-			channel.Set("category", categoryID)
+		if stream.UserAgent != nil {
+			item.UserAgent = *stream.UserAgent
 		}
-
-		if err := app.Save(channel); err != nil {
-			log.Printf("Warning: failed to save channel %s: %v\n", stream.Title, err)
-			skipped++
-			continue
+		if stream.Referrer != nil {
+			item.Referrer = *stream.Referrer
 		}
 
-		imported++
-
-		// Try to import logo for this channel
+		// Attach the logo for this channel, if any
 		if logoEntry, found := logoMap[channelNameLower]; found {
-			logoRecord := core.NewRecord(logosCollection)
-			logoRecord.Set("channel", channel.Id)
-			logoRecord.Set("logo_url", logoEntry.URL)
-			logoRecord.Set("width", logoEntry.Width)
-			logoRecord.Set("height", logoEntry.Height)
-
-			if err := app.Save(logoRecord); err != nil {
-				log.Printf("Warning: failed to save logo for channel %s: %v\n", stream.Title, err)
-				logosSkipped++
-			} else {
-				logosImported++
-				
-				// Update channel with logo relation
-				channel.Set("logo", logoRecord.Id)
-				if err := app.Save(channel); err != nil {
-					log.Printf("Warning: failed to update channel %s with logo relation: %v\n", stream.Title, err)
-				}
-			}
-		} else {
-			logosSkipped++
+			item.LogoURL = logoEntry.URL
+			item.LogoWidth = logoEntry.Width
+			item.LogoHeight = logoEntry.Height
 		}
 
-		if imported%100 == 0 {
-			log.Printf("Imported %d channels, %d logos...\n", imported, logosImported)
-		}
+		im.save(item)
 	}
 
-	log.Printf("\nParse complete!\n")
-	log.Printf("Imported: %d channels\n", imported)
-	log.Printf("Skipped: %d channels (missing required fields)\n", skipped)
-	log.Printf("Imported: %d logos\n", logosImported)
-	log.Printf("Skipped: %d logos (not found or errors)\n", logosSkipped)
+	im.retireMissing()
+	im.printSummary()
+
+	return im.counts(), nil
+}
 
-	return nil
+// sourceName derives the source name of an import from its input file
+func sourceName(format, file string) string {
+	switch {
+	case file == "-":
+		return format + ":stdin"
+	case file == "" && format == "json":
+		return defaultSource
+	default:
+		return filepath.Base(file)
+	}
+}
+
+// readInput reads the whole input file, or stdin when path is "-"
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
 }
 
-func getOrCreateQuality(app *pocketbase.PocketBase, collection *core.Collection, qualityValue string) (string, error) {
+func getOrCreateQuality(app core.App, collection *core.Collection, qualityValue string) (string, error) {
 	// Try to find existing quality
-	records, err := app.FindRecordsByFilter(
-		collection.Name,
-		"quality = {:quality}",
-		"-created",
-		1,
-		0,
-		map[string]any{"quality": qualityValue},
-	)
+	id, err := findLatestID(app, collection, dbx.HashExp{"quality": qualityValue})
 	if err != nil {
 		return "", err
 	}
 
-	if len(records) > 0 {
-		return records[0].Id, nil
+	if id != "" {
+		return id, nil
 	}
 
 	// Create new quality record
@@ -310,22 +321,15 @@ func getOrCreateQuality(app *pocketbase.PocketBase, collection *core.Collection,
 	return quality.Id, nil
 }
 
-func getOrCreateCountry(app *pocketbase.PocketBase, collection *core.Collection, countryName string) (string, error) {
+func getOrCreateCountry(app core.App, collection *core.Collection, countryName string) (string, error) {
 	// Try to find existing country
-	records, err := app.FindRecordsByFilter(
-		collection.Name,
-		"name = {:name}",
-		"-created",
-		1,
-		0,
-		map[string]any{"name": countryName},
-	)
+	id, err := findLatestID(app, collection, dbx.HashExp{"name": countryName})
 	if err != nil {
 		return "", err
 	}
 
-	if len(records) > 0 {
-		return records[0].Id, nil
+	if id != "" {
+		return id, nil
 	}
 
 	// Create new country record
@@ -339,22 +343,15 @@ func getOrCreateCountry(app *pocketbase.PocketBase, collection *core.Collection,
 	return country.Id, nil
 }
 
-func getOrCreateLanguage(app *pocketbase.PocketBase, collection *core.Collection, languageName string) (string, error) {
+func getOrCreateLanguage(app core.App, collection *core.Collection, languageName string) (string, error) {
 	// Try to find existing language
-	records, err := app.FindRecordsByFilter(
-		collection.Name,
-		"name = {:name}",
-		"-created",
-		1,
-		0,
-		map[string]any{"name": languageName},
-	)
+	id, err := findLatestID(app, collection, dbx.HashExp{"name": languageName})
 	if err != nil {
 		return "", err
 	}
 
-	if len(records) > 0 {
-		return records[0].Id, nil
+	if id != "" {
+		return id, nil
 	}
 
 	// Create new language record
@@ -368,7 +365,7 @@ func getOrCreateLanguage(app *pocketbase.PocketBase, collection *core.Collection
 	return language.Id, nil
 }
 
-func getOrCreateEmptyCategory(app *pocketbase.PocketBase, collection *core.Collection) (string, error) {
+func getOrCreateEmptyCategory(app core.App, collection *core.Collection) (string, error) {
 	// Try to find existing empty category (all fields empty or null)
 	records, err := app.FindRecordsByFilter(
 		collection.Name,
@@ -395,7 +392,7 @@ func getOrCreateEmptyCategory(app *pocketbase.PocketBase, collection *core.Colle
 	return category.Id, nil
 }
 
-func getOrCreateCategory(app *pocketbase.PocketBase, collection *core.Collection, categories []string) (string, error) {
+func getOrCreateCategory(app core.App, collection *core.Collection, categories []string) (string, error) {
 	// Get up to 3 category names
 	name1 := ""
 	name2 := ""
@@ -411,43 +408,20 @@ func getOrCreateCategory(app *pocketbase.PocketBase, collection *core.Collection
 		name3 = categories[2]
 	}
 
-	// Build filter to find exact match - handle empty strings properly
-	filterParts := []string{}
-	params := map[string]any{}
-	
-	if name1 != "" {
-		filterParts = append(filterParts, "name_1 = {:name1}")
-		params["name1"] = name1
-	} else {
-		filterParts = append(filterParts, "(name_1 = '' || name_1 = null)")
-	}
-	
-	if name2 != "" {
-		filterParts = append(filterParts, "name_2 = {:name2}")
-		params["name2"] = name2
-	} else {
-		filterParts = append(filterParts, "(name_2 = '' || name_2 = null)")
-	}
-	
-	if name3 != "" {
-		filterParts = append(filterParts, "name_3 = {:name3}")
-		params["name3"] = name3
-	} else {
-		filterParts = append(filterParts, "(name_3 = '' || name_3 = null)")
+	// Find an exact match, empty names match empty or null ones
+	var conds []dbx.Expression
+	for i, name := range []string{name1, name2, name3} {
+		field := fmt.Sprintf("name_%d", i+1)
+		if name != "" {
+			conds = append(conds, dbx.HashExp{field: name})
+		} else {
+			conds = append(conds, dbx.Or(dbx.HashExp{field: ""}, dbx.HashExp{field: nil}))
+		}
 	}
-	
-	filter := strings.Join(filterParts, " && ")
 
-	records, err := app.FindRecordsByFilter(
-		collection.Name,
-		filter,
-		"-created",
-		1,
-		0,
-		params,
-	)
-	if err == nil && len(records) > 0 {
-		return records[0].Id, nil
+	id, err := findLatestID(app, collection, dbx.And(conds...))
+	if err == nil && id != "" {
+		return id, nil
 	}
 
 	// Create new category record
@@ -463,6 +437,21 @@ func getOrCreateCategory(app *pocketbase.PocketBase, collection *core.Collection
 	return category.Id, nil
 }
 
+// findLatestID returns the id of the latest record of the collection matching the
+// expression, "" when none does. Values are bound as SQL parameters.
+func findLatestID(app core.App, collection *core.Collection, where dbx.Expression) (string, error) {
+	record := &core.Record{}
+	err := app.RecordQuery(collection).AndWhere(where).OrderBy("created DESC").Limit(1).One(record)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return record.Id, nil
+}
+
 // extractCountryFromChannel extracts country name from channel domain
 func extractCountryFromChannel(channel string) string {
 	// Extract domain extension (e.g., .uz, .ru, .cn)
@@ -471,7 +460,12 @@ func extractCountryFromChannel(channel string) string {
 		return ""
 	}
 
-	domain := strings.ToLower(parts[len(parts)-1])
+	return countryFromCode(parts[len(parts)-1])
+}
+
+// countryFromCode maps a two-letter country code (or domain extension) to a country name
+func countryFromCode(code string) string {
+	domain := strings.ToLower(strings.TrimSpace(code))
 
 	// Map domain to country name - COMPREHENSIVE LIST
 	countryMap := map[string]string{
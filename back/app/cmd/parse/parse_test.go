@@ -0,0 +1,96 @@
+package parse
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/testutil"
+)
+
+// maliciousInputs try to close a quoted value and rewrite the rest of the condition.
+// A value ending with a backslash escaped the closing quote of PocketBase filter strings.
+var maliciousInputs = []string{
+	`x\`,
+	`News\`,
+	` || name_2 = '`,
+	`' || 1=1 || '`,
+	`" || 1=1 || "`,
+	`{:name2}`,
+}
+
+// newLookupApp creates an app with the qualities, countries, languages and categories collections
+func newLookupApp(t *testing.T) *tests.TestApp {
+	t.Helper()
+
+	var collections []*core.Collection
+	for name, fields := range map[string][]string{
+		"qualities":  {"quality"},
+		"countries":  {"name"},
+		"languages":  {"name"},
+		"categories": {"name_1", "name_2", "name_3"},
+	} {
+		collection := core.NewBaseCollection(name)
+		for _, field := range fields {
+			collection.Fields.Add(&core.TextField{Name: field})
+		}
+		collection.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		collections = append(collections, collection)
+	}
+
+	return testutil.NewApp(t, collections...)
+}
+
+func TestGetOrCreate(t *testing.T) {
+	app := newLookupApp(t)
+
+	lookups := map[string]func(collection *core.Collection, value string) (string, error){
+		"qualities": func(collection *core.Collection, value string) (string, error) {
+			return getOrCreateQuality(app, collection, value)
+		},
+		"countries": func(collection *core.Collection, value string) (string, error) {
+			return getOrCreateCountry(app, collection, value)
+		},
+		"languages": func(collection *core.Collection, value string) (string, error) {
+			return getOrCreateLanguage(app, collection, value)
+		},
+		// The value is the second of the category names, after a malicious first one
+		"categories": func(collection *core.Collection, value string) (string, error) {
+			return getOrCreateCategory(app, collection, []string{`News\`, value})
+		},
+	}
+
+	for name, lookup := range lookups {
+		collection, err := app.FindCollectionByNameOrId(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Every value gets its own record, and finds it again
+		ids := make(map[string]string)
+		for _, value := range append([]string{"News", ""}, maliciousInputs...) {
+			id, err := lookup(collection, value)
+			if err != nil {
+				t.Fatalf("%s %q: %v", name, value, err)
+			}
+			ids[value] = id
+		}
+		for value, id := range ids {
+			got, err := lookup(collection, value)
+			if err != nil {
+				t.Fatalf("%s %q: %v", name, value, err)
+			}
+			if got != id {
+				t.Errorf("%s %q resolved to %s, want its record %s", name, value, got, id)
+			}
+		}
+
+		total, err := app.CountRecords(collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := len(ids); int(total) != want {
+			t.Errorf("%s has %d records, want %d", name, total, want)
+		}
+	}
+}
@@ -16,18 +16,23 @@ func ScrapeCommand(app *pocketbase.PocketBase) *cobra.Command {
 		Use:   "scrape",
 		Short: "Scrape actual logo image URLs from webpage URLs and update logo_url fields",
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := runScrape(app); err != nil {
+			if _, err := runScrape(app); err != nil {
 				log.Fatal(err)
 			}
 		},
 	}
 }
 
-func runScrape(app *pocketbase.PocketBase) error {
+// Run replaces logo page URLs with direct image URLs, as the scheduled scrape does
+func Run(app *pocketbase.PocketBase) (map[string]int, error) {
+	return runScrape(app)
+}
+
+func runScrape(app *pocketbase.PocketBase) (map[string]int, error) {
 	// Get logos collection
 	logosCollection, err := app.FindCollectionByNameOrId("logos")
 	if err != nil {
-		return fmt.Errorf("failed to find logos collection: %w", err)
+		return nil, fmt.Errorf("failed to find logos collection: %w", err)
 	}
 
 	// Get all logos (7112 as mentioned)
@@ -40,7 +45,7 @@ func runScrape(app *pocketbase.PocketBase) error {
 		nil,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to load logos: %w", err)
+		return nil, fmt.Errorf("failed to load logos: %w", err)
 	}
 
 	log.Printf("Found %d logos to process\n", len(allLogos))
@@ -104,7 +109,7 @@ func runScrape(app *pocketbase.PocketBase) error {
 	log.Printf("Skipped: %d logos\n", skipped)
 	log.Printf("Failed: %d logos\n", failed)
 
-	return nil
+	return map[string]int{"updated": updated, "already_direct": alreadyDirect, "skipped": skipped, "failed": failed}, nil
 }
 
 // isDirectImageURL checks if the URL already points directly to an image file
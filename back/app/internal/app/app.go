@@ -5,15 +5,24 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/plugins/migratecmd"
 	_ "gitlab.yurtal.tech/company/blitz/business-card/back/artifacts/migrations"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/cmd/delete"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/cmd/epg"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/cmd/filter"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/cmd/logo"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/cmd/parse"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/cmd/scrape"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/handler"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/hook"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/job"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/service"
 )
 
 func NewApp(config *config.Config) *pocketbase.PocketBase {
 	app := pocketbase.New()
 
+	hook.RegisterSearchIndex(app)
+
 	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
 		logger := app.Logger()
 
@@ -25,6 +34,10 @@ func NewApp(config *config.Config) *pocketbase.PocketBase {
 		handlers.Register(e.Router)
 		hooks.Register(app)
 
+		if err := registerJobs(app, job.NewScheduler(app, logger), services, config); err != nil {
+			return err
+		}
+
 		return e.Next()
 	})
 
@@ -34,3 +47,31 @@ func NewApp(config *config.Config) *pocketbase.PocketBase {
 
 	return app
 }
+
+// registerJobs schedules the catalog maintenance commands, the guide import and the stats
+// rollup to run in the background of the server
+func registerJobs(app *pocketbase.PocketBase, scheduler *job.Scheduler, services service.I, config *config.Config) error {
+	jobs := []struct {
+		name     string
+		cronExpr string
+		fn       func(*pocketbase.PocketBase) (map[string]int, error)
+	}{
+		{name: "parse", cronExpr: config.ParseCron, fn: parse.Run},
+		{name: "logo", cronExpr: config.LogoCron, fn: logo.Run},
+		{name: "scrape", cronExpr: config.ScrapeCron, fn: scrape.Run},
+		{name: "filter", cronExpr: config.FilterCron, fn: filter.Run},
+		{name: "delete", cronExpr: config.DeleteCron, fn: delete.Run},
+		{name: "epg", cronExpr: config.EPGCron, fn: epg.Run},
+	}
+
+	for _, j := range jobs {
+		run := j.fn
+		if err := scheduler.Register(j.name, j.cronExpr, func() (map[string]int, error) {
+			return run(app)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return scheduler.Register("stats", config.StatsCron, services.Stats().Rollup)
+}
@@ -4,17 +4,59 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	FeaturedChannels string `env:"FEATURED_CHANNES"`
-	RedisHost        string `env:"REDIS_HOST" env-default:"localhost"`
-	RedisPort        string `env:"REDIS_PORT" env-default:"6379"`
-	RedisPassword    string `env:"REDIS_PASSWORD" env-default:""`
-	RedisDB          int    `env:"REDIS_DB" env-default:"0"`
+	RedisHost     string `env:"REDIS_HOST" env-default:"localhost"`
+	RedisPort     string `env:"REDIS_PORT" env-default:"6379"`
+	RedisPassword string `env:"REDIS_PASSWORD" env-default:""`
+	RedisDB       int    `env:"REDIS_DB" env-default:"0"`
+	PublicBaseURL string `env:"PUBLIC_BASE_URL" env-default:""`
+
+	// Keys signing stream tokens, as comma separated id:secret pairs. The first key signs new
+	// tokens and all of them verify, so a key can be retired once its tokens have expired.
+	StreamTokenKeys string `env:"STREAM_TOKEN_KEYS" env-default:""`
+	// Bind the stream URLs handed out for playback to the IP and User-Agent of the client
+	StreamTokenBindClient bool `env:"STREAM_TOKEN_BIND_CLIENT" env-default:"false"`
+	// How long stream tokens stay valid
+	StreamTokenTTL time.Duration `env:"STREAM_TOKEN_TTL" env-default:"2h"`
+	// How long the playback URLs of exported playlists stay valid, players keep them for longer
+	PlaylistTokenTTL time.Duration `env:"PLAYLIST_TOKEN_TTL" env-default:"24h"`
+	// How many times a token of a listing can be exchanged for playback, 0 for no limit
+	StreamTokenMaxUses int `env:"STREAM_TOKEN_MAX_USES" env-default:"0"`
+	// Only play valid stream tokens, refusing direct URLs and bare channel ids
+	StreamPlayStrict bool `env:"STREAM_PLAY_STRICT" env-default:"true"`
+
+	// Cron expressions of the scheduled jobs, an empty expression disables the job
+	ParseCron  string `env:"PARSE_CRON" env-default:"0 3 * * *"`
+	LogoCron   string `env:"LOGO_CRON" env-default:"30 3 * * *"`
+	ScrapeCron string `env:"SCRAPE_CRON" env-default:""`
+	FilterCron string `env:"FILTER_CRON" env-default:"0 */6 * * *"`
+	DeleteCron string `env:"DELETE_CRON" env-default:""`
+	// Imports the programme guide from EPG_URL
+	EPGCron string `env:"EPG_CRON" env-default:""`
+	// Rolls the viewing stats of the hours that are over up into channel_stats
+	StatsCron string `env:"STATS_CRON" env-default:"5 * * * *"`
+
+	// Watch time older than the window doesn't count towards channel popularity
+	PopularityWindow time.Duration `env:"POPULARITY_WINDOW" env-default:"168h"`
+	// How long the trending, most watched and new rails are cached before they are computed again
+	RailsRefresh time.Duration `env:"RAILS_REFRESH" env-default:"10m"`
+
+	// XMLTV guide imported by the scheduled epg job, a path or an http(s) URL, may be gzipped
+	EPGURL string `env:"EPG_URL" env-default:""`
+	// Programmes that ended longer ago are pruned after every import
+	EPGRetention time.Duration `env:"EPG_RETENTION" env-default:"24h"`
+
+	// Health checks older than the window don't count towards uptime and retirement
+	HealthWindow time.Duration `env:"HEALTH_WINDOW" env-default:"72h"`
+	// Number of consecutive failed checks within the window after which delete retires a channel
+	RetireAfterFailures int `env:"RETIRE_AFTER_FAILURES" env-default:"3"`
 }
 
 var (
@@ -56,9 +98,15 @@ func GetConfig() *Config {
 		fmt.Printf("  REDIS_PORT: %s\n", instance.RedisPort)
 		fmt.Printf("  REDIS_DB: %d\n", instance.RedisDB)
 		fmt.Printf("  REDIS_PASSWORD: %s\n", maskPassword(instance.RedisPassword))
-		if instance.FeaturedChannels != "" {
-			fmt.Println("  FEATURED_CHANNES: ✓ =======================================================>", instance.FeaturedChannels)
-		}
+		fmt.Printf("  PUBLIC_BASE_URL: %s\n", instance.PublicBaseURL)
+		fmt.Printf("  STREAM_TOKEN_KEYS: %s | STREAM_TOKEN_BIND_CLIENT: %t | STREAM_TOKEN_TTL: %s | PLAYLIST_TOKEN_TTL: %s | STREAM_TOKEN_MAX_USES: %d\n",
+			describeKeys(instance.StreamTokenKeys), instance.StreamTokenBindClient, instance.StreamTokenTTL, instance.PlaylistTokenTTL, instance.StreamTokenMaxUses)
+		fmt.Printf("  STREAM_PLAY_STRICT: %t\n", instance.StreamPlayStrict)
+		fmt.Printf("  PARSE_CRON: %q | LOGO_CRON: %q | SCRAPE_CRON: %q | FILTER_CRON: %q | DELETE_CRON: %q | EPG_CRON: %q | STATS_CRON: %q\n",
+			instance.ParseCron, instance.LogoCron, instance.ScrapeCron, instance.FilterCron, instance.DeleteCron, instance.EPGCron, instance.StatsCron)
+		fmt.Printf("  POPULARITY_WINDOW: %s | RAILS_REFRESH: %s\n", instance.PopularityWindow, instance.RailsRefresh)
+		fmt.Printf("  EPG_URL: %s | EPG_RETENTION: %s\n", instance.EPGURL, instance.EPGRetention)
+		fmt.Printf("  HEALTH_WINDOW: %s | RETIRE_AFTER_FAILURES: %d\n", instance.HealthWindow, instance.RetireAfterFailures)
 	})
 	return instance
 }
@@ -72,3 +120,29 @@ func maskPassword(password string) string {
 	}
 	return password[:2] + "****" + password[len(password)-2:]
 }
+
+// describeKeys lists the ids of the id:secret pairs of STREAM_TOKEN_KEYS, never any part
+// of a secret. Entries without an id are listed as "?".
+func describeKeys(keys string) string {
+	var ids []string
+	for _, pair := range strings.Split(keys, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, _, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			id = "?"
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return "(empty)"
+	}
+	if len(ids) == 1 {
+		return fmt.Sprintf("1 key (%s)", ids[0])
+	}
+	return fmt.Sprintf("%d keys (%s)", len(ids), strings.Join(ids, ", "))
+}
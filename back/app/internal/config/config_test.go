@@ -0,0 +1,32 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDescribeKeys(t *testing.T) {
+	secret := "0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"", "(empty)"},
+		{"k1:" + secret, "1 key (k1)"},
+		{" k2:" + secret + " , k1:" + secret + ",", "2 keys (k2, k1)"},
+		// An entry without an id may be a bare secret, it is never printed
+		{secret, "1 key (?)"},
+		{":" + secret, "1 key (?)"},
+	}
+
+	for _, tt := range tests {
+		got := describeKeys(tt.keys)
+		if got != tt.want {
+			t.Errorf("describeKeys(%q) = %q, want %q", tt.keys, got, tt.want)
+		}
+		if strings.Contains(got, secret[:2]) || strings.Contains(got, secret[len(secret)-2:]) {
+			t.Errorf("describeKeys(%q) = %q shows part of a secret", tt.keys, got)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+// RevokeChannelTokensHandler revokes every stream token issued so far for a channel,
+// e.g. when its rights holder asks to take it down
+func (h *Handler) RevokeChannelTokensHandler(e *core.RequestEvent) error {
+	channelID := e.Request.PathValue("id")
+	if channelID == "" {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": "channel id is required",
+		})
+	}
+
+	if err := h.service.Stream().RevokeChannelTokens(channelID); err != nil {
+		return h.errorResponse(e, "failed to revoke channel tokens", err, http.StatusInternalServerError)
+	}
+
+	return e.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) ListFeaturedHandler(e *core.RequestEvent) error {
+	resp, err := h.service.Stream().ListFeatured()
+	if err != nil {
+		return h.errorResponse(e, "failed to list featured slots", err, http.StatusInternalServerError)
+	}
+
+	return e.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) CreateFeaturedHandler(e *core.RequestEvent) error {
+	var req model.FeaturedRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	resp, err := h.service.Stream().CreateFeatured(&req)
+	if err != nil {
+		return h.errorResponse(e, "failed to create featured slot", err, http.StatusInternalServerError)
+	}
+
+	return e.JSON(http.StatusCreated, resp)
+}
+
+func (h *Handler) UpdateFeaturedHandler(e *core.RequestEvent) error {
+	var req model.FeaturedRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	resp, err := h.service.Stream().UpdateFeatured(e.Request.PathValue("id"), &req)
+	if err != nil {
+		return h.errorResponse(e, "failed to update featured slot", err, http.StatusInternalServerError)
+	}
+
+	return e.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) DeleteFeaturedHandler(e *core.RequestEvent) error {
+	if err := h.service.Stream().DeleteFeatured(e.Request.PathValue("id")); err != nil {
+		return h.errorResponse(e, "failed to delete featured slot", err, http.StatusInternalServerError)
+	}
+
+	return e.NoContent(http.StatusNoContent)
+}
+
+// ReorderFeaturedHandler moves the listed slots to the top, in the order given
+func (h *Handler) ReorderFeaturedHandler(e *core.RequestEvent) error {
+	var req model.FeaturedOrderRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	resp, err := h.service.Stream().ReorderFeatured(&req)
+	if err != nil {
+		return h.errorResponse(e, "failed to reorder featured slots", err, http.StatusInternalServerError)
+	}
+
+	return e.JSON(http.StatusOK, resp)
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"log/slog"
 
+	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/router"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
@@ -28,6 +29,7 @@ func (h *Handler) Register(router *router.Router[*core.RequestEvent]) {
 			stream.POST("/play", h.PlayStreamHandler)
 			stream.GET("/featured", h.FeaturedStreamHandler)
 			stream.GET("/channel/:name", h.GetChannelHandler)
+			stream.GET("/channel/{name}/epg", h.ChannelGuideHandler)
 			stream.POST("/recommend", h.RecommendStreamHandler)
 			stream.POST("/category", h.CategoryStreamHandler)
 			stream.POST("/all", h.GetAllStreamHandler)
@@ -35,6 +37,26 @@ func (h *Handler) Register(router *router.Router[*core.RequestEvent]) {
 			stream.GET("/countries", h.GetCountriesHandler)
 			stream.GET("/languages", h.GetLanguagesHandler)
 			stream.POST("/search", h.SearchStreamHandler)
+			stream.GET("/hls/{token}/{path...}", h.HLSProxyHandler)
+			stream.GET("/playlist.m3u", h.M3UPlaylistHandler)
+			stream.GET("/playlist.xspf", h.XSPFPlaylistHandler)
+			stream.GET("/epg.xml", h.GuideHandler)
+			stream.GET("/epg.xml.gz", h.GuideHandler)
+			stream.POST("/events", h.PlayEventHandler)
+			stream.GET("/stats/top", h.TopChannelsHandler)
+			stream.GET("/stats/live", h.LiveViewersHandler)
+			stream.GET("/stats/channel/{name}", h.ChannelStatsHandler)
+			stream.GET("/rails/{kind}", h.RailHandler)
+		}
+		admin := api.Group("/admin")
+		admin.Bind(apis.RequireSuperuserAuth())
+		{
+			admin.POST("/channels/{id}/revoke-tokens", h.RevokeChannelTokensHandler)
+			admin.GET("/featured", h.ListFeaturedHandler)
+			admin.POST("/featured", h.CreateFeaturedHandler)
+			admin.PUT("/featured/order", h.ReorderFeaturedHandler)
+			admin.PATCH("/featured/{id}", h.UpdateFeaturedHandler)
+			admin.DELETE("/featured/{id}", h.DeleteFeaturedHandler)
 		}
 
 	}
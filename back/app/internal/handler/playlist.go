@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+const playlistTitle = "Free TV Channels"
+
+// m3uAttrReplacer keeps attribute values from breaking out of their quotes
+var m3uAttrReplacer = strings.NewReplacer(`"`, "'", "\n", " ", "\r", " ")
+
+type xspfPlaylist struct {
+	XMLName   xml.Name    `xml:"playlist"`
+	Version   string      `xml:"version,attr"`
+	Namespace string      `xml:"xmlns,attr"`
+	Title     string      `xml:"title"`
+	Tracks    []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   string `xml:"location"`
+	Title      string `xml:"title"`
+	Image      string `xml:"image,omitempty"`
+	Annotation string `xml:"annotation,omitempty"`
+}
+
+func (h *Handler) M3UPlaylistHandler(e *core.RequestEvent) error {
+	channels, err := h.service.Stream().GetPlaylistChannels(h.playlistRequest(e))
+	if err != nil {
+		h.logger.Error("failed to get playlist channels", "error", err)
+		return e.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	e.Response.Header().Set("Content-Disposition", `inline; filename="playlist.m3u"`)
+	e.Response.Header().Set("Content-Type", "audio/x-mpegurl; charset=utf-8")
+	e.Response.WriteHeader(http.StatusOK)
+
+	return writeM3U(e.Response, channels, h.guideURL(e))
+}
+
+func (h *Handler) XSPFPlaylistHandler(e *core.RequestEvent) error {
+	channels, err := h.service.Stream().GetPlaylistChannels(h.playlistRequest(e))
+	if err != nil {
+		h.logger.Error("failed to get playlist channels", "error", err)
+		return e.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	playlist := xspfPlaylist{
+		Version:   "1",
+		Namespace: "http://xspf.org/ns/0/",
+		Title:     playlistTitle,
+		Tracks:    make([]xspfTrack, 0, len(channels)),
+	}
+	for _, channel := range channels {
+		track := xspfTrack{
+			Location: channel.URL,
+			Title:    channel.Title,
+		}
+		if channel.Logo != nil {
+			track.Image = channel.Logo.URL
+		}
+		if channel.Category != nil {
+			track.Annotation = channel.Category.Name1
+		}
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+
+	e.Response.Header().Set("Content-Disposition", `inline; filename="playlist.xspf"`)
+
+	return e.XML(http.StatusOK, playlist)
+}
+
+// GuideHandler exports the programme guide of the playlist channels as XMLTV. It is gzipped
+// when requested as epg.xml.gz or when the client accepts gzip.
+func (h *Handler) GuideHandler(e *core.RequestEvent) error {
+	q := e.Request.URL.Query()
+
+	channels, err := h.service.Stream().GetGuideChannels(&model.GuideRequest{
+		Category: q.Get("category"),
+		Country:  q.Get("country"),
+		Language: q.Get("language"),
+	})
+	if err != nil {
+		h.logger.Error("failed to get guide channels", "error", err)
+		return e.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	var w io.Writer = e.Response
+	if strings.HasSuffix(e.Request.URL.Path, ".gz") {
+		e.Response.Header().Set("Content-Disposition", `inline; filename="epg.xml.gz"`)
+		e.Response.Header().Set("Content-Type", "application/gzip")
+		gz := gzip.NewWriter(e.Response)
+		defer gz.Close()
+		w = gz
+	} else {
+		e.Response.Header().Set("Content-Disposition", `inline; filename="epg.xml"`)
+		e.Response.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		e.Response.Header().Add("Vary", "Accept-Encoding")
+		if strings.Contains(e.Request.Header.Get("Accept-Encoding"), "gzip") {
+			e.Response.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(e.Response)
+			defer gz.Close()
+			w = gz
+		}
+	}
+	e.Response.WriteHeader(http.StatusOK)
+
+	// The status is already sent, a failure can only cut the guide short
+	if err := h.service.Stream().WriteGuide(w, channels); err != nil {
+		h.logger.Error("failed to write guide", "error", err)
+	}
+
+	return nil
+}
+
+// guideURL is the guide export of the channels of a playlist export, with the same filters
+func (h *Handler) guideURL(e *core.RequestEvent) string {
+	filters := url.Values{}
+	for _, name := range []string{"category", "country", "language"} {
+		if value := e.Request.URL.Query().Get(name); value != "" {
+			filters.Set(name, value)
+		}
+	}
+
+	guideURL := h.publicBaseURL(e) + "/api/v1/stream/epg.xml"
+	if len(filters) > 0 {
+		guideURL += "?" + filters.Encode()
+	}
+
+	return guideURL
+}
+
+// playlistRequest reads the catalog filters of a playlist export from the query string
+func (h *Handler) playlistRequest(e *core.RequestEvent) *model.PlaylistRequest {
+	q := e.Request.URL.Query()
+
+	return &model.PlaylistRequest{
+		Category: q.Get("category"),
+		Country:  q.Get("country"),
+		Language: q.Get("language"),
+		BaseURL:  h.publicBaseURL(e),
+	}
+}
+
+// publicBaseURL returns the configured public origin of the API,
+// falling back to the origin the request was made to
+func (h *Handler) publicBaseURL(e *core.RequestEvent) string {
+	if h.cfg.PublicBaseURL != "" {
+		return strings.TrimSuffix(h.cfg.PublicBaseURL, "/")
+	}
+
+	scheme := "http"
+	if e.IsTLS() || e.Request.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s", scheme, e.Request.Host)
+}
+
+// writeM3U renders channels as an extended M3U playlist pointing players to their guide
+func writeM3U(w io.Writer, channels []*model.WatchStreamResponse, guideURL string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#EXTM3U x-tvg-url=\"%s\"\n", m3uAttrReplacer.Replace(guideURL))
+
+	for _, channel := range channels {
+		var logo, group, country, language string
+		if channel.Logo != nil {
+			logo = channel.Logo.URL
+		}
+		if channel.Category != nil {
+			group = channel.Category.Name1
+		}
+		if channel.Country != nil {
+			country = channel.Country.Name
+		}
+		if channel.Language != nil {
+			language = channel.Language.Name
+		}
+
+		fmt.Fprintf(bw, "#EXTINF:-1 tvg-id=\"%s\" tvg-name=\"%s\" tvg-logo=\"%s\" tvg-country=\"%s\" tvg-language=\"%s\" group-title=\"%s\",%s\n",
+			m3uAttrReplacer.Replace(channel.Channel),
+			m3uAttrReplacer.Replace(channel.Title),
+			m3uAttrReplacer.Replace(logo),
+			m3uAttrReplacer.Replace(country),
+			m3uAttrReplacer.Replace(language),
+			m3uAttrReplacer.Replace(group),
+			strings.NewReplacer("\n", " ", "\r", " ").Replace(channel.Title),
+		)
+		bw.WriteString(channel.URL + "\n")
+	}
+
+	return bw.Flush()
+}
@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"errors"
+
 	"github.com/pocketbase/pocketbase/core"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/apperror"
 )
 
 func (h *Handler) NewErrorResponse(e *core.RequestEvent, statusCode int, err string) error {
@@ -11,3 +14,18 @@ func (h *Handler) NewErrorResponse(e *core.RequestEvent, statusCode int, err str
 func (h *Handler) NewSuccessResponse(e *core.RequestEvent, statusCode int, content interface{}) error {
 	return e.JSON(statusCode, content)
 }
+
+// errorResponse logs a service error and responds with the status of an AppError,
+// with statusCode for other errors
+func (h *Handler) errorResponse(e *core.RequestEvent, message string, err error, statusCode int) error {
+	h.logger.Error(message, "error", err)
+
+	var appErr *apperror.AppError
+	if errors.As(err, &appErr) {
+		statusCode = appErr.StatusCode
+	}
+
+	return e.JSON(statusCode, map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/core"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+func (h *Handler) PlayEventHandler(e *core.RequestEvent) error {
+	var req model.PlayEventRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	if req.Event == "" || req.Session == "" || req.Channel == "" {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": "event, session and channel are required",
+		})
+	}
+
+	if err := h.service.Stats().RecordPlayEvent(&req); err != nil {
+		return h.errorResponse(e, "failed to record play event", err, http.StatusInternalServerError)
+	}
+
+	return e.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) TopChannelsHandler(e *core.RequestEvent) error {
+	q := e.Request.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	resp, err := h.service.Stats().TopChannels(&model.TopChannelsRequest{
+		Category: q.Get("category"),
+		Country:  q.Get("country"),
+		Language: q.Get("language"),
+		Period:   q.Get("period"),
+		Limit:    limit,
+	})
+	if err != nil {
+		return h.errorResponse(e, "failed to get top channels", err, http.StatusInternalServerError)
+	}
+
+	return e.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) LiveViewersHandler(e *core.RequestEvent) error {
+	limit, _ := strconv.Atoi(e.Request.URL.Query().Get("limit"))
+
+	resp, err := h.service.Stats().LiveViewers(limit)
+	if err != nil {
+		return h.errorResponse(e, "failed to get live viewers", err, http.StatusInternalServerError)
+	}
+
+	return e.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) ChannelStatsHandler(e *core.RequestEvent) error {
+	resp, err := h.service.Stats().ChannelStats(e.Request.PathValue("name"), e.Request.URL.Query().Get("period"))
+	if err != nil {
+		return h.errorResponse(e, "failed to get channel stats", err, http.StatusInternalServerError)
+	}
+
+	return e.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) RailHandler(e *core.RequestEvent) error {
+	resp, err := h.service.Stats().Rail(e.Request.PathValue("kind"))
+	if err != nil {
+		return h.errorResponse(e, "failed to get rail", err, http.StatusInternalServerError)
+	}
+
+	return e.JSON(http.StatusOK, resp)
+}
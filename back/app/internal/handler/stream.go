@@ -3,6 +3,7 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/pocketbase/pocketbase/core"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
@@ -34,7 +35,7 @@ func (h *Handler) WatchStreamHandler(e *core.RequestEvent) error {
 }
 
 func (h *Handler) FeaturedStreamHandler(e *core.RequestEvent) error {
-	resp, err := h.service.Stream().GetFeaturedChannels()
+	resp, err := h.service.Stream().GetFeaturedChannels(e.Request.URL.Query().Get("country"))
 	if err != nil {
 		h.logger.Error("failed to get featured channels", "error", err)
 		return e.JSON(http.StatusInternalServerError, map[string]string{
@@ -70,6 +71,23 @@ func (h *Handler) GetChannelHandler(e *core.RequestEvent) error {
 	return e.JSON(http.StatusOK, resp)
 }
 
+// ChannelGuideHandler lists the programmes of a channel, optionally between the RFC 3339
+// times of the from and to query parameters
+func (h *Handler) ChannelGuideHandler(e *core.RequestEvent) error {
+	q := e.Request.URL.Query()
+
+	resp, err := h.service.Stream().GetChannelGuide(&model.ChannelGuideRequest{
+		Channel: e.Request.PathValue("name"),
+		From:    q.Get("from"),
+		To:      q.Get("to"),
+	})
+	if err != nil {
+		return h.errorResponse(e, "failed to get channel guide", err, http.StatusInternalServerError)
+	}
+
+	return e.JSON(http.StatusOK, resp)
+}
+
 func (h *Handler) CategoryStreamHandler(e *core.RequestEvent) error {
 	var req model.CategoryStreamRequest
 	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
@@ -129,16 +147,13 @@ func (h *Handler) GetAllStreamHandler(e *core.RequestEvent) error {
 	}
 
 	// Default to page 1 if not provided
-	if req.Page < 1 {
+	if req.Page < 1 && req.Cursor == "" {
 		req.Page = 1
 	}
 
 	resp, err := h.service.Stream().GetAllStreams(&req)
 	if err != nil {
-		h.logger.Error("failed to get all streams", "error", err)
-		return e.JSON(http.StatusInternalServerError, map[string]string{
-			"error": err.Error(),
-		})
+		return h.errorResponse(e, "failed to get all streams", err, http.StatusInternalServerError)
 	}
 
 	return e.JSON(http.StatusOK, resp)
@@ -220,13 +235,45 @@ func (h *Handler) PlayStreamHandler(e *core.RequestEvent) error {
 		})
 	}
 
+	req.ClientIP = e.RealIP()
+	req.UserAgent = e.Request.UserAgent()
+
 	resp, err := h.service.Stream().PlayStream(&req)
 	if err != nil {
-		h.logger.Error("failed to play stream", "error", err)
+		return h.errorResponse(e, "failed to play stream", err, http.StatusBadRequest)
+	}
+
+	return e.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) HLSProxyHandler(e *core.RequestEvent) error {
+	req := model.HLSProxyRequest{
+		Token:     e.Request.PathValue("token"),
+		Resource:  e.Request.PathValue("path"),
+		Range:     e.Request.Header.Get("Range"),
+		ClientIP:  e.RealIP(),
+		UserAgent: e.Request.UserAgent(),
+	}
+
+	if req.Token == "" || req.Resource == "" {
 		return e.JSON(http.StatusBadRequest, map[string]string{
-			"error": err.Error(),
+			"error": "token and resource are required",
 		})
 	}
 
-	return e.JSON(http.StatusOK, resp)
+	resp, err := h.service.Stream().ProxyHLS(&req)
+	if err != nil {
+		return h.errorResponse(e, "failed to proxy stream", err, http.StatusBadGateway)
+	}
+	defer resp.Body.Close()
+
+	header := e.Response.Header()
+	for name, value := range resp.Header {
+		header.Set(name, value)
+	}
+	if resp.ContentLength >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+
+	return e.Stream(resp.StatusCode, resp.ContentType, resp.Body)
 }
@@ -13,6 +13,9 @@ type Hook struct {
 }
 
 func (h *Hook) Register(app *pocketbase.PocketBase) {
+	app.OnRecordAfterCreateSuccess(service.LookupCollections...).BindFunc(recordEventWrapper(h.invalidateLookups))
+	app.OnRecordAfterUpdateSuccess(service.LookupCollections...).BindFunc(recordEventWrapper(h.invalidateLookups))
+	app.OnRecordAfterDeleteSuccess(service.LookupCollections...).BindFunc(recordEventWrapper(h.invalidateLookups))
 }
 
 func New(logger *slog.Logger, service service.I) *Hook {
@@ -0,0 +1,46 @@
+package hook
+
+import (
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
+)
+
+// searchRelations maps the collections whose names are indexed with the channels to their relation field
+var searchRelations = map[string]string{
+	"categories": "category",
+	"countries":  "country",
+	"languages":  "language",
+}
+
+// RegisterSearchIndex keeps the channels search index in sync with the records it is built from.
+// Unlike Register it isn't bound on serve, so that channels saved by the commands get indexed too.
+// The records are saved already when the hooks run, so failing to index them is logged rather than returned.
+func RegisterSearchIndex(app *pocketbase.PocketBase) {
+	app.OnRecordAfterCreateSuccess("channels").BindFunc(recordEventWrapper(indexChannel))
+	app.OnRecordAfterUpdateSuccess("channels").BindFunc(recordEventWrapper(indexChannel))
+	app.OnRecordAfterDeleteSuccess("channels").BindFunc(recordEventWrapper(removeChannel))
+	app.OnRecordAfterUpdateSuccess("categories", "countries", "languages").BindFunc(recordEventWrapper(indexRelation))
+}
+
+func indexChannel(e *core.RecordEvent) error {
+	if err := repository.NewRepository(e.App.DB()).Search().IndexChannels(e.Record.Id); err != nil {
+		e.App.Logger().Error("failed to index channel", "id", e.Record.Id, "error", err)
+	}
+	return nil
+}
+
+func removeChannel(e *core.RecordEvent) error {
+	if err := repository.NewRepository(e.App.DB()).Search().RemoveChannels(e.Record.Id); err != nil {
+		e.App.Logger().Error("failed to remove channel from the search index", "id", e.Record.Id, "error", err)
+	}
+	return nil
+}
+
+func indexRelation(e *core.RecordEvent) error {
+	field := searchRelations[e.Record.Collection().Name]
+	if err := repository.NewRepository(e.App.DB()).Search().IndexRelation(field, e.Record.Id); err != nil {
+		e.App.Logger().Error("failed to reindex channels", "collection", e.Record.Collection().Name, "id", e.Record.Id, "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package hook
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// invalidateLookups keeps the lookup cache of the stream service in sync with its collections
+func (h *Hook) invalidateLookups(e *core.RecordEvent) error {
+	h.service.Stream().InvalidateLookups(e.Record.Collection().Name)
+	return nil
+}
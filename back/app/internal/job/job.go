@@ -0,0 +1,121 @@
+package job
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+const (
+	StatusRunning = "running"
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+// Func runs a job once and returns the counts worth recording, e.g. imported or deleted channels
+type Func func() (map[string]int, error)
+
+// Scheduler runs jobs on the PocketBase cron scheduler, never letting two runs
+// of the same job overlap, and records every run in the job_runs collection.
+type Scheduler struct {
+	app    *pocketbase.PocketBase
+	logger *slog.Logger
+}
+
+func NewScheduler(app *pocketbase.PocketBase, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		app:    app,
+		logger: logger,
+	}
+}
+
+// Register schedules the job with a cron expression. An empty expression disables the job.
+func (s *Scheduler) Register(name, cronExpr string, fn Func) error {
+	if cronExpr == "" {
+		s.logger.Info("scheduled job disabled", "job", name)
+		return nil
+	}
+
+	var mu sync.Mutex
+	if err := s.app.Cron().Add(name, cronExpr, func() {
+		if !mu.TryLock() {
+			s.logger.Warn("previous run is still in progress, skipping", "job", name)
+			return
+		}
+		defer mu.Unlock()
+
+		s.run(name, fn)
+	}); err != nil {
+		return fmt.Errorf("failed to schedule job %s: %w", name, err)
+	}
+
+	s.logger.Info("scheduled job registered", "job", name, "cron", cronExpr)
+
+	return nil
+}
+
+// run executes the job and keeps its job_runs record up to date
+func (s *Scheduler) run(name string, fn Func) {
+	record, err := s.startRun(name)
+	if err != nil {
+		s.logger.Error("failed to record job run start", "job", name, "error", err)
+	}
+
+	counts, err := safeRun(fn)
+	if err != nil {
+		s.logger.Error("scheduled job failed", "job", name, "error", err)
+	} else {
+		s.logger.Info("scheduled job finished", "job", name, "counts", counts)
+	}
+
+	if record == nil {
+		return
+	}
+
+	record.Set("finished", types.NowDateTime())
+	record.Set("counts", counts)
+	if err != nil {
+		record.Set("status", StatusFailed)
+		record.Set("error", err.Error())
+	} else {
+		record.Set("status", StatusSuccess)
+	}
+
+	if err := s.app.Save(record); err != nil {
+		s.logger.Error("failed to record job run end", "job", name, "error", err)
+	}
+}
+
+func (s *Scheduler) startRun(name string) (*core.Record, error) {
+	collection, err := s.app.FindCollectionByNameOrId(model.JobRunsCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("job", name)
+	record.Set("status", StatusRunning)
+	record.Set("started", types.NowDateTime())
+
+	if err := s.app.Save(record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// safeRun turns a panic of the job into an error so that the run still gets recorded
+func safeRun(fn Func) (counts map[string]int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return fn()
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Channel is a row of the channels collection. Relations hold the ids of the related records.
+type Channel struct {
+	ID         string         `db:"id"`
+	Channel    string         `db:"channel"`
+	Title      string         `db:"title"`
+	URL        string         `db:"url"`
+	Logo       string         `db:"logo"`
+	Quality    string         `db:"quality"`
+	Category   string         `db:"category"`
+	Country    string         `db:"country"`
+	Language   string         `db:"language"`
+	UserAgent  string         `db:"user_agent"`
+	Referrer   string         `db:"referrer"`
+	IsWorking  bool           `db:"is_working"`
+	IsRetired  bool           `db:"is_retired"`
+	Uptime     float64        `db:"uptime"`
+	Throughput float64        `db:"throughput"`
+	Popularity float64        `db:"popularity"`
+	Created    types.DateTime `db:"created"`
+
+	// QualityHeight is the height of the quality, e.g. 1080 for 1080p, which channels are sorted by
+	QualityHeight int `db:"quality_height"`
+}
+
+// Reasons a channel is retired for, kept in its retired_reason field
+const (
+	RetiredMissing = "missing" // The import of its source no longer contains it
+	RetiredHealth  = "health"  // It failed consecutive health checks
+)
+
+type LogoEntity struct {
+	ID     string  `db:"id"`
+	URL    string  `db:"logo_url"`
+	Width  float64 `db:"width"`
+	Height float64 `db:"height"`
+}
+
+type QualityEntity struct {
+	ID      string `db:"id"`
+	Quality string `db:"quality"`
+}
+
+type CategoryEntity struct {
+	ID    string `db:"id"`
+	Name1 string `db:"name_1"`
+	Name2 string `db:"name_2"`
+	Name3 string `db:"name_3"`
+}
+
+type CountryEntity struct {
+	ID   string `db:"id"`
+	Name string `db:"name"`
+}
+
+type LanguageEntity struct {
+	ID   string `db:"id"`
+	Name string `db:"name"`
+}
+
+// ChannelSortFields are the channel fields listings may be sorted by
+var ChannelSortFields = []string{"quality", "title", "created", "uptime", "popularity"}
+
+// ChannelSort orders channels by a field, ties are always broken by ascending id
+type ChannelSort struct {
+	Field string
+	Desc  bool
+}
+
+// ChannelKey is the position of a channel in a ChannelSort order, used for keyset pagination
+type ChannelKey struct {
+	Value any
+	ID    string
+}
+
+// ChannelQuery selects active channels, retired ones are never listed.
+// Empty fields don't filter, a zero Limit returns every match.
+type ChannelQuery struct {
+	Category       string
+	Country        string
+	Language       string
+	ExcludeIDs     []string
+	ExcludeChannel string
+	OnlyWorking    bool
+
+	// Channels keeps only the channels with these channel identifiers, when set
+	Channels []string
+
+	// Search matches channels whose title or id contains it, ignoring case
+	Search string
+
+	Sort ChannelSort
+
+	// After skips the channels up to and including this position in Sort
+	After *ChannelKey
+
+	Limit  int
+	Offset int
+}
+
+// SortValue returns the value of the field a channel is sorted by
+func (c *Channel) SortValue(field string) any {
+	switch field {
+	case "quality":
+		return c.QualityHeight
+	case "title":
+		return c.Title
+	case "created":
+		return c.Created.String()
+	case "uptime":
+		return c.Uptime
+	case "popularity":
+		return c.Popularity
+	}
+	return nil
+}
+
+// SearchFacetFields are the channel relations search results are counted by
+var SearchFacetFields = []string{"category", "country", "language"}
+
+// searchTermRegex matches the words of a search query, like the unicode61 tokenizer of the index
+var searchTermRegex = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// maxSearchTerms bounds the words of a search query that are matched
+const maxSearchTerms = 8
+
+// SearchQuery searches the active channels by title, channel id, category, country
+// and language names. Category, Country and Language filter by relation id.
+type SearchQuery struct {
+	Text     string
+	Category string
+	Country  string
+	Language string
+	Limit    int
+	Offset   int
+}
+
+// Terms returns the lowercased words of the query text
+func (q *SearchQuery) Terms() []string {
+	return searchTermRegex.FindAllString(strings.ToLower(q.Text), maxSearchTerms)
+}
+
+// Filter returns the relation id the query filters a facet field by
+func (q *SearchQuery) Filter(field string) string {
+	switch field {
+	case "category":
+		return q.Category
+	case "country":
+		return q.Country
+	case "language":
+		return q.Language
+	}
+	return ""
+}
+
+// SearchResult is a page of ranked channels. Facets holds the result counts per
+// relation id of each facet field, Fuzzy tells the terms were matched approximately.
+type SearchResult struct {
+	Channels []*Channel
+	Total    int
+	Fuzzy    bool
+	Facets   map[string]map[string]int
+}
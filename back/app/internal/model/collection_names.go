@@ -4,4 +4,7 @@ const (
 	OtpCollection            = "_otps"
 	CitiesCollection         = "cities"
 	AmoCredentialsCollection = "amoCredentials"
+	JobRunsCollection        = "job_runs"
+	ChannelChecksCollection  = "channel_checks"
+	ProgrammesCollection     = "programmes"
 )
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ProgrammeEntity is a programme of the guide. Channel is the channel identifier,
+// shared by every stream of the channel.
+type ProgrammeEntity struct {
+	ID          string         `db:"id"`
+	Channel     string         `db:"channel"`
+	Start       types.DateTime `db:"start"`
+	Stop        types.DateTime `db:"stop"`
+	Title       string         `db:"title"`
+	SubTitle    string         `db:"sub_title"`
+	Description string         `db:"description"`
+	Category    string         `db:"category"`
+	Icon        string         `db:"icon"`
+}
+
+// Programme is a programme of the guide, times are RFC 3339
+type Programme struct {
+	Start       string `json:"start"`
+	Stop        string `json:"stop"`
+	Title       string `json:"title"`
+	SubTitle    string `json:"sub_title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+}
+
+// NowNext is what a channel airs now and next. Now is empty between programmes.
+type NowNext struct {
+	Now  *Programme `json:"now"`
+	Next *Programme `json:"next"`
+}
+
+// ChannelGuideRequest selects the programmes of a channel airing between From and To,
+// RFC 3339 times defaulting to now and a day later
+type ChannelGuideRequest struct {
+	Channel string
+	From    string
+	To      string
+}
+
+type ChannelGuideResponse struct {
+	Channel    string       `json:"channel"`
+	From       string       `json:"from"`
+	To         string       `json:"to"`
+	Programmes []*Programme `json:"programmes"`
+}
+
+// GuideRequest selects the working channels of the guide export by category, country
+// and language names, like the catalog filters do
+type GuideRequest struct {
+	Category string `json:"category"`
+	Country  string `json:"country"`
+	Language string `json:"language"`
+}
+
+// GuideChannel is a channel of the guide export. ID is the channel identifier,
+// which playlist exports use as tvg-id.
+type GuideChannel struct {
+	ID   string
+	Name string
+	Logo string
+}
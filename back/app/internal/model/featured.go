@@ -0,0 +1,67 @@
+package model
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// FeaturedEntity is a featured slot: a channel shown at a position of the featured rail,
+// optionally only within a time window and only to viewers of some countries
+type FeaturedEntity struct {
+	ID       string         `db:"id"`
+	Channel  string         `db:"channel"`
+	Position int            `db:"position"`
+	StartsAt types.DateTime `db:"starts_at"`
+	EndsAt   types.DateTime `db:"ends_at"`
+	// Countries are the ids of the countries the slot targets, empty targets everyone
+	Countries types.JSONArray[string] `db:"countries"`
+	Created   types.DateTime          `db:"created"`
+	Updated   types.DateTime          `db:"updated"`
+}
+
+// ActiveAt reports whether the time is within the window of the slot
+func (f *FeaturedEntity) ActiveAt(at time.Time) bool {
+	return (f.StartsAt.IsZero() || !at.Before(f.StartsAt.Time())) &&
+		(f.EndsAt.IsZero() || at.Before(f.EndsAt.Time()))
+}
+
+// Targets reports whether the slot is shown in a country, given by id
+func (f *FeaturedEntity) Targets(country string) bool {
+	if len(f.Countries) == 0 {
+		return true
+	}
+	for _, id := range f.Countries {
+		if id == country {
+			return true
+		}
+	}
+	return false
+}
+
+// FeaturedRequest creates or updates a featured slot. On update, fields left out are kept.
+// Times are RFC 3339 and an empty time removes that end of the window. Countries are names.
+type FeaturedRequest struct {
+	ChannelID *string   `json:"channel_id"`
+	Position  *int      `json:"position"`
+	StartsAt  *string   `json:"starts_at"`
+	EndsAt    *string   `json:"ends_at"`
+	Countries *[]string `json:"countries"`
+}
+
+// FeaturedOrderRequest lists featured slot ids in their new order.
+// Slots left out follow them in their current order.
+type FeaturedOrderRequest struct {
+	IDs []string `json:"ids"`
+}
+
+type FeaturedResponse struct {
+	ID        string               `json:"id"`
+	ChannelID string               `json:"channel_id"`
+	Position  int                  `json:"position"`
+	StartsAt  string               `json:"starts_at"`
+	EndsAt    string               `json:"ends_at"`
+	Countries []string             `json:"countries"`
+	Active    bool                 `json:"active"`
+	Channel   *WatchStreamResponse `json:"channel"`
+}
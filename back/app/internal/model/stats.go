@@ -0,0 +1,81 @@
+package model
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Play event types, sent by players while a channel plays
+const (
+	PlayEventStart     = "start"
+	PlayEventHeartbeat = "heartbeat"
+	PlayEventStop      = "stop"
+)
+
+// StatsPeriods are the periods watch statistics are summed over
+var StatsPeriods = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+// Rail kinds, the listings of channels picked by usage
+const (
+	RailTrending    = "trending"
+	RailMostWatched = "most-watched"
+	RailNew         = "new"
+)
+
+// PlayEventRequest reports a play event of a viewing session. Session is a random id
+// the player keeps for as long as it plays one channel after another.
+type PlayEventRequest struct {
+	Event   string `json:"event"`
+	Session string `json:"session"`
+	Channel string `json:"channel"`
+}
+
+// ChannelStatsEntity is the viewing of a channel in an hour, or summed over several
+type ChannelStatsEntity struct {
+	Channel      string         `db:"channel"`
+	Hour         types.DateTime `db:"hour"`
+	Plays        int            `db:"plays"`
+	WatchSeconds int            `db:"watch_seconds"`
+	PeakViewers  int            `db:"peak_viewers"`
+}
+
+// StatsQuery sums the hourly stats since a time per channel, most watched first.
+// Empty fields don't filter, a zero Limit returns every channel.
+type StatsQuery struct {
+	Since     time.Time
+	ChannelID string
+	Category  string
+	Country   string
+	Language  string
+	Limit     int
+}
+
+// TopChannelsRequest selects the most watched channels of a period by
+// category, country and language names
+type TopChannelsRequest struct {
+	Category string
+	Country  string
+	Language string
+	Period   string
+	Limit    int
+}
+
+// ChannelStatsResponse is the viewing of a channel over a period, with its live viewers
+type ChannelStatsResponse struct {
+	Channel      *WatchStreamResponse `json:"channel"`
+	Plays        int                  `json:"plays"`
+	WatchSeconds int                  `json:"watch_seconds"`
+	PeakViewers  int                  `json:"peak_viewers"`
+	Viewers      int                  `json:"viewers"`
+}
+
+// LiveViewersResponse counts the viewers watching right now, in total and per channel
+type LiveViewersResponse struct {
+	Viewers  int                     `json:"viewers"`
+	Channels []*ChannelStatsResponse `json:"channels"`
+}
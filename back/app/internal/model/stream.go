@@ -1,5 +1,7 @@
 package model
 
+import "io"
+
 type WatchStreamRequest struct {
 	ChannelID string `json:"channel_id"`
 	Name      string `json:"name"`
@@ -34,24 +36,36 @@ type WatchStreamResponse struct {
 	Category *Category `json:"category"`
 	Country  *Country  `json:"country"`
 	Language *Language `json:"language"`
+	NowNext  *NowNext  `json:"now_next"`
 }
 
 type CategoryStreamRequest struct {
 	CategoryName string `json:"category_name"`
 }
 
+// RecommendStreamRequest asks for channels like the one being watched. The category,
+// country and language default to those of the channel. Watched lists the channels
+// the client watched recently, left out of the recommendations with ExcludeWatched.
 type RecommendStreamRequest struct {
-	Channel      string `json:"channel"`
-	CategoryName string `json:"category_name"`
-	CountryName  string `json:"country_name"`
-	LanguageName string `json:"language_name"`
+	Channel        string   `json:"channel"`
+	CategoryName   string   `json:"category_name"`
+	CountryName    string   `json:"country_name"`
+	LanguageName   string   `json:"language_name"`
+	Limit          int      `json:"limit"`
+	Watched        []string `json:"watched"`
+	ExcludeWatched bool     `json:"exclude_watched"`
 }
 
+// AllStreamsRequest selects a page of the catalog. Cursor, the next_cursor of the
+// previous page, takes precedence over Page. Sort is one of quality, title, newest, uptime or popular.
 type AllStreamsRequest struct {
 	Category string `json:"category"`
 	Country  string `json:"country"`
 	Language string `json:"language"`
 	Page     int    `json:"page"`
+	PerPage  int    `json:"per_page"`
+	Sort     string `json:"sort"`
+	Cursor   string `json:"cursor"`
 }
 
 type AllStreamsResponse struct {
@@ -60,23 +74,95 @@ type AllStreamsResponse struct {
 	Page       int                    `json:"page"`
 	PerPage    int                    `json:"per_page"`
 	TotalPages int                    `json:"total_pages"`
+	Sort       string                 `json:"sort"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// PlaylistRequest selects the working channels exported as a playlist.
+// BaseURL is the public origin the proxy URLs in the playlist are built on.
+type PlaylistRequest struct {
+	Category string `json:"category"`
+	Country  string `json:"country"`
+	Language string `json:"language"`
+	BaseURL  string `json:"-"`
 }
 
+// SearchStreamRequest searches the catalog. Category, Country and Language narrow
+// the results down by name, like the catalog filters do.
 type SearchStreamRequest struct {
-	Query string `json:"query"`
+	Query    string `json:"query"`
+	Category string `json:"category"`
+	Country  string `json:"country"`
+	Language string `json:"language"`
+	Page     int    `json:"page"`
+	PerPage  int    `json:"per_page"`
 }
 
+// SearchStreamResponse holds a page of the results, most relevant first. Fuzzy is set
+// when nothing matched the query as typed and the results are for similar words.
 type SearchStreamResponse struct {
-	Channels []*WatchStreamResponse `json:"channels"`
-	Total    int                    `json:"total"`
+	Channels   []*WatchStreamResponse `json:"channels"`
+	Total      int                    `json:"total"`
+	Page       int                    `json:"page"`
+	PerPage    int                    `json:"per_page"`
+	TotalPages int                    `json:"total_pages"`
+	Fuzzy      bool                   `json:"fuzzy"`
+	Facets     *SearchFacets          `json:"facets"`
+}
+
+// SearchFacets count the results per category, country and language. The counts of
+// a facet ignore its own filter, so that the other values remain selectable.
+type SearchFacets struct {
+	Categories []*Facet `json:"categories"`
+	Countries  []*Facet `json:"countries"`
+	Languages  []*Facet `json:"languages"`
+}
+
+type Facet struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
 }
 
 type PlayStreamRequest struct {
-	Token     string `json:"token,omitempty"`      // Optional: for backward compatibility
-	ChannelID string `json:"channel_id,omitempty"` // Channel ID to fetch stream URL
-	URL       string `json:"url,omitempty"`        // Direct stream URL
+	Token     string `json:"token,omitempty"`      // Stream token of a channel listing
+	ChannelID string `json:"channel_id,omitempty"` // Channel ID to fetch stream URL, refused in strict mode
+	URL       string `json:"url,omitempty"`        // Direct stream URL, refused in strict mode
+
+	ClientIP  string `json:"-"`
+	UserAgent string `json:"-"`
 }
 
 type PlayStreamResponse struct {
-	URL string `json:"url"`
+	URL       string `json:"url"`
+	UserAgent string `json:"user_agent,omitempty"` // Set when the upstream must be played with this User-Agent
+	Referrer  string `json:"referrer,omitempty"`   // Set when the upstream must be played with this Referer
+}
+
+// StreamSource is the upstream stream of a channel, together with the
+// headers the upstream expects from players.
+type StreamSource struct {
+	ChannelID string `json:"channel_id"`
+	URL       string `json:"url"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Referrer  string `json:"referrer,omitempty"`
+}
+
+// HLSProxyRequest addresses a resource of a stream token in the HLS proxy.
+// Resource is "index" plus extension for the token playlist, or a key issued by the proxy.
+type HLSProxyRequest struct {
+	Token     string
+	Resource  string
+	Range     string
+	ClientIP  string
+	UserAgent string
+}
+
+// HLSProxyResponse is an upstream resource fetched through the HLS proxy.
+// Playlists are already rewritten to proxy URLs, everything else is streamed as is.
+type HLSProxyResponse struct {
+	StatusCode    int
+	ContentType   string
+	ContentLength int64
+	Header        map[string]string
+	Body          io.ReadCloser
 }
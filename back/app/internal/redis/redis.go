@@ -2,12 +2,56 @@ package redis
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/pocketbase/pocketbase/tools/types"
 	"github.com/redis/go-redis/v9"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+const (
+	// proxyKeyPrefix prefixes the hash holding the proxied URLs of a token
+	proxyKeyPrefix = "hls:"
+
+	// usesKeyPrefix prefixes the counter of the uses of a token
+	usesKeyPrefix = "token:uses:"
+
+	// revokedKeyPrefix prefixes the time up to which the tokens of a channel are revoked
+	revokedKeyPrefix = "token:revoked:"
+
+	// coWatchKeyPrefix prefixes the sorted set of the channels watched along with a channel
+	coWatchKeyPrefix = "cowatch:"
+
+	// coWatchTTL forgets the co-watch counts of channels nobody watched for a while
+	coWatchTTL = 30 * 24 * time.Hour
+
+	// maxCoWatched bounds the channels kept per co-watch set, the least watched are dropped
+	maxCoWatched = 200
+
+	// viewersKeyPrefix prefixes the sorted set of the sessions watching a channel, scored by when they were last seen
+	viewersKeyPrefix = "viewers:"
+
+	// liveChannelsKey is the set of the channels that may have viewers
+	liveChannelsKey = "viewers:channels"
+
+	// sessionKeyPrefix prefixes the channel a viewing session played last
+	sessionKeyPrefix = "session:"
+
+	// statsKeyPrefix prefixes the hash of the play and watch time counters of an hour, per channel
+	statsKeyPrefix = "stats:"
+
+	// statsHoursKey is the set of the hours with buffered stats
+	statsHoursKey = "stats:hours"
+
+	// railKeyPrefix prefixes the cached channel ids of a rail
+	railKeyPrefix = "rails:"
 )
 
 type RedisClient struct {
@@ -36,42 +80,342 @@ func NewRedisClient(cfg *config.Config) (*RedisClient, error) {
 	}, nil
 }
 
-// GenerateURLToken generates a UUID token for the given URL and stores it in Redis with 2-hour expiration
-func (r *RedisClient) GenerateURLToken(url string) (string, error) {
-	// Generate UUID
-	token := uuid.New().String()
+// StoreProxyURLs remembers the upstream URLs referenced by the playlist of a token
+// and returns the short keys the proxy exposes instead of them, indexed by URL.
+// The URLs live for ttl, the remaining lifetime of the token.
+func (r *RedisClient) StoreProxyURLs(token string, urls []string, ttl time.Duration) (map[string]string, error) {
+	keys := make(map[string]string, len(urls))
+	if len(urls) == 0 {
+		return keys, nil
+	}
 
-	// Store URL with token as key, expires in 2 hours
-	expiration := 2 * time.Hour
-	err := r.client.Set(r.ctx, token, url, expiration).Err()
-	if err != nil {
-		return "", fmt.Errorf("failed to store URL in Redis: %w", err)
+	if ttl <= 0 {
+		return nil, fmt.Errorf("token expired")
 	}
 
-	return token, nil
+	values := make([]any, 0, len(urls)*2)
+	for _, url := range urls {
+		sum := sha256.Sum256([]byte(url))
+		key := hex.EncodeToString(sum[:8])
+		keys[url] = key
+		values = append(values, key, url)
+	}
+
+	hashKey := proxyKeyPrefix + token
+	pipe := r.client.TxPipeline()
+	pipe.HSet(r.ctx, hashKey, values...)
+	pipe.Expire(r.ctx, hashKey, ttl)
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return nil, fmt.Errorf("failed to store proxy URLs in Redis: %w", err)
+	}
+
+	return keys, nil
 }
 
-// GetURLByToken retrieves the URL associated with the given token
-func (r *RedisClient) GetURLByToken(token string) (string, error) {
-	url, err := r.client.Get(r.ctx, token).Result()
+// GetProxyURL retrieves an upstream URL previously stored with StoreProxyURLs
+func (r *RedisClient) GetProxyURL(token, key string) (string, error) {
+	url, err := r.client.HGet(r.ctx, proxyKeyPrefix+token, key).Result()
 	if err == redis.Nil {
-		return "", fmt.Errorf("token not found or expired")
+		return "", fmt.Errorf("proxy URL not found or expired")
 	} else if err != nil {
-		return "", fmt.Errorf("failed to retrieve URL from Redis: %w", err)
+		return "", fmt.Errorf("failed to retrieve proxy URL from Redis: %w", err)
 	}
 
 	return url, nil
 }
 
-// DeleteToken removes a token from Redis
-func (r *RedisClient) DeleteToken(token string) error {
-	err := r.client.Del(r.ctx, token).Err()
+// UseToken counts a use of the token with the id and returns its uses so far.
+// The counter lives for ttl, the remaining lifetime of the token.
+func (r *RedisClient) UseToken(id string, ttl time.Duration) (int64, error) {
+	key := usesKeyPrefix + id
+
+	pipe := r.client.TxPipeline()
+	uses := pipe.Incr(r.ctx, key)
+	pipe.Expire(r.ctx, key, ttl)
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return 0, fmt.Errorf("failed to count token use in Redis: %w", err)
+	}
+
+	return uses.Val(), nil
+}
+
+// RevokeChannelTokens revokes the tokens of a channel issued up to now.
+// The revocation is kept for ttl, the longest lifetime of a token.
+func (r *RedisClient) RevokeChannelTokens(channelID string, ttl time.Duration) error {
+	err := r.client.Set(r.ctx, revokedKeyPrefix+channelID, time.Now().Unix(), ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to revoke channel tokens in Redis: %w", err)
+	}
+	return nil
+}
+
+// ChannelTokensRevokedAt returns up to when the tokens of a channel are revoked,
+// the zero time when they aren't
+func (r *RedisClient) ChannelTokensRevokedAt(channelID string) (time.Time, error) {
+	revoked, err := r.client.Get(r.ctx, revokedKeyPrefix+channelID).Int64()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read channel token revocation from Redis: %w", err)
+	}
+
+	return time.Unix(revoked, 0), nil
+}
+
+// RecordCoWatch counts that a channel was watched along with each of the others, both ways
+func (r *RedisClient) RecordCoWatch(channel string, others []string) error {
+	pipe := r.client.TxPipeline()
+	for _, other := range others {
+		if other == channel {
+			continue
+		}
+		for _, pair := range [][2]string{{channel, other}, {other, channel}} {
+			key := coWatchKeyPrefix + pair[0]
+			pipe.ZIncrBy(r.ctx, key, 1, pair[1])
+			pipe.ZRemRangeByRank(r.ctx, key, 0, -maxCoWatched-1)
+			pipe.Expire(r.ctx, key, coWatchTTL)
+		}
+	}
+
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return fmt.Errorf("failed to record co-watch in Redis: %w", err)
+	}
+	return nil
+}
+
+// CoWatched returns the channels most watched along with a channel and how often
+func (r *RedisClient) CoWatched(channel string, limit int) (map[string]float64, error) {
+	entries, err := r.client.ZRevRangeWithScores(r.ctx, coWatchKeyPrefix+channel, 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read co-watch from Redis: %w", err)
+	}
+
+	counts := make(map[string]float64, len(entries))
+	for _, entry := range entries {
+		if member, ok := entry.Member.(string); ok {
+			counts[member] = entry.Score
+		}
+	}
+
+	return counts, nil
+}
+
+// TouchViewer marks a session as watching a channel at a time and returns when it was
+// last seen watching it, the zero time when it wasn't
+func (r *RedisClient) TouchViewer(channelID, session string, at time.Time) (time.Time, error) {
+	key := viewersKeyPrefix + channelID
+
+	pipe := r.client.TxPipeline()
+	last := pipe.ZScore(r.ctx, key, session)
+	pipe.ZAdd(r.ctx, key, redis.Z{Score: float64(at.Unix()), Member: session})
+	pipe.SAdd(r.ctx, liveChannelsKey, channelID)
+	if _, err := pipe.Exec(r.ctx); err != nil && err != redis.Nil {
+		return time.Time{}, fmt.Errorf("failed to touch viewer in Redis: %w", err)
+	}
+
+	if last.Err() == redis.Nil {
+		return time.Time{}, nil
+	}
+	return time.Unix(int64(last.Val()), 0), nil
+}
+
+// RemoveViewer forgets a session watching a channel
+func (r *RedisClient) RemoveViewer(channelID, session string) error {
+	if err := r.client.ZRem(r.ctx, viewersKeyPrefix+channelID, session).Err(); err != nil {
+		return fmt.Errorf("failed to remove viewer from Redis: %w", err)
+	}
+	return nil
+}
+
+// CountViewers drops the sessions of a channel not seen since a time and counts the rest
+func (r *RedisClient) CountViewers(channelID string, since time.Time) (int64, error) {
+	key := viewersKeyPrefix + channelID
+
+	pipe := r.client.TxPipeline()
+	pipe.ZRemRangeByScore(r.ctx, key, "-inf", fmt.Sprintf("(%d", since.Unix()))
+	count := pipe.ZCard(r.ctx, key)
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return 0, fmt.Errorf("failed to count viewers in Redis: %w", err)
+	}
+
+	return count.Val(), nil
+}
+
+// LiveViewers counts the viewers seen since a time per channel.
+// Channels left without viewers are forgotten.
+func (r *RedisClient) LiveViewers(since time.Time) (map[string]int64, error) {
+	channelIDs, err := r.client.SMembers(r.ctx, liveChannelsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read live channels from Redis: %w", err)
+	}
+
+	viewers := make(map[string]int64, len(channelIDs))
+	for _, channelID := range channelIDs {
+		count, err := r.CountViewers(channelID, since)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			r.client.SRem(r.ctx, liveChannelsKey, channelID)
+			continue
+		}
+		viewers[channelID] = count
+	}
+
+	return viewers, nil
+}
+
+// SwapSessionChannel stores the channel a session plays for ttl and returns the channel
+// it played before, empty when there was none
+func (r *RedisClient) SwapSessionChannel(session, channel string, ttl time.Duration) (string, error) {
+	previous, err := r.client.SetArgs(r.ctx, sessionKeyPrefix+session, channel, redis.SetArgs{Get: true, TTL: ttl}).Result()
+	if err == redis.Nil {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to store session channel in Redis: %w", err)
+	}
+	return previous, nil
+}
+
+// AddHourlyStats buffers plays, watch seconds and the current viewers of a channel
+// in the counters of an hour, keeping the peak of the viewers
+func (r *RedisClient) AddHourlyStats(hour time.Time, channelID string, plays, seconds, viewers int64) error {
+	key := statsKey(hour)
+
+	pipe := r.client.TxPipeline()
+	if plays > 0 {
+		pipe.HIncrBy(r.ctx, key, channelID+":plays", plays)
+	}
+	if seconds > 0 {
+		pipe.HIncrBy(r.ctx, key, channelID+":seconds", seconds)
+	}
+	if viewers > 0 {
+		pipe.ZAddGT(r.ctx, key+":peak", redis.Z{Score: float64(viewers), Member: channelID})
+	}
+	pipe.SAdd(r.ctx, statsHoursKey, hour.Unix())
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return fmt.Errorf("failed to buffer stats in Redis: %w", err)
+	}
+
+	return nil
+}
+
+// PendingStatsHours returns the hours with buffered stats, in no particular order
+func (r *RedisClient) PendingStatsHours() ([]time.Time, error) {
+	hours, err := r.client.SMembers(r.ctx, statsHoursKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stats hours from Redis: %w", err)
+	}
+
+	result := make([]time.Time, 0, len(hours))
+	for _, hour := range hours {
+		unix, err := strconv.ParseInt(hour, 10, 64)
+		if err != nil {
+			continue
+		}
+		result = append(result, time.Unix(unix, 0).UTC())
+	}
+
+	return result, nil
+}
+
+// HourlyStats returns the stats buffered for an hour per channel
+func (r *RedisClient) HourlyStats(hour time.Time) ([]*model.ChannelStatsEntity, error) {
+	key := statsKey(hour)
+
+	counters, err := r.client.HGetAll(r.ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stats from Redis: %w", err)
+	}
+	peaks, err := r.client.ZRangeWithScores(r.ctx, key+":peak", 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peak viewers from Redis: %w", err)
+	}
+
+	dt, _ := types.ParseDateTime(hour)
+	byChannel := make(map[string]*model.ChannelStatsEntity)
+	entry := func(channelID string) *model.ChannelStatsEntity {
+		if _, ok := byChannel[channelID]; !ok {
+			byChannel[channelID] = &model.ChannelStatsEntity{Channel: channelID, Hour: dt}
+		}
+		return byChannel[channelID]
+	}
+
+	for field, value := range counters {
+		channelID, counter, ok := strings.Cut(field, ":")
+		count, err := strconv.Atoi(value)
+		if !ok || err != nil {
+			continue
+		}
+		switch counter {
+		case "plays":
+			entry(channelID).Plays = count
+		case "seconds":
+			entry(channelID).WatchSeconds = count
+		}
+	}
+	for _, peak := range peaks {
+		if channelID, ok := peak.Member.(string); ok {
+			entry(channelID).PeakViewers = int(peak.Score)
+		}
+	}
+
+	stats := make([]*model.ChannelStatsEntity, 0, len(byChannel))
+	for _, s := range byChannel {
+		stats = append(stats, s)
+	}
+
+	return stats, nil
+}
+
+// DeleteHourlyStats drops the stats buffered for an hour
+func (r *RedisClient) DeleteHourlyStats(hour time.Time) error {
+	key := statsKey(hour)
+
+	pipe := r.client.TxPipeline()
+	pipe.Del(r.ctx, key, key+":peak")
+	pipe.SRem(r.ctx, statsHoursKey, hour.Unix())
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return fmt.Errorf("failed to delete stats from Redis: %w", err)
+	}
+
+	return nil
+}
+
+// GetRail returns the cached channel ids of a rail, and false when none are cached
+func (r *RedisClient) GetRail(kind string) ([]string, bool, error) {
+	data, err := r.client.Get(r.ctx, railKeyPrefix+kind).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to read rail from Redis: %w", err)
+	}
+
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal rail: %w", err)
+	}
+
+	return ids, true, nil
+}
+
+// StoreRail caches the channel ids of a rail for ttl
+func (r *RedisClient) StoreRail(kind string, ids []string, ttl time.Duration) error {
+	data, err := json.Marshal(ids)
 	if err != nil {
-		return fmt.Errorf("failed to delete token from Redis: %w", err)
+		return fmt.Errorf("failed to marshal rail: %w", err)
+	}
+
+	if err := r.client.Set(r.ctx, railKeyPrefix+kind, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store rail in Redis: %w", err)
 	}
 	return nil
 }
 
+func statsKey(hour time.Time) string {
+	return statsKeyPrefix + strconv.FormatInt(hour.Unix(), 10)
+}
+
 // Close closes the Redis connection
 func (r *RedisClient) Close() error {
 	return r.client.Close()
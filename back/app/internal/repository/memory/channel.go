@@ -0,0 +1,216 @@
+// Package memory implements the repositories in memory, so that services can be
+// exercised without a database.
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
+)
+
+var _ repository.ChannelRepository = (*Channel)(nil)
+
+type Channel struct {
+	mu       sync.RWMutex
+	channels []*model.Channel
+	logos    map[string]*model.LogoEntity
+}
+
+func NewChannel(channels ...*model.Channel) *Channel {
+	return &Channel{
+		channels: channels,
+		logos:    make(map[string]*model.LogoEntity),
+	}
+}
+
+// Add stores more channels
+func (r *Channel) Add(channels ...*model.Channel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.channels = append(r.channels, channels...)
+}
+
+// AddLogos stores logos channels may refer to
+func (r *Channel) AddLogos(logos ...*model.LogoEntity) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, logo := range logos {
+		r.logos[logo.ID] = logo
+	}
+}
+
+func (r *Channel) FindByID(id string) (*model.Channel, error) {
+	return r.findFirst(func(c *model.Channel) bool { return c.ID == id })
+}
+
+func (r *Channel) FindByChannel(channel string) (*model.Channel, error) {
+	return r.findFirst(func(c *model.Channel) bool { return c.Channel == channel })
+}
+
+func (r *Channel) FindByIDs(ids []string) ([]*model.Channel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var channels []*model.Channel
+	for _, channel := range r.channels {
+		if slices.Contains(ids, channel.ID) {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels, nil
+}
+
+func (r *Channel) Find(query *model.ChannelQuery) ([]*model.Channel, error) {
+	channels, err := r.match(query, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.Sort.Field != "" {
+		sort.SliceStable(channels, func(i, j int) bool {
+			return before(channels[i], channels[j], query.Sort)
+		})
+	}
+
+	if query.Offset >= len(channels) {
+		return nil, nil
+	}
+	channels = channels[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(channels) {
+		channels = channels[:query.Limit]
+	}
+
+	return channels, nil
+}
+
+func (r *Channel) Count(query *model.ChannelQuery) (int, error) {
+	channels, err := r.match(query, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(channels), nil
+}
+
+func (r *Channel) FindLogos(ids []string) ([]*model.LogoEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var logos []*model.LogoEntity
+	for _, id := range ids {
+		if logo, ok := r.logos[id]; ok {
+			logos = append(logos, logo)
+		}
+	}
+
+	return logos, nil
+}
+
+func (r *Channel) findFirst(fn func(c *model.Channel) bool) (*model.Channel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, channel := range r.channels {
+		if fn(channel) {
+			return channel, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// match returns the channels matching the query like the SQLite repository does
+func (r *Channel) match(query *model.ChannelQuery, withPosition bool) ([]*model.Channel, error) {
+	if query.Sort.Field != "" && !slices.Contains(model.ChannelSortFields, query.Sort.Field) {
+		return nil, fmt.Errorf("invalid channel sort field %q", query.Sort.Field)
+	}
+	if withPosition && query.After != nil && query.Sort.Field == "" {
+		return nil, fmt.Errorf("channel position requires a sort")
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	search := strings.ToLower(query.Search)
+
+	var channels []*model.Channel
+	for _, c := range r.channels {
+		switch {
+		case c.IsRetired,
+			query.Category != "" && c.Category != query.Category,
+			query.Country != "" && c.Country != query.Country,
+			query.Language != "" && c.Language != query.Language,
+			slices.Contains(query.ExcludeIDs, c.ID),
+			query.ExcludeChannel != "" && c.Channel == query.ExcludeChannel,
+			query.OnlyWorking && !c.IsWorking,
+			len(query.Channels) > 0 && !slices.Contains(query.Channels, c.Channel),
+			search != "" && !strings.Contains(strings.ToLower(c.Title), search) && !strings.Contains(strings.ToLower(c.ID), search):
+			continue
+		}
+
+		if withPosition && query.After != nil {
+			cmp := compare(c.SortValue(query.Sort.Field), query.After.Value)
+			if query.Sort.Desc {
+				cmp = -cmp
+			}
+			if cmp < 0 || (cmp == 0 && c.ID <= query.After.ID) {
+				continue
+			}
+		}
+
+		channels = append(channels, c)
+	}
+
+	return channels, nil
+}
+
+// before reports whether channel a comes before channel b in the sort order
+func before(a, b *model.Channel, order model.ChannelSort) bool {
+	cmp := compare(a.SortValue(order.Field), b.SortValue(order.Field))
+	if order.Desc {
+		cmp = -cmp
+	}
+	if cmp != 0 {
+		return cmp < 0
+	}
+	return a.ID < b.ID
+}
+
+// compare compares two sort values of the same field. Numbers may arrive as any
+// numeric type, e.g. float64 from a decoded cursor.
+func compare(a, b any) int {
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
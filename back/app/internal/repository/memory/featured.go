@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
+)
+
+var _ repository.FeaturedRepository = (*Featured)(nil)
+
+type Featured struct {
+	mu     sync.RWMutex
+	slots  []*model.FeaturedEntity
+	nextID int
+}
+
+func NewFeatured(slots ...*model.FeaturedEntity) *Featured {
+	return &Featured{
+		slots: slots,
+	}
+}
+
+func (r *Featured) List() ([]*model.FeaturedEntity, error) {
+	return r.find(func(*model.FeaturedEntity) bool { return true }), nil
+}
+
+func (r *Featured) Active(at time.Time) ([]*model.FeaturedEntity, error) {
+	return r.find(func(f *model.FeaturedEntity) bool { return f.ActiveAt(at) }), nil
+}
+
+func (r *Featured) find(fn func(f *model.FeaturedEntity) bool) []*model.FeaturedEntity {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var slots []*model.FeaturedEntity
+	for _, slot := range r.slots {
+		if slot.Channel != "" && fn(slot) {
+			copied := *slot
+			slots = append(slots, &copied)
+		}
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		if slots[i].Position != slots[j].Position {
+			return slots[i].Position < slots[j].Position
+		}
+		if !slots[i].Created.Equal(slots[j].Created) {
+			return slots[i].Created.After(slots[j].Created)
+		}
+		return slots[i].ID < slots[j].ID
+	})
+
+	return slots
+}
+
+func (r *Featured) FindByID(id string) (*model.FeaturedEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, slot := range r.slots {
+		if slot.ID == id {
+			copied := *slot
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *Featured) Create(featured *model.FeaturedEntity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	featured.ID = fmt.Sprintf("featured%07d", r.nextID)
+	featured.Created = types.NowDateTime()
+	featured.Updated = featured.Created
+
+	copied := *featured
+	r.slots = append(r.slots, &copied)
+	return nil
+}
+
+func (r *Featured) Update(featured *model.FeaturedEntity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, slot := range r.slots {
+		if slot.ID == featured.ID {
+			featured.Updated = types.NowDateTime()
+			copied := *featured
+			r.slots[i] = &copied
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *Featured) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, slot := range r.slots {
+		if slot.ID == id {
+			r.slots = append(r.slots[:i], r.slots[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
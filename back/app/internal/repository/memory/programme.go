@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
+)
+
+var _ repository.ProgrammeRepository = (*Programme)(nil)
+
+type Programme struct {
+	programmes []*model.ProgrammeEntity
+}
+
+func NewProgramme(programmes ...*model.ProgrammeEntity) *Programme {
+	sorted := append([]*model.ProgrammeEntity(nil), programmes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Channel != sorted[j].Channel {
+			return sorted[i].Channel < sorted[j].Channel
+		}
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	return &Programme{
+		programmes: sorted,
+	}
+}
+
+func (r *Programme) NowNext(channels []string, at time.Time) ([]*model.ProgrammeEntity, error) {
+	wanted := make(map[string]int, len(channels))
+	for _, channel := range channels {
+		wanted[channel] = 0
+	}
+
+	var programmes []*model.ProgrammeEntity
+	for _, programme := range r.programmes {
+		count, ok := wanted[programme.Channel]
+		if !ok || count == 2 || !programme.Stop.Time().After(at) {
+			continue
+		}
+		wanted[programme.Channel]++
+		programmes = append(programmes, programme)
+	}
+
+	return programmes, nil
+}
+
+func (r *Programme) Each(channels []string, from, to time.Time, fn func(programme *model.ProgrammeEntity) error) error {
+	wanted := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		wanted[channel] = true
+	}
+
+	for _, programme := range r.programmes {
+		if wanted[programme.Channel] && programme.Stop.Time().After(from) && programme.Start.Time().Before(to) {
+			if err := fn(programme); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *Programme) Find(channel string, from, to time.Time) ([]*model.ProgrammeEntity, error) {
+	var programmes []*model.ProgrammeEntity
+	for _, programme := range r.programmes {
+		if programme.Channel == channel && programme.Stop.Time().After(from) && programme.Start.Time().Before(to) {
+			programmes = append(programmes, programme)
+		}
+	}
+
+	return programmes, nil
+}
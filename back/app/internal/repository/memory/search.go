@@ -0,0 +1,217 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/pkg/utils"
+)
+
+// searchWeights weight the matches per document field, like the SQLite index ranks its columns
+var searchWeights = []float64{10, 5, 2, 2, 1}
+
+var _ repository.SearchRepository = (*Search)(nil)
+
+// Search searches the channels and taxonomy of the other in-memory repositories.
+// It reads them live, so there is no index to maintain.
+type Search struct {
+	channels *Channel
+	taxonomy *Taxonomy
+}
+
+func NewSearch(channels *Channel, taxonomy *Taxonomy) *Search {
+	return &Search{
+		channels: channels,
+		taxonomy: taxonomy,
+	}
+}
+
+func (r *Search) Search(query *model.SearchQuery) (*model.SearchResult, error) {
+	result := &model.SearchResult{Facets: make(map[string]map[string]int)}
+
+	terms := query.Terms()
+	if len(terms) == 0 {
+		return result, nil
+	}
+
+	documents := r.documents()
+
+	ranked := r.match(query, terms, documents, false)
+	if len(ranked) == 0 {
+		ranked = r.match(query, terms, documents, true)
+		result.Fuzzy = len(ranked) > 0
+	}
+
+	result.Total = len(ranked)
+	channels := ranked
+	if query.Offset >= len(channels) {
+		channels = nil
+	} else {
+		channels = channels[query.Offset:]
+	}
+	if query.Limit > 0 && query.Limit < len(channels) {
+		channels = channels[:query.Limit]
+	}
+	result.Channels = channels
+
+	for _, field := range model.SearchFacetFields {
+		result.Facets[field] = make(map[string]int)
+
+		facetQuery := *query
+		switch field {
+		case "category":
+			facetQuery.Category = ""
+		case "country":
+			facetQuery.Country = ""
+		case "language":
+			facetQuery.Language = ""
+		}
+
+		matches := r.match(&facetQuery, terms, documents, result.Fuzzy)
+		for _, channel := range matches {
+			if value := facetValue(channel, field); value != "" {
+				result.Facets[field][value]++
+			}
+		}
+	}
+
+	return result, nil
+}
+
+type searchDocument struct {
+	channel *model.Channel
+	fields  [][]string
+}
+
+// documents builds the words of every active channel per field: title, channel,
+// category, country and language
+func (r *Search) documents() []*searchDocument {
+	categories, _ := r.taxonomy.Categories()
+	countries, _ := r.taxonomy.Countries()
+	languages, _ := r.taxonomy.Languages()
+
+	names := make(map[string]string)
+	for _, category := range categories {
+		names[category.ID] = category.Name1 + " " + category.Name2 + " " + category.Name3
+	}
+	for _, country := range countries {
+		names[country.ID] = country.Name
+	}
+	for _, language := range languages {
+		names[language.ID] = language.Name
+	}
+
+	r.channels.mu.RLock()
+	defer r.channels.mu.RUnlock()
+
+	var documents []*searchDocument
+	for _, channel := range r.channels.channels {
+		if channel.IsRetired {
+			continue
+		}
+
+		documents = append(documents, &searchDocument{
+			channel: channel,
+			fields: [][]string{
+				words(channel.Title),
+				words(channel.Channel),
+				words(names[channel.Category]),
+				words(names[channel.Country]),
+				words(names[channel.Language]),
+			},
+		})
+	}
+
+	return documents
+}
+
+// match ranks the documents containing every term, most relevant first.
+// Fuzzy matches the terms with typos too.
+func (r *Search) match(query *model.SearchQuery, terms []string, documents []*searchDocument, fuzzy bool) []*model.Channel {
+	type scored struct {
+		channel *model.Channel
+		score   float64
+	}
+
+	var matches []scored
+	for _, document := range documents {
+		channel := document.channel
+		if (query.Category != "" && channel.Category != query.Category) ||
+			(query.Country != "" && channel.Country != query.Country) ||
+			(query.Language != "" && channel.Language != query.Language) {
+			continue
+		}
+
+		score := 0.0
+		for _, term := range terms {
+			termScore := 0.0
+			for i, field := range document.fields {
+				for _, word := range field {
+					if strings.HasPrefix(word, term) || (fuzzy && utils.MaxTypos(term) > 0 && utils.EditDistance(term, word) <= utils.MaxTypos(term)) {
+						termScore += searchWeights[i]
+					}
+				}
+			}
+			if termScore == 0 {
+				score = 0
+				break
+			}
+			score += termScore
+		}
+
+		if score > 0 {
+			matches = append(matches, scored{channel: channel, score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		if matches[i].channel.QualityHeight != matches[j].channel.QualityHeight {
+			return matches[i].channel.QualityHeight > matches[j].channel.QualityHeight
+		}
+		return matches[i].channel.ID < matches[j].channel.ID
+	})
+
+	channels := make([]*model.Channel, len(matches))
+	for i, match := range matches {
+		channels[i] = match.channel
+	}
+
+	return channels
+}
+
+func (r *Search) IndexChannels(ids ...string) error {
+	return nil
+}
+
+func (r *Search) RemoveChannels(ids ...string) error {
+	return nil
+}
+
+func (r *Search) IndexRelation(field, id string) error {
+	return nil
+}
+
+// words splits a text into lowercased words like the unicode61 tokenizer does
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func facetValue(channel *model.Channel, field string) string {
+	switch field {
+	case "category":
+		return channel.Category
+	case "country":
+		return channel.Country
+	case "language":
+		return channel.Language
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
+)
+
+var _ repository.StatsRepository = (*Stats)(nil)
+
+// Stats keeps the hourly stats of the channels of a Channel repository,
+// whose popularity it updates
+type Stats struct {
+	mu       sync.RWMutex
+	channels *Channel
+	hourly   map[string]*model.ChannelStatsEntity
+}
+
+func NewStats(channels *Channel) *Stats {
+	return &Stats{
+		channels: channels,
+		hourly:   make(map[string]*model.ChannelStatsEntity),
+	}
+}
+
+func (r *Stats) SaveHourly(stats []*model.ChannelStatsEntity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range stats {
+		copied := *s
+		r.hourly[s.Channel+"|"+s.Hour.String()] = &copied
+	}
+
+	return nil
+}
+
+func (r *Stats) Top(query *model.StatsQuery) ([]*model.ChannelStatsEntity, error) {
+	sums := r.sum(query.Since)
+
+	var stats []*model.ChannelStatsEntity
+	for _, s := range sums {
+		channel, err := r.channels.FindByID(s.Channel)
+		if err != nil || channel.IsRetired ||
+			(query.ChannelID != "" && channel.ID != query.ChannelID) ||
+			(query.Category != "" && channel.Category != query.Category) ||
+			(query.Country != "" && channel.Country != query.Country) ||
+			(query.Language != "" && channel.Language != query.Language) {
+			continue
+		}
+		stats = append(stats, s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].WatchSeconds != stats[j].WatchSeconds {
+			return stats[i].WatchSeconds > stats[j].WatchSeconds
+		}
+		if stats[i].Plays != stats[j].Plays {
+			return stats[i].Plays > stats[j].Plays
+		}
+		return stats[i].Channel < stats[j].Channel
+	})
+
+	if query.Limit > 0 && query.Limit < len(stats) {
+		stats = stats[:query.Limit]
+	}
+
+	return stats, nil
+}
+
+func (r *Stats) UpdatePopularity(since time.Time) (int, error) {
+	sums := r.sum(since)
+
+	r.channels.mu.Lock()
+	defer r.channels.mu.Unlock()
+
+	updated := 0
+	for _, channel := range r.channels.channels {
+		popularity := 0.0
+		if s, ok := sums[channel.ID]; ok {
+			popularity = float64(s.WatchSeconds)
+		}
+		if channel.Popularity != popularity {
+			channel.Popularity = popularity
+			updated++
+		}
+	}
+
+	return updated, nil
+}
+
+// sum sums the hourly stats since a time per channel id
+func (r *Stats) sum(since time.Time) map[string]*model.ChannelStatsEntity {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sums := make(map[string]*model.ChannelStatsEntity)
+	for _, s := range r.hourly {
+		if s.Hour.Time().Before(since) {
+			continue
+		}
+
+		sum, ok := sums[s.Channel]
+		if !ok {
+			sum = &model.ChannelStatsEntity{Channel: s.Channel}
+			sums[s.Channel] = sum
+		}
+		sum.Plays += s.Plays
+		sum.WatchSeconds += s.WatchSeconds
+		sum.PeakViewers = max(sum.PeakViewers, s.PeakViewers)
+	}
+
+	return sums
+}
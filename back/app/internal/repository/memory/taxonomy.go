@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
+)
+
+var _ repository.TaxonomyRepository = (*Taxonomy)(nil)
+
+type Taxonomy struct {
+	mu         sync.RWMutex
+	qualities  []*model.QualityEntity
+	categories []*model.CategoryEntity
+	countries  []*model.CountryEntity
+	languages  []*model.LanguageEntity
+}
+
+func NewTaxonomy() *Taxonomy {
+	return &Taxonomy{}
+}
+
+func (r *Taxonomy) AddQualities(qualities ...*model.QualityEntity) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.qualities = append(r.qualities, qualities...)
+	sort.SliceStable(r.qualities, func(i, j int) bool { return r.qualities[i].Quality < r.qualities[j].Quality })
+}
+
+func (r *Taxonomy) AddCategories(categories ...*model.CategoryEntity) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.categories = append(r.categories, categories...)
+	sort.SliceStable(r.categories, func(i, j int) bool { return r.categories[i].Name1 < r.categories[j].Name1 })
+}
+
+func (r *Taxonomy) AddCountries(countries ...*model.CountryEntity) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.countries = append(r.countries, countries...)
+	sort.SliceStable(r.countries, func(i, j int) bool { return r.countries[i].Name < r.countries[j].Name })
+}
+
+func (r *Taxonomy) AddLanguages(languages ...*model.LanguageEntity) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.languages = append(r.languages, languages...)
+	sort.SliceStable(r.languages, func(i, j int) bool { return r.languages[i].Name < r.languages[j].Name })
+}
+
+func (r *Taxonomy) Qualities() ([]*model.QualityEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]*model.QualityEntity(nil), r.qualities...), nil
+}
+
+func (r *Taxonomy) Categories() ([]*model.CategoryEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]*model.CategoryEntity(nil), r.categories...), nil
+}
+
+func (r *Taxonomy) Countries() ([]*model.CountryEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]*model.CountryEntity(nil), r.countries...), nil
+}
+
+func (r *Taxonomy) Languages() ([]*model.LanguageEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]*model.LanguageEntity(nil), r.languages...), nil
+}
+
+func (r *Taxonomy) CategoryByName(name string) (*model.CategoryEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, category := range r.categories {
+		if category.Name1 == name {
+			return category, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *Taxonomy) CountryByName(name string) (*model.CountryEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, country := range r.countries {
+		if country.Name == name {
+			return country, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *Taxonomy) LanguageByName(name string) (*model.LanguageEntity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, language := range r.languages {
+		if language.Name == name {
+			return language, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// fieldRegex matches the column names a filter may compare
+var fieldRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Filter builds record conditions whose values are bound as SQL parameters.
+//
+// PocketBase filter strings aren't used: their {:param} placeholders are replaced
+// as quoted text before the filter is parsed, and a value ending with a backslash
+// escapes its closing quote, letting the next value rewrite the filter.
+//
+// Field names are part of the code, not of the input; invalid ones panic.
+type Filter struct {
+	conds []dbx.Expression
+}
+
+func NewFilter() *Filter {
+	return &Filter{}
+}
+
+// Eq adds field = value
+func (f *Filter) Eq(field string, value any) *Filter {
+	if !fieldRegex.MatchString(field) {
+		panic(fmt.Sprintf("invalid filter field %q", field))
+	}
+
+	f.conds = append(f.conds, dbx.HashExp{field: value})
+	return f
+}
+
+// Build returns the conditions joined with AND
+func (f *Filter) Build() dbx.Expression {
+	return dbx.And(f.conds...)
+}
+
+// FindFirstRecord returns the first record of a collection matching the filter,
+// sql.ErrNoRows when none does
+func FindFirstRecord(app core.App, collection string, filter *Filter) (*core.Record, error) {
+	record := &core.Record{}
+	if err := app.RecordQuery(collection).AndWhere(filter.Build()).Limit(1).One(record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/testutil"
+)
+
+// maliciousInputs try to close the quoted value and rewrite the rest of the condition
+var maliciousInputs = []string{
+	`' || domain != '`,
+	`" || domain != "`,
+	`x' OR 1=1 --`,
+	`x" || clientId ~ "`,
+	`x\`,
+	` || 1=1 //`,
+	`\' || 1=1 --`,
+	`%`,
+	`~ ''`,
+	`{:p0}`,
+	`) || (domain ~ '`,
+	`примерная-'домен'.рф`,
+	`域名" || "1"="1`,
+	"x\x00' || true || '",
+}
+
+// newCredentialsApp creates an app with an amoCRM credentials collection holding one record
+func newCredentialsApp(t *testing.T) (*tests.TestApp, *core.Collection) {
+	t.Helper()
+
+	collection := core.NewBaseCollection("amoCredentials")
+	collection.Fields.Add(
+		&core.TextField{Name: "domain"},
+		&core.TextField{Name: "clientId"},
+	)
+	app := testutil.NewApp(t, collection)
+	testutil.SaveRecord(t, app, collection, map[string]any{"domain": "example.amocrm.ru", "clientId": "client"})
+
+	return app, collection
+}
+
+func TestFilterBindsValues(t *testing.T) {
+	app, _ := newCredentialsApp(t)
+
+	build := func(value string) *dbx.Query {
+		return app.RecordQuery("amoCredentials").AndWhere(NewFilter().Eq("domain", value).Eq("clientId", value).Build()).Build()
+	}
+	want := build("example.amocrm.ru").SQL()
+
+	for _, input := range maliciousInputs {
+		query := build(input)
+
+		if query.SQL() != want {
+			t.Errorf("%q changed the query to %q, want %q", input, query.SQL(), want)
+		}
+
+		bound := 0
+		for _, value := range query.Params() {
+			if value == input {
+				bound++
+			}
+		}
+		if bound != 2 {
+			t.Errorf("%q is bound %d times in %v, want 2", input, bound, query.Params())
+		}
+	}
+}
+
+func TestFilterInvalidField(t *testing.T) {
+	for _, field := range []string{"", "domain = 'x' || id", "domain ~", "1domain", "category.name_1", "domain'"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Eq(%q) didn't panic", field)
+				}
+			}()
+			NewFilter().Eq(field, "x")
+		}()
+	}
+}
+
+// TestFindFirstRecordMaliciousInputs runs the amoCRM credentials lookup of the auth
+// endpoint: malicious domains and client ids match nothing, and are found as is when stored.
+func TestFindFirstRecordMaliciousInputs(t *testing.T) {
+	app, collection := newCredentialsApp(t)
+
+	for _, domain := range append(maliciousInputs, "example.amocrm.ru") {
+		for _, clientID := range maliciousInputs {
+			for _, args := range [][2]string{{domain, clientID}, {clientID, domain}} {
+				filter := NewFilter().Eq("domain", args[0]).Eq("clientId", args[1])
+				record, err := FindFirstRecord(app, "amoCredentials", filter)
+				if !errors.Is(err, sql.ErrNoRows) {
+					t.Errorf("domain %q clientId %q: got %v %v, want no rows", args[0], args[1], record, err)
+				}
+			}
+		}
+	}
+
+	for _, input := range maliciousInputs {
+		stored := testutil.SaveRecord(t, app, collection, map[string]any{"domain": input, "clientId": input})
+
+		record, err := FindFirstRecord(app, "amoCredentials", NewFilter().Eq("domain", input).Eq("clientId", input))
+		if err != nil {
+			t.Errorf("domain %q: %v", input, err)
+			continue
+		}
+		if record.Id != stored.Id || record.GetString("domain") != input {
+			t.Errorf("domain %q found %s %q, want %s", input, record.Id, record.GetString("domain"), stored.Id)
+		}
+	}
+}
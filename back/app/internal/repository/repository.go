@@ -1,27 +1,145 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/pocketbase/dbx"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository/sqlite"
 )
 
 type AuthorizationI interface {
 }
 
+// ChannelRepository reads the channels and their logos
+type ChannelRepository interface {
+	FindByID(id string) (*model.Channel, error)
+	FindByChannel(channel string) (*model.Channel, error)
+	// FindByIDs returns the channels with the ids in no particular order, missing ids are skipped
+	FindByIDs(ids []string) ([]*model.Channel, error)
+	Find(query *model.ChannelQuery) ([]*model.Channel, error)
+	// Count counts the channels matching the query, ignoring its sort, position and limits
+	Count(query *model.ChannelQuery) (int, error)
+	FindLogos(ids []string) ([]*model.LogoEntity, error)
+}
+
+// TaxonomyRepository reads the collections channels are classified by.
+// The listings are sorted by name.
+type TaxonomyRepository interface {
+	Qualities() ([]*model.QualityEntity, error)
+	Categories() ([]*model.CategoryEntity, error)
+	Countries() ([]*model.CountryEntity, error)
+	Languages() ([]*model.LanguageEntity, error)
+	CategoryByName(name string) (*model.CategoryEntity, error)
+	CountryByName(name string) (*model.CountryEntity, error)
+	LanguageByName(name string) (*model.LanguageEntity, error)
+}
+
+// FeaturedRepository keeps the featured slots. The listings are ordered by position,
+// then most recently featured first.
+type FeaturedRepository interface {
+	List() ([]*model.FeaturedEntity, error)
+	// Active lists the slots whose window contains the time
+	Active(at time.Time) ([]*model.FeaturedEntity, error)
+	FindByID(id string) (*model.FeaturedEntity, error)
+	// Create stores a new slot, filling in its id and timestamps
+	Create(featured *model.FeaturedEntity) error
+	Update(featured *model.FeaturedEntity) error
+	Delete(id string) error
+}
+
+// SearchRepository searches the channels full-text and keeps the search index up to date
+type SearchRepository interface {
+	// Search ranks the active channels matching the query, most relevant first.
+	// When nothing matches as typed, words are matched with typos.
+	Search(query *model.SearchQuery) (*model.SearchResult, error)
+	IndexChannels(ids ...string) error
+	RemoveChannels(ids ...string) error
+	// IndexRelation reindexes the channels whose relation field points to the record,
+	// after the name of the record changed
+	IndexRelation(field, id string) error
+}
+
+// StatsRepository keeps the hourly viewing stats of the channels
+type StatsRepository interface {
+	// SaveHourly stores the stats of an hour, replacing those already kept for the same
+	// channel and hour, so that rolling up an hour again doesn't count it twice
+	SaveHourly(stats []*model.ChannelStatsEntity) error
+	// Top sums the stats per channel of the active channels matching the query, most watched first
+	Top(query *model.StatsQuery) ([]*model.ChannelStatsEntity, error)
+	// UpdatePopularity sets the popularity of every channel to its watch time since a time
+	// and returns how many channels changed
+	UpdatePopularity(since time.Time) (int, error)
+}
+
+// ProgrammeRepository reads the programme guide of the channels, by channel identifier
+type ProgrammeRepository interface {
+	// NowNext lists the first two programmes of each channel not over at the time,
+	// by channel then start
+	NowNext(channels []string, at time.Time) ([]*model.ProgrammeEntity, error)
+	// Find lists the programmes of a channel airing between two times, by start
+	Find(channel string, from, to time.Time) ([]*model.ProgrammeEntity, error)
+	// Each calls fn with the programmes of the channels airing between two times, by channel
+	// then start, reading them one at a time. It stops at the first error of fn.
+	Each(channels []string, from, to time.Time, fn func(programme *model.ProgrammeEntity) error) error
+}
+
 type I interface {
 	Authorization() AuthorizationI
+	Channel() ChannelRepository
+	Taxonomy() TaxonomyRepository
+	Featured() FeaturedRepository
+	Search() SearchRepository
+	Stats() StatsRepository
+	Programme() ProgrammeRepository
 }
 
 type repository struct {
 	AuthorizationI
+	channel   ChannelRepository
+	taxonomy  TaxonomyRepository
+	featured  FeaturedRepository
+	search    SearchRepository
+	stats     StatsRepository
+	programme ProgrammeRepository
 }
 
 func (r *repository) Authorization() AuthorizationI {
 	return r.AuthorizationI
 }
 
+func (r *repository) Channel() ChannelRepository {
+	return r.channel
+}
+
+func (r *repository) Taxonomy() TaxonomyRepository {
+	return r.taxonomy
+}
+
+func (r *repository) Featured() FeaturedRepository {
+	return r.featured
+}
+
+func (r *repository) Search() SearchRepository {
+	return r.search
+}
+
+func (r *repository) Stats() StatsRepository {
+	return r.stats
+}
+
+func (r *repository) Programme() ProgrammeRepository {
+	return r.programme
+}
+
 func NewRepository(db dbx.Builder) I {
 	return &repository{
 		AuthorizationI: sqlite.NewAuthorization(db),
+		channel:        sqlite.NewChannel(db),
+		taxonomy:       sqlite.NewTaxonomy(db),
+		featured:       sqlite.NewFeatured(db),
+		search:         sqlite.NewSearch(db),
+		stats:          sqlite.NewStats(db),
+		programme:      sqlite.NewProgramme(db),
 	}
 }
@@ -0,0 +1,209 @@
+package sqlite
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+// qualityHeight is the height of the quality of a channel, e.g. 1080 for "1080p",
+// as quality labels start with it. Channels without quality are 0.
+const qualityHeight = "coalesce(CAST([[q.quality]] AS INTEGER), 0)"
+
+// channelColumns are the columns of channels c left joined with their quality q
+var channelColumns = []string{
+	"c.id", "c.channel", "c.title", "c.url", "c.logo", "c.quality", "c.category", "c.country", "c.language",
+	"c.user_agent", "c.referrer", "c.is_working", "c.is_retired", "c.uptime", "c.throughput", "c.popularity", "c.created",
+	qualityHeight + " AS quality_height",
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(dbx.DefaultLikeEscape...)
+
+type ChannelPg struct {
+	db dbx.Builder
+}
+
+func NewChannel(db dbx.Builder) *ChannelPg {
+	return &ChannelPg{
+		db: db,
+	}
+}
+
+func (r *ChannelPg) FindByID(id string) (*model.Channel, error) {
+	var channel model.Channel
+	err := r.selectChannels().Where(dbx.HashExp{"c.id": id}).Limit(1).One(&channel)
+	if err != nil {
+		return nil, err
+	}
+
+	return &channel, nil
+}
+
+func (r *ChannelPg) FindByChannel(channel string) (*model.Channel, error) {
+	var result model.Channel
+	err := r.selectChannels().Where(dbx.HashExp{"c.channel": channel}).Limit(1).One(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (r *ChannelPg) FindByIDs(ids []string) ([]*model.Channel, error) {
+	var channels []*model.Channel
+	if len(ids) == 0 {
+		return channels, nil
+	}
+
+	err := r.selectChannels().Where(dbx.In("c.id", values(ids)...)).All(&channels)
+	if err != nil {
+		return nil, err
+	}
+
+	return channels, nil
+}
+
+func (r *ChannelPg) Find(query *model.ChannelQuery) ([]*model.Channel, error) {
+	where, err := channelWhere(query, true)
+	if err != nil {
+		return nil, err
+	}
+
+	q := r.selectChannels().Where(where)
+
+	if query.Sort.Field != "" {
+		direction := "ASC"
+		if query.Sort.Desc {
+			direction = "DESC"
+		}
+		q.OrderBy(sortExpression(query.Sort.Field)+" "+direction, "c.id ASC")
+	}
+	if query.Limit > 0 {
+		q.Limit(int64(query.Limit))
+	}
+	if query.Offset > 0 {
+		q.Offset(int64(query.Offset))
+	}
+
+	var channels []*model.Channel
+	if err := q.All(&channels); err != nil {
+		return nil, err
+	}
+
+	return channels, nil
+}
+
+func (r *ChannelPg) Count(query *model.ChannelQuery) (int, error) {
+	where, err := channelWhere(query, false)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	if err := r.db.Select("COUNT(*)").From("channels c").Where(where).Row(&total); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// selectChannels selects channels with the height of their quality
+func (r *ChannelPg) selectChannels() *dbx.SelectQuery {
+	return r.db.Select(channelColumns...).From("channels c").LeftJoin("qualities q", dbx.NewExp("q.id = c.quality"))
+}
+
+func (r *ChannelPg) FindLogos(ids []string) ([]*model.LogoEntity, error) {
+	var logos []*model.LogoEntity
+	if len(ids) == 0 {
+		return logos, nil
+	}
+
+	err := r.db.Select("id", "logo_url", "width", "height").From("logos").Where(dbx.In("id", values(ids)...)).All(&logos)
+	if err != nil {
+		return nil, err
+	}
+
+	return logos, nil
+}
+
+// channelWhere builds the condition of a channel query, with or without its After position
+func channelWhere(query *model.ChannelQuery, withPosition bool) (dbx.Expression, error) {
+	exps := []dbx.Expression{dbx.HashExp{"c.is_retired": false}}
+
+	if query.Category != "" {
+		exps = append(exps, dbx.HashExp{"c.category": query.Category})
+	}
+	if query.Country != "" {
+		exps = append(exps, dbx.HashExp{"c.country": query.Country})
+	}
+	if query.Language != "" {
+		exps = append(exps, dbx.HashExp{"c.language": query.Language})
+	}
+	if len(query.ExcludeIDs) > 0 {
+		exps = append(exps, dbx.NotIn("c.id", values(query.ExcludeIDs)...))
+	}
+	if query.ExcludeChannel != "" {
+		exps = append(exps, dbx.NewExp("[[c.channel]] != {:exclude_channel}", dbx.Params{"exclude_channel": query.ExcludeChannel}))
+	}
+	if query.OnlyWorking {
+		exps = append(exps, dbx.HashExp{"c.is_working": true})
+	}
+	if len(query.Channels) > 0 {
+		exps = append(exps, dbx.In("c.channel", values(query.Channels)...))
+	}
+	if query.Search != "" {
+		// The wildcards of the search are escaped with backslashes, which SQLite only honors with an ESCAPE clause
+		params := dbx.Params{"search": "%" + likeEscaper.Replace(query.Search) + "%"}
+		exps = append(exps, dbx.Or(
+			dbx.NewExp(`[[c.title]] LIKE {:search} ESCAPE '\'`, params),
+			dbx.NewExp(`[[c.id]] LIKE {:search} ESCAPE '\'`, params),
+		))
+	}
+
+	if query.Sort.Field != "" && !slices.Contains(model.ChannelSortFields, query.Sort.Field) {
+		return nil, fmt.Errorf("invalid channel sort field %q", query.Sort.Field)
+	}
+
+	if withPosition && query.After != nil {
+		if query.Sort.Field == "" {
+			return nil, fmt.Errorf("channel position requires a sort")
+		}
+
+		op := ">"
+		if query.Sort.Desc {
+			op = "<"
+		}
+		field := sortExpression(query.Sort.Field)
+
+		exps = append(exps, dbx.Or(
+			dbx.NewExp(fmt.Sprintf("%s %s {:after_value}", field, op), dbx.Params{"after_value": query.After.Value}),
+			dbx.And(
+				dbx.NewExp(field+" = {:after_value}", dbx.Params{"after_value": query.After.Value}),
+				dbx.NewExp("[[c.id]] > {:after_id}", dbx.Params{"after_id": query.After.ID}),
+			),
+		))
+	}
+
+	return dbx.And(exps...), nil
+}
+
+// sortExpression is the expression channels c are sorted by for a sort field. Quality
+// is a relation, channels are sorted by its height rather than by the id of the record.
+func sortExpression(field string) string {
+	if field == "quality" {
+		return qualityHeight
+	}
+	return "[[c." + field + "]]"
+}
+
+func values(ids []string) []any {
+	result := make([]any, len(ids))
+	for i, id := range ids {
+		result[i] = id
+	}
+	return result
+}
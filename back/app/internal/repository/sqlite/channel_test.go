@@ -0,0 +1,68 @@
+package sqlite
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/testutil"
+)
+
+// TestFindSortsByQualityHeight sorts channels whose quality ids are in the opposite order
+// of their heights, and a channel without quality, which comes last
+func TestFindSortsByQualityHeight(t *testing.T) {
+	db := testutil.NewDB(t)
+	testutil.Insert(t, db, "qualities", dbx.Params{"id": "qa", "quality": "480p"})
+	testutil.Insert(t, db, "qualities", dbx.Params{"id": "qb", "quality": "720p"})
+	testutil.Insert(t, db, "qualities", dbx.Params{"id": "qc", "quality": "1080p"})
+	for _, channel := range []dbx.Params{
+		{"id": "ch1", "quality": "qa"},
+		{"id": "ch2", "quality": "qc"},
+		{"id": "ch3", "quality": ""},
+		{"id": "ch4", "quality": "qb"},
+		{"id": "ch5", "quality": "qc"},
+	} {
+		testutil.Insert(t, db, "channels", channel)
+	}
+
+	repo := NewChannel(db)
+	sort := model.ChannelSort{Field: "quality", Desc: true}
+	want := []string{"ch2", "ch5", "ch4", "ch1", "ch3"}
+
+	channels, err := repo.Find(&model.ChannelQuery{Sort: sort})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, channel := range channels {
+		ids = append(ids, channel.ID)
+	}
+	if !slices.Equal(ids, want) {
+		t.Errorf("sorted by quality = %v, want %v", ids, want)
+	}
+	if channels[0].QualityHeight != 1080 || channels[4].QualityHeight != 0 {
+		t.Errorf("heights = %d, %d, want 1080 and 0", channels[0].QualityHeight, channels[4].QualityHeight)
+	}
+
+	// Walking the order two channels at a time from the position of the last one
+	var walked []string
+	query := &model.ChannelQuery{Sort: sort, Limit: 2}
+	for range len(want) {
+		page, err := repo.Find(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, channel := range page {
+			walked = append(walked, channel.ID)
+		}
+		last := page[len(page)-1]
+		query = &model.ChannelQuery{Sort: sort, Limit: 2, After: &model.ChannelKey{Value: last.SortValue("quality"), ID: last.ID}}
+	}
+	if !slices.Equal(walked, want) {
+		t.Errorf("walked by position = %v, want %v", walked, want)
+	}
+}
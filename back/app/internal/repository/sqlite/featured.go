@@ -0,0 +1,109 @@
+package sqlite
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+var featuredColumns = []string{"id", "channel", "position", "starts_at", "ends_at", "countries", "created", "updated"}
+
+type FeaturedPg struct {
+	db dbx.Builder
+}
+
+func NewFeatured(db dbx.Builder) *FeaturedPg {
+	return &FeaturedPg{
+		db: db,
+	}
+}
+
+func (r *FeaturedPg) List() ([]*model.FeaturedEntity, error) {
+	return r.find(dbx.NewExp("[[channel]] != ''"))
+}
+
+func (r *FeaturedPg) Active(at time.Time) ([]*model.FeaturedEntity, error) {
+	now := statsTime(at)
+
+	return r.find(dbx.And(
+		dbx.NewExp("[[channel]] != ''"),
+		dbx.NewExp("([[starts_at]] = '' OR [[starts_at]] <= {:now})", dbx.Params{"now": now}),
+		dbx.NewExp("([[ends_at]] = '' OR [[ends_at]] > {:now})", dbx.Params{"now": now}),
+	))
+}
+
+func (r *FeaturedPg) find(where dbx.Expression) ([]*model.FeaturedEntity, error) {
+	var featured []*model.FeaturedEntity
+	err := r.db.Select(featuredColumns...).From("featured").Where(where).OrderBy("position ASC", "created DESC", "id ASC").All(&featured)
+	if err != nil {
+		return nil, err
+	}
+
+	return featured, nil
+}
+
+func (r *FeaturedPg) FindByID(id string) (*model.FeaturedEntity, error) {
+	var featured model.FeaturedEntity
+	err := r.db.Select(featuredColumns...).From("featured").Where(dbx.HashExp{"id": id}).Limit(1).One(&featured)
+	if err != nil {
+		return nil, err
+	}
+
+	return &featured, nil
+}
+
+func (r *FeaturedPg) Create(featured *model.FeaturedEntity) error {
+	featured.ID = security.RandomStringWithAlphabet(15, recordIDAlphabet)
+	featured.Created = types.NowDateTime()
+	featured.Updated = featured.Created
+
+	_, err := r.db.Insert("featured", featuredParams(featured)).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to create featured slot: %w", err)
+	}
+	return nil
+}
+
+func (r *FeaturedPg) Update(featured *model.FeaturedEntity) error {
+	featured.Updated = types.NowDateTime()
+
+	params := featuredParams(featured)
+	delete(params, "id")
+	delete(params, "created")
+
+	_, err := r.db.Update("featured", params, dbx.HashExp{"id": featured.ID}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to update featured slot %s: %w", featured.ID, err)
+	}
+	return nil
+}
+
+func (r *FeaturedPg) Delete(id string) error {
+	_, err := r.db.Delete("featured", dbx.HashExp{"id": id}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to delete featured slot %s: %w", id, err)
+	}
+	return nil
+}
+
+func featuredParams(featured *model.FeaturedEntity) dbx.Params {
+	countries := featured.Countries
+	if countries == nil {
+		countries = types.JSONArray[string]{}
+	}
+
+	return dbx.Params{
+		"id":        featured.ID,
+		"channel":   featured.Channel,
+		"position":  featured.Position,
+		"starts_at": featured.StartsAt.String(),
+		"ends_at":   featured.EndsAt.String(),
+		"countries": countries,
+		"created":   featured.Created.String(),
+		"updated":   featured.Updated.String(),
+	}
+}
@@ -0,0 +1,168 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/testutil"
+)
+
+// maliciousInputs try to close a quoted value and rewrite the rest of the condition
+var maliciousInputs = []string{
+	`' OR '1'='1`,
+	`" OR "1"="1`,
+	`x' OR 1=1 --`,
+	`ch1' || '`,
+	`x\`,
+	` || 1=1 //`,
+	`%`,
+	`_`,
+	`~ ''`,
+	`{:id}`,
+	`') OR ('a' ~ 'a`,
+	`*`,
+	`"france"* OR "bbc"*`,
+	`NEAR(france bbc)`,
+	`примерная-'страна'`,
+	`新闻" OR "1"="1`,
+	"x\x00' OR 1=1 --",
+}
+
+// newCatalogDB opens a database with two indexed channels of the same category,
+// country and language
+func newCatalogDB(t *testing.T) *dbx.DB {
+	t.Helper()
+
+	db := testutil.NewDB(t)
+	testutil.Insert(t, db, "categories", dbx.Params{"id": "cat1", "name_1": "News"})
+	testutil.Insert(t, db, "countries", dbx.Params{"id": "co1", "name": "France"})
+	testutil.Insert(t, db, "languages", dbx.Params{"id": "la1", "name": "French"})
+	for _, channel := range []dbx.Params{
+		{"id": "ch1", "channel": "France24.fr", "title": "France 24"},
+		{"id": "ch2", "channel": "BBCOne.uk", "title": "BBC One"},
+	} {
+		channel["category"], channel["country"], channel["language"] = "cat1", "co1", "la1"
+		testutil.Insert(t, db, "channels", channel)
+	}
+	if err := NewSearch(db).IndexChannels("ch1", "ch2"); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// TestMaliciousInputs feeds malicious inputs to every lookup an endpoint passes
+// user input to: none of them matches anything or fails
+func TestMaliciousInputs(t *testing.T) {
+	db := newCatalogDB(t)
+	channels := NewChannel(db)
+	taxonomy := NewTaxonomy(db)
+	search := NewSearch(db)
+
+	lookups := map[string]func(input string) error{
+		"FindByID": func(input string) error {
+			_, err := channels.FindByID(input)
+			return err
+		},
+		"FindByChannel": func(input string) error {
+			_, err := channels.FindByChannel(input)
+			return err
+		},
+		"CategoryByName": func(input string) error {
+			_, err := taxonomy.CategoryByName(input)
+			return err
+		},
+		"CountryByName": func(input string) error {
+			_, err := taxonomy.CountryByName(input)
+			return err
+		},
+		"LanguageByName": func(input string) error {
+			_, err := taxonomy.LanguageByName(input)
+			return err
+		},
+	}
+
+	queries := map[string]func(input string) *model.ChannelQuery{
+		"Category": func(input string) *model.ChannelQuery { return &model.ChannelQuery{Category: input} },
+		"Country":  func(input string) *model.ChannelQuery { return &model.ChannelQuery{Country: input} },
+		"Language": func(input string) *model.ChannelQuery { return &model.ChannelQuery{Language: input} },
+		"Channels": func(input string) *model.ChannelQuery { return &model.ChannelQuery{Channels: []string{input}} },
+		"Search":   func(input string) *model.ChannelQuery { return &model.ChannelQuery{Search: input} },
+	}
+
+	searches := map[string]func(input string) *model.SearchQuery{
+		"Text":     func(input string) *model.SearchQuery { return &model.SearchQuery{Text: input} },
+		"Category": func(input string) *model.SearchQuery { return &model.SearchQuery{Text: "france", Category: input} },
+		"Country":  func(input string) *model.SearchQuery { return &model.SearchQuery{Text: "france", Country: input} },
+		"Language": func(input string) *model.SearchQuery { return &model.SearchQuery{Text: "france", Language: input} },
+	}
+
+	for _, input := range maliciousInputs {
+		for name, lookup := range lookups {
+			if err := lookup(input); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("%s(%q) = %v, want no rows", name, input, err)
+			}
+		}
+
+		for name, query := range queries {
+			found, err := channels.Find(query(input))
+			if err != nil || len(found) != 0 {
+				t.Errorf("Find with %s %q = %d channels, %v, want none", name, input, len(found), err)
+			}
+			total, err := channels.Count(query(input))
+			if err != nil || total != 0 {
+				t.Errorf("Count with %s %q = %d, %v, want 0", name, input, total, err)
+			}
+		}
+
+		// Excluding a channel by a malicious identifier excludes nothing
+		found, err := channels.Find(&model.ChannelQuery{ExcludeChannel: input, ExcludeIDs: []string{input}})
+		if err != nil || len(found) != 2 {
+			t.Errorf("Find excluding %q = %d channels, %v, want 2", input, len(found), err)
+		}
+
+		for name, query := range searches {
+			result, err := search.Search(query(input))
+			if err != nil || result.Total != 0 || len(result.Channels) != 0 {
+				t.Errorf("Search with %s %q = %+v, %v, want no results", name, input, result, err)
+			}
+		}
+	}
+}
+
+// TestMaliciousInputsStored checks that malicious values are found as stored
+func TestMaliciousInputsStored(t *testing.T) {
+	db := newCatalogDB(t)
+	channels := NewChannel(db)
+	taxonomy := NewTaxonomy(db)
+
+	for i, input := range maliciousInputs {
+		id := fmt.Sprintf("evil%d", i)
+		testutil.Insert(t, db, "channels", dbx.Params{"id": id, "channel": input, "title": input, "country": id})
+		testutil.Insert(t, db, "countries", dbx.Params{"id": id, "name": input})
+
+		channel, err := channels.FindByChannel(input)
+		if err != nil || channel.ID != id {
+			t.Errorf("FindByChannel(%q) = %v, %v, want %s", input, channel, err, id)
+		}
+
+		country, err := taxonomy.CountryByName(input)
+		if err != nil || country.ID != id {
+			t.Errorf("CountryByName(%q) = %v, %v, want %s", input, country, err, id)
+		}
+
+		found, err := channels.Find(&model.ChannelQuery{Search: input})
+		if err != nil || len(found) == 0 {
+			t.Errorf("Find searching %q = %d channels, %v, want at least 1", input, len(found), err)
+		}
+		for _, channel := range found {
+			if channel.ID == "ch1" || channel.ID == "ch2" {
+				t.Errorf("Find searching %q matched %s", input, channel.ID)
+			}
+		}
+	}
+}
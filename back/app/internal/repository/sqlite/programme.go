@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+var programmeColumns = []string{"id", "channel", "start", "stop", "title", "sub_title", "description", "category", "icon"}
+
+type ProgrammePg struct {
+	db dbx.Builder
+}
+
+func NewProgramme(db dbx.Builder) *ProgrammePg {
+	return &ProgrammePg{
+		db: db,
+	}
+}
+
+func (r *ProgrammePg) NowNext(channels []string, at time.Time) ([]*model.ProgrammeEntity, error) {
+	if len(channels) == 0 {
+		return nil, nil
+	}
+
+	params := dbx.Params{"at": statsTime(at)}
+	placeholders := make([]string, len(channels))
+	for i, channel := range channels {
+		name := fmt.Sprintf("c%d", i)
+		params[name] = channel
+		placeholders[i] = "{:" + name + "}"
+	}
+
+	columns := strings.Join(programmeColumns, ", ")
+
+	var programmes []*model.ProgrammeEntity
+	err := r.db.NewQuery(fmt.Sprintf(`SELECT %s FROM (
+			SELECT %s, ROW_NUMBER() OVER (PARTITION BY channel ORDER BY start) AS nth
+			FROM programmes
+			WHERE channel IN (%s) AND stop > {:at}
+		)
+		WHERE nth <= 2
+		ORDER BY channel, start`, columns, columns, strings.Join(placeholders, ", "))).
+		Bind(params).
+		All(&programmes)
+	if err != nil {
+		return nil, err
+	}
+
+	return programmes, nil
+}
+
+func (r *ProgrammePg) Find(channel string, from, to time.Time) ([]*model.ProgrammeEntity, error) {
+	var programmes []*model.ProgrammeEntity
+	err := r.db.Select(programmeColumns...).
+		From("programmes").
+		Where(dbx.And(
+			dbx.HashExp{"channel": channel},
+			dbx.NewExp("[[stop]] > {:from} AND [[start]] < {:to}", dbx.Params{"from": statsTime(from), "to": statsTime(to)}),
+		)).
+		OrderBy("start ASC").
+		All(&programmes)
+	if err != nil {
+		return nil, err
+	}
+
+	return programmes, nil
+}
+
+func (r *ProgrammePg) Each(channels []string, from, to time.Time, fn func(programme *model.ProgrammeEntity) error) error {
+	if len(channels) == 0 {
+		return nil
+	}
+
+	rows, err := r.db.Select(programmeColumns...).
+		From("programmes").
+		Where(dbx.And(
+			dbx.In("channel", values(channels)...),
+			dbx.NewExp("[[stop]] > {:from} AND [[start]] < {:to}", dbx.Params{"from": statsTime(from), "to": statsTime(to)}),
+		)).
+		OrderBy("channel ASC", "start ASC").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var programme model.ProgrammeEntity
+		if err := rows.ScanStruct(&programme); err != nil {
+			return err
+		}
+		if err := fn(&programme); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,284 @@
+package sqlite
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pocketbase/dbx"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/pkg/utils"
+)
+
+const (
+	// searchRank ranks matches with BM25, weighting the columns of channels_fts:
+	// id, title, channel, category, country, language
+	searchRank = "bm25(channels_fts, 0, 10.0, 5.0, 2.0, 2.0, 1.0)"
+
+	// searchDocument selects the channels_fts columns of the channels
+	searchDocument = `SELECT
+		c.id,
+		c.title,
+		c.channel,
+		trim(coalesce(cat.name_1, '') || ' ' || coalesce(cat.name_2, '') || ' ' || coalesce(cat.name_3, '')),
+		coalesce(co.name, ''),
+		coalesce(l.name, '')
+	FROM channels c
+	LEFT JOIN categories cat ON cat.id = c.category
+	LEFT JOIN countries co ON co.id = c.country
+	LEFT JOIN languages l ON l.id = c.language`
+
+	// maxFuzzyTerms bounds the similar words a search word is expanded to
+	maxFuzzyTerms = 10
+
+	// maxFuzzyCandidates bounds the indexed words a search word is compared to,
+	// the words of a similar length in the most channels
+	maxFuzzyCandidates = 1000
+)
+
+type SearchPg struct {
+	db dbx.Builder
+}
+
+func NewSearch(db dbx.Builder) *SearchPg {
+	return &SearchPg{
+		db: db,
+	}
+}
+
+func (r *SearchPg) Search(query *model.SearchQuery) (*model.SearchResult, error) {
+	terms := query.Terms()
+	if len(terms) == 0 {
+		return &model.SearchResult{Facets: map[string]map[string]int{}}, nil
+	}
+
+	result, err := r.search(query, prefixMatch(terms))
+	if err != nil || result.Total > 0 {
+		return result, err
+	}
+
+	// Nothing matched as typed, retry with the indexed words similar to the query words
+	match, err := r.fuzzyMatch(terms)
+	if err != nil || match == "" {
+		return result, err
+	}
+
+	result, err = r.search(query, match)
+	if err != nil {
+		return nil, err
+	}
+	result.Fuzzy = result.Total > 0
+
+	return result, nil
+}
+
+func (r *SearchPg) search(query *model.SearchQuery, match string) (*model.SearchResult, error) {
+	where, params := searchWhere(query, match, "")
+
+	result := &model.SearchResult{Facets: make(map[string]map[string]int)}
+
+	err := r.db.NewQuery("SELECT COUNT(*) FROM channels_fts JOIN channels c ON c.id = channels_fts.id WHERE " + where).
+		Bind(params).
+		Row(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	params["limit"] = limit
+	params["offset"] = query.Offset
+
+	err = r.db.NewQuery(fmt.Sprintf(
+		"SELECT %s FROM channels_fts JOIN channels c ON c.id = channels_fts.id LEFT JOIN qualities q ON q.id = c.quality "+
+			"WHERE %s ORDER BY %s, %s DESC, c.id LIMIT {:limit} OFFSET {:offset}",
+		strings.Join(channelColumns, ", "), where, searchRank, qualityHeight,
+	)).Bind(params).All(&result.Channels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search channels: %w", err)
+	}
+
+	for _, field := range model.SearchFacetFields {
+		where, params := searchWhere(query, match, field)
+
+		var counts []struct {
+			Value string `db:"value"`
+			Count int    `db:"count"`
+		}
+		err := r.db.NewQuery(fmt.Sprintf(
+			"SELECT c.%s AS value, COUNT(*) AS count FROM channels_fts JOIN channels c ON c.id = channels_fts.id WHERE %s GROUP BY c.%s",
+			field, where, field,
+		)).Bind(params).All(&counts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count %s facet: %w", field, err)
+		}
+
+		result.Facets[field] = make(map[string]int, len(counts))
+		for _, count := range counts {
+			if count.Value != "" {
+				result.Facets[field][count.Value] = count.Count
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// searchWhere builds the condition of a search, leaving out the filter of one facet field
+func searchWhere(query *model.SearchQuery, match, except string) (string, dbx.Params) {
+	conds := []string{"channels_fts MATCH {:match}", "c.is_retired = FALSE"}
+	params := dbx.Params{"match": match}
+
+	for _, field := range model.SearchFacetFields {
+		if id := query.Filter(field); id != "" && field != except {
+			conds = append(conds, fmt.Sprintf("c.%s = {:%s}", field, field))
+			params[field] = id
+		}
+	}
+
+	return strings.Join(conds, " AND "), params
+}
+
+// prefixMatch builds the FTS5 query matching every term as a word prefix.
+// Terms hold only letters and digits, so quoting them is enough.
+func prefixMatch(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = `"` + term + `"*`
+	}
+	return strings.Join(parts, " ")
+}
+
+// fuzzyMatch builds the FTS5 query matching every term as a word prefix or as
+// one of the indexed words within its typo distance. It returns an empty query
+// when no term has similar words.
+func (r *SearchPg) fuzzyMatch(terms []string) (string, error) {
+	expanded := false
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		candidates, err := r.fuzzyCandidates(term)
+		if err != nil {
+			return "", err
+		}
+
+		options := []string{`"` + term + `"*`}
+		for _, word := range similarWords(term, candidates) {
+			options = append(options, `"`+word+`"`)
+			expanded = true
+		}
+		parts[i] = "(" + strings.Join(options, " OR ") + ")"
+	}
+
+	if !expanded {
+		return "", nil
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// fuzzyCandidates reads the indexed words whose length is within the typo distance
+// of a term, the only ones that can be similar to it, most common first
+func (r *SearchPg) fuzzyCandidates(term string) ([]string, error) {
+	typos := utils.MaxTypos(term)
+	if typos == 0 {
+		return nil, nil
+	}
+
+	length := utf8.RuneCountInString(term)
+
+	var candidates []string
+	err := r.db.NewQuery(`SELECT term FROM channels_fts_vocab
+		WHERE length(term) BETWEEN {:min} AND {:max} AND term != {:term}
+		ORDER BY doc DESC
+		LIMIT {:limit}`).
+		Bind(dbx.Params{"min": length - typos, "max": length + typos, "term": term, "limit": maxFuzzyCandidates}).
+		Column(&candidates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read search vocabulary: %w", err)
+	}
+
+	return candidates, nil
+}
+
+// similarWords returns the words of the vocabulary within the typo distance of a term,
+// in vocabulary order
+func similarWords(term string, vocabulary []string) []string {
+	typos := utils.MaxTypos(term)
+	if typos == 0 {
+		return nil
+	}
+
+	var words []string
+	for _, word := range vocabulary {
+		if word == term || abs(utf8.RuneCountInString(word)-utf8.RuneCountInString(term)) > typos {
+			continue
+		}
+		if utils.EditDistance(term, word) <= typos && !slices.Contains(words, word) {
+			words = append(words, word)
+			if len(words) == maxFuzzyTerms {
+				break
+			}
+		}
+	}
+
+	return words
+}
+
+func (r *SearchPg) IndexChannels(ids ...string) error {
+	for _, id := range ids {
+		if err := r.removeChannel(id); err != nil {
+			return err
+		}
+
+		_, err := r.db.NewQuery("INSERT INTO channels_fts (id, title, channel, category, country, language) " + searchDocument + " WHERE c.id = {:id}").
+			Bind(dbx.Params{"id": id}).
+			Execute()
+		if err != nil {
+			return fmt.Errorf("failed to index channel %s: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *SearchPg) RemoveChannels(ids ...string) error {
+	for _, id := range ids {
+		if err := r.removeChannel(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *SearchPg) removeChannel(id string) error {
+	_, err := r.db.NewQuery("DELETE FROM channels_fts WHERE id = {:id}").Bind(dbx.Params{"id": id}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to remove channel %s from the search index: %w", id, err)
+	}
+	return nil
+}
+
+func (r *SearchPg) IndexRelation(field, id string) error {
+	if !slices.Contains(model.SearchFacetFields, field) {
+		return fmt.Errorf("invalid search relation %q", field)
+	}
+
+	var ids []string
+	err := r.db.Select("id").From("channels").Where(dbx.HashExp{field: id}).Column(&ids)
+	if err != nil {
+		return err
+	}
+
+	return r.IndexChannels(ids...)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,41 @@
+package sqlite
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/pocketbase/dbx"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/testutil"
+)
+
+func TestFuzzySearch(t *testing.T) {
+	db := newCatalogDB(t)
+	testutil.Insert(t, db, "channels", dbx.Params{"id": "ch3", "channel": "Francophonie.fr", "title": "Francophonie Internationale"})
+	search := NewSearch(db)
+	if err := search.IndexChannels("ch3"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the words of a length within a typo of "frnce" are compared to it
+	candidates, err := search.fuzzyCandidates("frnce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) == 0 {
+		t.Fatal("no candidates for frnce")
+	}
+	for _, word := range candidates {
+		if n := utf8.RuneCountInString(word); n < 4 || n > 6 {
+			t.Errorf("candidate %q of frnce is %d letters long", word, n)
+		}
+	}
+
+	result, err := search.Search(&model.SearchQuery{Text: "frnce"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Fuzzy || result.Total != 2 {
+		t.Errorf("got %d fuzzy %t, want the 2 channels of France, not Francophonie", result.Total, result.Fuzzy)
+	}
+}
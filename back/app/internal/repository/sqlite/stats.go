@@ -0,0 +1,123 @@
+package sqlite
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+// recordIDAlphabet is the alphabet of PocketBase record ids
+const recordIDAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+type StatsPg struct {
+	db dbx.Builder
+}
+
+func NewStats(db dbx.Builder) *StatsPg {
+	return &StatsPg{
+		db: db,
+	}
+}
+
+func (r *StatsPg) SaveHourly(stats []*model.ChannelStatsEntity) error {
+	now := types.NowDateTime().String()
+
+	for _, s := range stats {
+		_, err := r.db.NewQuery(`INSERT INTO channel_stats (id, channel, hour, plays, watch_seconds, peak_viewers, created, updated)
+			VALUES ({:id}, {:channel}, {:hour}, {:plays}, {:watch_seconds}, {:peak_viewers}, {:now}, {:now})
+			ON CONFLICT (channel, hour) DO UPDATE SET
+				plays = excluded.plays,
+				watch_seconds = excluded.watch_seconds,
+				peak_viewers = excluded.peak_viewers,
+				updated = excluded.updated`).
+			Bind(dbx.Params{
+				"id":            security.RandomStringWithAlphabet(15, recordIDAlphabet),
+				"channel":       s.Channel,
+				"hour":          s.Hour.String(),
+				"plays":         s.Plays,
+				"watch_seconds": s.WatchSeconds,
+				"peak_viewers":  s.PeakViewers,
+				"now":           now,
+			}).
+			Execute()
+		if err != nil {
+			return fmt.Errorf("failed to save stats of channel %s: %w", s.Channel, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *StatsPg) Top(query *model.StatsQuery) ([]*model.ChannelStatsEntity, error) {
+	exps := []dbx.Expression{
+		dbx.NewExp("s.hour >= {:since}", dbx.Params{"since": statsTime(query.Since)}),
+		dbx.HashExp{"c.is_retired": false},
+	}
+	if query.ChannelID != "" {
+		exps = append(exps, dbx.HashExp{"s.channel": query.ChannelID})
+	}
+	if query.Category != "" {
+		exps = append(exps, dbx.HashExp{"c.category": query.Category})
+	}
+	if query.Country != "" {
+		exps = append(exps, dbx.HashExp{"c.country": query.Country})
+	}
+	if query.Language != "" {
+		exps = append(exps, dbx.HashExp{"c.language": query.Language})
+	}
+
+	q := r.db.Select(
+		"s.channel AS channel",
+		"SUM(s.plays) AS plays",
+		"SUM(s.watch_seconds) AS watch_seconds",
+		"MAX(s.peak_viewers) AS peak_viewers",
+	).
+		From("channel_stats s").
+		InnerJoin("channels c", dbx.NewExp("c.id = s.channel")).
+		Where(dbx.And(exps...)).
+		GroupBy("s.channel").
+		OrderBy("watch_seconds DESC", "plays DESC", "s.channel ASC")
+	if query.Limit > 0 {
+		q.Limit(int64(query.Limit))
+	}
+
+	var stats []*model.ChannelStatsEntity
+	if err := q.All(&stats); err != nil {
+		return nil, fmt.Errorf("failed to sum channel stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (r *StatsPg) UpdatePopularity(since time.Time) (int, error) {
+	result, err := r.db.NewQuery(`UPDATE channels SET popularity = p.watch_seconds
+		FROM (
+			SELECT c.id, coalesce(SUM(s.watch_seconds), 0) AS watch_seconds
+			FROM channels c
+			LEFT JOIN channel_stats s ON s.channel = c.id AND s.hour >= {:since}
+			GROUP BY c.id
+		) AS p
+		WHERE p.id = channels.id AND channels.popularity IS NOT p.watch_seconds`).
+		Bind(dbx.Params{"since": statsTime(since)}).
+		Execute()
+	if err != nil {
+		return 0, fmt.Errorf("failed to update channel popularity: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(updated), nil
+}
+
+// statsTime formats a time like PocketBase stores dates, so they compare as text
+func statsTime(t time.Time) string {
+	dt, _ := types.ParseDateTime(t)
+	return dt.String()
+}
@@ -0,0 +1,35 @@
+package sqlite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/testutil"
+)
+
+func TestSaveHourlyReplaces(t *testing.T) {
+	db := testutil.NewDB(t)
+	testutil.Insert(t, db, "channels", dbx.Params{"id": "ch1", "channel": "France24.fr"})
+
+	hour, _ := types.ParseDateTime(time.Now().UTC().Truncate(time.Hour).Add(-time.Hour))
+	stats := []*model.ChannelStatsEntity{{Channel: "ch1", Hour: hour, Plays: 2, WatchSeconds: 600, PeakViewers: 2}}
+
+	repo := NewStats(db)
+	// The same hour saved twice, as when a rollup is retried, is kept once
+	for range 2 {
+		if err := repo.SaveHourly(stats); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	top, err := repo.Top(&model.StatsQuery{Since: hour.Time()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 1 || top[0].Plays != 2 || top[0].WatchSeconds != 600 || top[0].PeakViewers != 2 {
+		t.Errorf("top = %+v, want ch1 with 2 plays, 600 seconds, 2 viewers", top)
+	}
+}
@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"github.com/pocketbase/dbx"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+type TaxonomyPg struct {
+	db dbx.Builder
+}
+
+func NewTaxonomy(db dbx.Builder) *TaxonomyPg {
+	return &TaxonomyPg{
+		db: db,
+	}
+}
+
+func (r *TaxonomyPg) Qualities() ([]*model.QualityEntity, error) {
+	var qualities []*model.QualityEntity
+	if err := r.db.Select("id", "quality").From("qualities").OrderBy("quality ASC").All(&qualities); err != nil {
+		return nil, err
+	}
+
+	return qualities, nil
+}
+
+func (r *TaxonomyPg) Categories() ([]*model.CategoryEntity, error) {
+	var categories []*model.CategoryEntity
+	if err := r.categories().OrderBy("name_1 ASC").All(&categories); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+func (r *TaxonomyPg) Countries() ([]*model.CountryEntity, error) {
+	var countries []*model.CountryEntity
+	if err := r.db.Select("id", "name").From("countries").OrderBy("name ASC").All(&countries); err != nil {
+		return nil, err
+	}
+
+	return countries, nil
+}
+
+func (r *TaxonomyPg) Languages() ([]*model.LanguageEntity, error) {
+	var languages []*model.LanguageEntity
+	if err := r.db.Select("id", "name").From("languages").OrderBy("name ASC").All(&languages); err != nil {
+		return nil, err
+	}
+
+	return languages, nil
+}
+
+func (r *TaxonomyPg) CategoryByName(name string) (*model.CategoryEntity, error) {
+	var category model.CategoryEntity
+	if err := r.categories().Where(dbx.HashExp{"name_1": name}).Limit(1).One(&category); err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+func (r *TaxonomyPg) CountryByName(name string) (*model.CountryEntity, error) {
+	var country model.CountryEntity
+	err := r.db.Select("id", "name").From("countries").Where(dbx.HashExp{"name": name}).Limit(1).One(&country)
+	if err != nil {
+		return nil, err
+	}
+
+	return &country, nil
+}
+
+func (r *TaxonomyPg) LanguageByName(name string) (*model.LanguageEntity, error) {
+	var language model.LanguageEntity
+	err := r.db.Select("id", "name").From("languages").Where(dbx.HashExp{"name": name}).Limit(1).One(&language)
+	if err != nil {
+		return nil, err
+	}
+
+	return &language, nil
+}
+
+func (r *TaxonomyPg) categories() *dbx.SelectQuery {
+	return r.db.Select("id", "name_1", "name_2", "name_3").From("categories")
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/pocketbase/pocketbase"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
 )
 
 type AuthorizationS struct {
@@ -23,8 +24,8 @@ func NewAuthorizationS(app *pocketbase.PocketBase) *AuthorizationS {
 }
 
 func (a *AuthorizationS) AmoCRMTokenExchange(req *model.AmoCRMTokenExchangeRequest) (*model.AmoCRMTokenExchangeResponse, error) {
-	filter := fmt.Sprintf("domain = '%s' && clientId = '%s'", req.Domain, req.ClientID)
-	amoCRMConfig, err := a.app.FindFirstRecordByFilter(model.AmoCredentialsCollection, filter)
+	filter := repository.NewFilter().Eq("domain", req.Domain).Eq("clientId", req.ClientID)
+	amoCRMConfig, err := repository.FindFirstRecord(a.app, model.AmoCredentialsCollection, filter)
 	if err != nil {
 		return nil, err
 	}
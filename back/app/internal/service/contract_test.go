@@ -0,0 +1,211 @@
+package service
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/token"
+)
+
+// TestListingContract calls every endpoint listing channels and checks that France 24
+// is described the same way by each: same fields, same values and a listing token of
+// the channel as URL, never the upstream URL.
+func TestListingContract(t *testing.T) {
+	now := time.Now()
+	start, _ := types.ParseDateTime(now.Add(-30 * time.Minute))
+	stop, _ := types.ParseDateTime(now.Add(30 * time.Minute))
+	env := newTestEnv(t, &model.ProgrammeEntity{ID: "p1", Channel: "France24.fr", Start: start, Stop: stop, Title: "Le Journal"})
+
+	ch1 := "ch1"
+	if _, err := env.stream.CreateFeatured(&model.FeaturedRequest{ChannelID: &ch1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.stats.stats.SaveHourly([]*model.ChannelStatsEntity{{Channel: "ch1", Hour: start, Plays: 1, WatchSeconds: 60}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := env.stream.WatchStream(&model.WatchStreamRequest{ChannelID: "ch1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.NowNext == nil || want.NowNext.Now == nil || want.NowNext.Now.Title != "Le Journal" {
+		t.Fatalf("now/next = %+v, want Le Journal airing", want.NowNext)
+	}
+
+	listings := map[string]func() ([]*model.WatchStreamResponse, error){
+		"GetChannelByName": func() ([]*model.WatchStreamResponse, error) {
+			resp, err := env.stream.GetChannelByName("France24.fr")
+			return []*model.WatchStreamResponse{resp}, err
+		},
+		"GetFeaturedChannels": func() ([]*model.WatchStreamResponse, error) {
+			return env.stream.GetFeaturedChannels("France")
+		},
+		"ListFeatured": func() ([]*model.WatchStreamResponse, error) {
+			slots, err := env.stream.ListFeatured()
+			var responses []*model.WatchStreamResponse
+			for _, slot := range slots {
+				responses = append(responses, slot.Channel)
+			}
+			return responses, err
+		},
+		"GetRecommendedChannels": func() ([]*model.WatchStreamResponse, error) {
+			return env.stream.GetRecommendedChannels(&model.RecommendStreamRequest{Channel: "BFMTV.fr", Limit: 24})
+		},
+		"GetAllStreams": func() ([]*model.WatchStreamResponse, error) {
+			resp, err := env.stream.GetAllStreams(&model.AllStreamsRequest{Page: 1, PerPage: 100})
+			if err != nil {
+				return nil, err
+			}
+			return resp.Channels, nil
+		},
+		"SearchStreams": func() ([]*model.WatchStreamResponse, error) {
+			resp, err := env.stream.SearchStreams(&model.SearchStreamRequest{Query: "france 24"})
+			if err != nil {
+				return nil, err
+			}
+			return resp.Channels, nil
+		},
+		"TopChannels": func() ([]*model.WatchStreamResponse, error) {
+			top, err := env.stats.TopChannels(&model.TopChannelsRequest{Period: "day"})
+			var responses []*model.WatchStreamResponse
+			for _, stats := range top {
+				responses = append(responses, stats.Channel)
+			}
+			return responses, err
+		},
+		"ChannelStats": func() ([]*model.WatchStreamResponse, error) {
+			stats, err := env.stats.ChannelStats("France24.fr", "day")
+			if err != nil {
+				return nil, err
+			}
+			return []*model.WatchStreamResponse{stats.Channel}, nil
+		},
+		"Rail": func() ([]*model.WatchStreamResponse, error) {
+			return env.stats.Rail(model.RailNew)
+		},
+	}
+
+	for name, listing := range listings {
+		responses, err := listing()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		checkListing(t, env, name, responses, want)
+	}
+
+	// Featured channels are left out of the category listing, France 24 shows there once unfeatured
+	slots, _ := env.stream.ListFeatured()
+	if err := env.stream.DeleteFeatured(slots[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	responses, err := env.stream.GetChannelsByCategory("news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkListing(t, env, "GetChannelsByCategory", responses, want)
+}
+
+// checkListing checks that a listing describes France 24 like want and that every
+// channel it lists has a listing token of its own
+func checkListing(t *testing.T, env *testEnv, name string, responses []*model.WatchStreamResponse, want *model.WatchStreamResponse) {
+	t.Helper()
+
+	var got *model.WatchStreamResponse
+	for _, response := range responses {
+		channel, err := env.channels.FindByChannel(response.Channel)
+		if err != nil {
+			t.Errorf("%s: lists %q, which is not a channel identifier", name, response.Channel)
+			continue
+		}
+
+		claims, err := env.signer.Verify(response.URL, token.ScopeList, token.Client{})
+		if err != nil || claims.ChannelID != channel.ID {
+			t.Errorf("%s: url of %s = %q, want a listing token of %s", name, response.Channel, response.URL, channel.ID)
+		}
+		if strings.Contains(response.URL, "upstream.example") {
+			t.Errorf("%s: exposes the upstream url of %s", name, response.Channel)
+		}
+
+		if response.Channel == want.Channel {
+			got = response
+		}
+	}
+	if got == nil {
+		t.Errorf("%s: doesn't list %s among %v", name, want.Channel, channelNames(responses))
+		return
+	}
+
+	gotJSON, wantJSON := contractJSON(t, got), contractJSON(t, want)
+	if gotJSON != wantJSON {
+		t.Errorf("%s: describes %s as\n%s\nwant\n%s", name, want.Channel, gotJSON, wantJSON)
+	}
+}
+
+// contractJSON serializes a response without its URL, which is a different token every time
+func contractJSON(t *testing.T, response *model.WatchStreamResponse) string {
+	t.Helper()
+
+	copied := *response
+	copied.URL = ""
+	data, err := json.Marshal(&copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestPlaylistContract checks that playlist exports describe channels like the listings,
+// with proxy URLs of playback tokens instead of listing tokens, valid for PLAYLIST_TOKEN_TTL
+func TestPlaylistContract(t *testing.T) {
+	env := newTestEnv(t)
+	withConfig(t, func(cfg *config.Config) { cfg.PlaylistTokenTTL = 48 * time.Hour })
+
+	want, err := env.stream.WatchStream(&model.WatchStreamRequest{ChannelID: "ch1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channels, err := env.stream.GetPlaylistChannels(&model.PlaylistRequest{BaseURL: "https://tv.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, channel := range channels {
+		names = append(names, channel.Channel)
+
+		prefix := "https://tv.example/api/v1/stream/hls/"
+		playToken, resource, ok := strings.Cut(strings.TrimPrefix(channel.URL, prefix), "/")
+		if !strings.HasPrefix(channel.URL, prefix) || !ok || resource != "index.m3u8" {
+			t.Errorf("url of %s = %q, want a proxy url of its playlist", channel.Channel, channel.URL)
+			continue
+		}
+		claims, err := env.signer.Verify(playToken, token.ScopePlay, token.Client{})
+		if err != nil {
+			t.Errorf("url of %s has no playback token: %v", channel.Channel, err)
+			continue
+		}
+		if found, _ := env.channels.FindByID(claims.ChannelID); found == nil || found.Channel != channel.Channel {
+			t.Errorf("playback token of %s is for %s", channel.Channel, claims.ChannelID)
+		}
+		if ttl := time.Until(claims.ExpiresAt()); ttl < 47*time.Hour || ttl > 48*time.Hour {
+			t.Errorf("playback token of %s expires in %s, want PLAYLIST_TOKEN_TTL", channel.Channel, ttl)
+		}
+
+		if channel.Channel == want.Channel && contractJSON(t, channel) != contractJSON(t, want) {
+			t.Errorf("playlist describes %s as %s, want %s", want.Channel, contractJSON(t, channel), contractJSON(t, want))
+		}
+	}
+
+	// Only working channels are exported, sorted by title
+	if want := []string{"BBCNews.uk", "BFMTV.fr", "France24.fr", "Gulli.fr", "LEquipe.fr", "SkySports.uk"}; !slices.Equal(names, want) {
+		t.Errorf("playlist = %v, want %v", names, want)
+	}
+}
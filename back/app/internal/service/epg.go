@@ -0,0 +1,219 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/apperror"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/pkg/xmltv"
+)
+
+const (
+	// defaultGuideSpan is how far ahead the guide of a channel lists programmes by default
+	defaultGuideSpan = 24 * time.Hour
+
+	// maxGuideSpan bounds the period a guide request can list, and the guide export
+	maxGuideSpan = 7 * 24 * time.Hour
+
+	// guideBatch is how many channels the programmes of the guide export are read for at once
+	guideBatch = 500
+
+	// guideGenerator names the guide export in its tv element
+	guideGenerator = "Free TV Channels"
+)
+
+// GetChannelGuide lists the programmes a channel airs in a period, the next day by default
+func (s *Stream) GetChannelGuide(req *model.ChannelGuideRequest) (*model.ChannelGuideResponse, error) {
+	channel, err := s.channels.FindByChannel(req.Channel)
+	if err != nil || channel == nil || channel.IsRetired {
+		return nil, apperror.ClientError(fmt.Errorf("channel not found"), http.StatusNotFound)
+	}
+
+	from := time.Now()
+	if req.From != "" {
+		if from, err = time.Parse(time.RFC3339, req.From); err != nil {
+			return nil, apperror.ClientError(fmt.Errorf("from must be an RFC 3339 time"), http.StatusBadRequest)
+		}
+	}
+	to := from.Add(defaultGuideSpan)
+	if req.To != "" {
+		if to, err = time.Parse(time.RFC3339, req.To); err != nil {
+			return nil, apperror.ClientError(fmt.Errorf("to must be an RFC 3339 time"), http.StatusBadRequest)
+		}
+	}
+	if !to.After(from) {
+		return nil, apperror.ClientError(fmt.Errorf("to must be after from"), http.StatusBadRequest)
+	}
+	if to.Sub(from) > maxGuideSpan {
+		return nil, apperror.ClientError(fmt.Errorf("the guide spans at most %s", maxGuideSpan), http.StatusBadRequest)
+	}
+
+	programmes, err := s.programmes.Find(channel.Channel, from, to)
+	if err != nil {
+		return nil, apperror.SystemError(err)
+	}
+
+	response := &model.ChannelGuideResponse{
+		Channel:    channel.Channel,
+		From:       from.UTC().Format(time.RFC3339),
+		To:         to.UTC().Format(time.RFC3339),
+		Programmes: make([]*model.Programme, len(programmes)),
+	}
+	for i, programme := range programmes {
+		response.Programmes[i] = programmeResponse(programme)
+	}
+
+	return response, nil
+}
+
+// GetGuideChannels lists the channels of the guide export: the working channels matching
+// the catalog filters, once per channel identifier, by title
+func (s *Stream) GetGuideChannels(req *model.GuideRequest) ([]*model.GuideChannel, error) {
+	query := s.catalogQuery(req.Category, req.Country, req.Language)
+	query.OnlyWorking = true
+	query.Sort = model.ChannelSort{Field: "title"}
+
+	found, err := s.channels.Find(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find channels: %w", err)
+	}
+
+	logos := s.findLogos(found)
+
+	channels := make([]*model.GuideChannel, 0, len(found))
+	seen := make(map[string]bool, len(found))
+	for _, channel := range found {
+		if channel.Channel == "" || seen[channel.Channel] {
+			continue
+		}
+		seen[channel.Channel] = true
+
+		guideChannel := &model.GuideChannel{
+			ID:   channel.Channel,
+			Name: channel.Title,
+		}
+		if logo := logos[channel.Logo]; logo != nil {
+			guideChannel.Logo = logo.URL
+		}
+		channels = append(channels, guideChannel)
+	}
+
+	return channels, nil
+}
+
+// WriteGuide writes the XMLTV guide of the channels, with their programmes from now
+// on for up to a week. Programmes are written as they are read, a batch of channels at a time.
+func (s *Stream) WriteGuide(w io.Writer, channels []*model.GuideChannel) error {
+	guide, err := xmltv.NewWriter(w, guideGenerator)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, len(channels))
+	for i, channel := range channels {
+		ids[i] = channel.ID
+
+		guideChannel := &xmltv.Channel{
+			ID:           channel.ID,
+			DisplayNames: []xmltv.Text{{Value: channel.Name}},
+		}
+		if channel.Logo != "" {
+			guideChannel.Icon = &xmltv.Icon{Src: channel.Logo}
+		}
+		if err := guide.WriteChannel(guideChannel); err != nil {
+			return err
+		}
+	}
+
+	from := time.Now()
+	to := from.Add(maxGuideSpan)
+	for start := 0; start < len(ids); start += guideBatch {
+		batch := ids[start:min(start+guideBatch, len(ids))]
+
+		err := s.programmes.Each(batch, from, to, func(programme *model.ProgrammeEntity) error {
+			return guide.WriteProgramme(guideProgramme(programme))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return guide.Close()
+}
+
+func guideProgramme(programme *model.ProgrammeEntity) *xmltv.Programme {
+	p := &xmltv.Programme{
+		Start:   xmltv.FormatTime(programme.Start.Time()),
+		Stop:    xmltv.FormatTime(programme.Stop.Time()),
+		Channel: programme.Channel,
+		Titles:  []xmltv.Text{{Value: programme.Title}},
+	}
+	if programme.SubTitle != "" {
+		p.SubTitles = []xmltv.Text{{Value: programme.SubTitle}}
+	}
+	if programme.Description != "" {
+		p.Descs = []xmltv.Text{{Value: programme.Description}}
+	}
+	if programme.Category != "" {
+		p.Categories = []xmltv.Text{{Value: programme.Category}}
+	}
+	if programme.Icon != "" {
+		p.Icon = &xmltv.Icon{Src: programme.Icon}
+	}
+
+	return p
+}
+
+// attachNowNext sets what the channels of the responses air now and next. The guide only
+// complements the listings, they are returned without it if it can't be read.
+func (s *Stream) attachNowNext(responses []*model.WatchStreamResponse) {
+	var channels []string
+	seen := make(map[string]bool, len(responses))
+	for _, response := range responses {
+		if response.Channel != "" && !seen[response.Channel] {
+			seen[response.Channel] = true
+			channels = append(channels, response.Channel)
+		}
+	}
+
+	now := time.Now()
+	programmes, err := s.programmes.NowNext(channels, now)
+	if err != nil || len(programmes) == 0 {
+		return
+	}
+
+	guide := make(map[string]*model.NowNext, len(channels))
+	for _, programme := range programmes {
+		nowNext, ok := guide[programme.Channel]
+		if !ok {
+			nowNext = &model.NowNext{}
+			guide[programme.Channel] = nowNext
+		}
+
+		switch {
+		case nowNext.Now == nil && nowNext.Next == nil && !programme.Start.Time().After(now):
+			nowNext.Now = programmeResponse(programme)
+		case nowNext.Next == nil:
+			nowNext.Next = programmeResponse(programme)
+		}
+	}
+
+	for _, response := range responses {
+		response.NowNext = guide[response.Channel]
+	}
+}
+
+func programmeResponse(programme *model.ProgrammeEntity) *model.Programme {
+	return &model.Programme{
+		Start:       programme.Start.Time().UTC().Format(time.RFC3339),
+		Stop:        programme.Stop.Time().UTC().Format(time.RFC3339),
+		Title:       programme.Title,
+		SubTitle:    programme.SubTitle,
+		Description: programme.Description,
+		Category:    programme.Category,
+		Icon:        programme.Icon,
+	}
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/apperror"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+// GetFeaturedChannels retrieves the channels featured right now, in slot order.
+// Slots targeting countries are only shown to viewers of those countries, given by name.
+func (s *Stream) GetFeaturedChannels(countryName string) ([]*model.WatchStreamResponse, error) {
+	slots, err := s.featured.Active(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	country := ""
+	if countryName != "" {
+		if entity, err := s.taxonomy.CountryByName(countryName); err == nil && entity != nil {
+			country = entity.ID
+		}
+	}
+
+	var channelIDs []string
+	for _, slot := range slots {
+		if slot.Targets(country) && !slices.Contains(channelIDs, slot.Channel) {
+			channelIDs = append(channelIDs, slot.Channel)
+		}
+	}
+	if len(channelIDs) == 0 {
+		return nil, nil
+	}
+
+	// Fetch the actual channels, keeping the featured order
+	found, err := s.channels.FindByIDs(channelIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*model.Channel, len(found))
+	for _, channel := range found {
+		byID[channel.ID] = channel
+	}
+
+	channels := make([]*model.Channel, 0, len(channelIDs))
+	for _, channelID := range channelIDs {
+		if channel, ok := byID[channelID]; ok && !channel.IsRetired {
+			channels = append(channels, channel)
+		}
+	}
+
+	return s.buildChannelResponses(channels), nil
+}
+
+// ListFeatured lists every featured slot, including scheduled and expired ones
+func (s *Stream) ListFeatured() ([]*model.FeaturedResponse, error) {
+	slots, err := s.featured.List()
+	if err != nil {
+		return nil, apperror.SystemError(err)
+	}
+
+	return s.featuredResponses(slots)
+}
+
+// CreateFeatured features a channel. Without a position the slot goes last.
+func (s *Stream) CreateFeatured(req *model.FeaturedRequest) (*model.FeaturedResponse, error) {
+	if req.ChannelID == nil || *req.ChannelID == "" {
+		return nil, apperror.ClientError(fmt.Errorf("channel_id is required"), http.StatusBadRequest)
+	}
+
+	slot := &model.FeaturedEntity{}
+	if req.Position == nil {
+		slots, err := s.featured.List()
+		if err != nil {
+			return nil, apperror.SystemError(err)
+		}
+		for _, existing := range slots {
+			slot.Position = max(slot.Position, existing.Position+1)
+		}
+	}
+
+	if err := s.applyFeatured(slot, req); err != nil {
+		return nil, err
+	}
+	if err := s.featured.Create(slot); err != nil {
+		return nil, apperror.SystemError(err)
+	}
+
+	return s.featuredResponse(slot)
+}
+
+// UpdateFeatured changes the fields of a featured slot the request sets
+func (s *Stream) UpdateFeatured(id string, req *model.FeaturedRequest) (*model.FeaturedResponse, error) {
+	slot, err := s.findFeatured(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyFeatured(slot, req); err != nil {
+		return nil, err
+	}
+	if err := s.featured.Update(slot); err != nil {
+		return nil, apperror.SystemError(err)
+	}
+
+	return s.featuredResponse(slot)
+}
+
+func (s *Stream) DeleteFeatured(id string) error {
+	if _, err := s.findFeatured(id); err != nil {
+		return err
+	}
+
+	if err := s.featured.Delete(id); err != nil {
+		return apperror.SystemError(err)
+	}
+	return nil
+}
+
+// ReorderFeatured puts the listed slots first, in their order, followed by the others
+// in their current order, and numbers the positions from 0
+func (s *Stream) ReorderFeatured(req *model.FeaturedOrderRequest) ([]*model.FeaturedResponse, error) {
+	slots, err := s.featured.List()
+	if err != nil {
+		return nil, apperror.SystemError(err)
+	}
+
+	byID := make(map[string]*model.FeaturedEntity, len(slots))
+	for _, slot := range slots {
+		byID[slot.ID] = slot
+	}
+
+	ordered := make([]*model.FeaturedEntity, 0, len(slots))
+	for _, id := range req.IDs {
+		slot, ok := byID[id]
+		if !ok {
+			return nil, apperror.ClientError(fmt.Errorf("featured slot %q not found", id), http.StatusBadRequest)
+		}
+		if slices.Contains(ordered, slot) {
+			return nil, apperror.ClientError(fmt.Errorf("featured slot %q is listed twice", id), http.StatusBadRequest)
+		}
+		ordered = append(ordered, slot)
+	}
+	for _, slot := range slots {
+		if !slices.Contains(ordered, slot) {
+			ordered = append(ordered, slot)
+		}
+	}
+
+	for position, slot := range ordered {
+		if slot.Position == position {
+			continue
+		}
+		slot.Position = position
+		if err := s.featured.Update(slot); err != nil {
+			return nil, apperror.SystemError(err)
+		}
+	}
+
+	return s.featuredResponses(ordered)
+}
+
+func (s *Stream) findFeatured(id string) (*model.FeaturedEntity, error) {
+	slot, err := s.featured.FindByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperror.ClientError(fmt.Errorf("featured slot not found"), http.StatusNotFound)
+	} else if err != nil {
+		return nil, apperror.SystemError(err)
+	}
+	return slot, nil
+}
+
+// applyFeatured validates the fields the request sets and copies them into the slot
+func (s *Stream) applyFeatured(slot *model.FeaturedEntity, req *model.FeaturedRequest) error {
+	if req.ChannelID != nil {
+		channel, err := s.channels.FindByID(*req.ChannelID)
+		if err != nil || channel == nil {
+			return apperror.ClientError(fmt.Errorf("channel not found"), http.StatusBadRequest)
+		}
+		slot.Channel = channel.ID
+	}
+
+	if req.Position != nil {
+		if *req.Position < 0 {
+			return apperror.ClientError(fmt.Errorf("position must not be negative"), http.StatusBadRequest)
+		}
+		slot.Position = *req.Position
+	}
+
+	for _, field := range []struct {
+		name  string
+		value *string
+		dest  *types.DateTime
+	}{
+		{"starts_at", req.StartsAt, &slot.StartsAt},
+		{"ends_at", req.EndsAt, &slot.EndsAt},
+	} {
+		if field.value == nil {
+			continue
+		}
+		if *field.value == "" {
+			*field.dest = types.DateTime{}
+			continue
+		}
+
+		at, err := time.Parse(time.RFC3339, *field.value)
+		if err != nil {
+			return apperror.ClientError(fmt.Errorf("%s must be an RFC 3339 time", field.name), http.StatusBadRequest)
+		}
+		*field.dest, _ = types.ParseDateTime(at)
+	}
+	if !slot.StartsAt.IsZero() && !slot.EndsAt.IsZero() && !slot.EndsAt.After(slot.StartsAt) {
+		return apperror.ClientError(fmt.Errorf("ends_at must be after starts_at"), http.StatusBadRequest)
+	}
+
+	if req.Countries != nil {
+		countries := types.JSONArray[string]{}
+		for _, name := range *req.Countries {
+			country, err := s.taxonomy.CountryByName(name)
+			if err != nil || country == nil {
+				return apperror.ClientError(fmt.Errorf("country %q not found", name), http.StatusBadRequest)
+			}
+			if !slices.Contains(countries, country.ID) {
+				countries = append(countries, country.ID)
+			}
+		}
+		slot.Countries = countries
+	}
+
+	return nil
+}
+
+func (s *Stream) featuredResponse(slot *model.FeaturedEntity) (*model.FeaturedResponse, error) {
+	responses, err := s.featuredResponses([]*model.FeaturedEntity{slot})
+	if err != nil {
+		return nil, err
+	}
+	return responses[0], nil
+}
+
+// featuredResponses describes the slots with their channels, which are left empty
+// when the channel no longer exists
+func (s *Stream) featuredResponses(slots []*model.FeaturedEntity) ([]*model.FeaturedResponse, error) {
+	ids := make([]string, len(slots))
+	for i, slot := range slots {
+		ids[i] = slot.Channel
+	}
+
+	found, err := s.channels.FindByIDs(ids)
+	if err != nil {
+		return nil, apperror.SystemError(err)
+	}
+	channels := make(map[string]*model.Channel, len(found))
+	for _, channel := range found {
+		channels[channel.ID] = channel
+	}
+
+	now := time.Now()
+	responses := make([]*model.FeaturedResponse, len(slots))
+	for i, slot := range slots {
+		response := &model.FeaturedResponse{
+			ID:        slot.ID,
+			ChannelID: slot.Channel,
+			Position:  slot.Position,
+			StartsAt:  featuredTime(slot.StartsAt),
+			EndsAt:    featuredTime(slot.EndsAt),
+			Countries: []string{},
+			Active:    slot.ActiveAt(now),
+		}
+		for _, id := range slot.Countries {
+			if country := s.lookups.country(id); country != nil {
+				response.Countries = append(response.Countries, country.Name)
+			}
+		}
+		if channel, ok := channels[slot.Channel]; ok {
+			response.Channel = s.buildChannelResponse(channel)
+		}
+		responses[i] = response
+	}
+
+	return responses, nil
+}
+
+// featuredTime formats a slot time as RFC 3339, empty when it isn't set
+func featuredTime(dt types.DateTime) string {
+	if dt.IsZero() {
+		return ""
+	}
+	return dt.Time().UTC().Format(time.RFC3339)
+}
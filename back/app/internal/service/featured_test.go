@@ -0,0 +1,122 @@
+package service
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+func TestFeaturedSlots(t *testing.T) {
+	env := newTestEnv(t)
+
+	ch1, ch4, france := "ch1", "ch4", []string{"France"}
+	french, err := env.stream.CreateFeatured(&model.FeaturedRequest{ChannelID: &ch1, Countries: &france})
+	if err != nil {
+		t.Fatal(err)
+	}
+	everyone, err := env.stream.CreateFeatured(&model.FeaturedRequest{ChannelID: &ch4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if french.Position != 0 || everyone.Position != 1 {
+		t.Errorf("positions = %d, %d, want new slots to go last", french.Position, everyone.Position)
+	}
+	if !slices.Equal(french.Countries, france) || french.Channel == nil || french.Channel.Channel != "France24.fr" {
+		t.Errorf("got %+v, want France24.fr featured in France", french)
+	}
+
+	tests := []struct {
+		country string
+		want    []string
+	}{
+		{"France", []string{"France24.fr", "BBCNews.uk"}},
+		{"United Kingdom", []string{"BBCNews.uk"}},
+		{"", []string{"BBCNews.uk"}},
+		{"Atlantis", []string{"BBCNews.uk"}},
+	}
+	for _, tt := range tests {
+		resp, err := env.stream.GetFeaturedChannels(tt.country)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := channelNames(resp); !slices.Equal(got, tt.want) {
+			t.Errorf("GetFeaturedChannels(%q) = %v, want %v", tt.country, got, tt.want)
+		}
+	}
+
+	ordered, err := env.stream.ReorderFeatured(&model.FeaturedOrderRequest{IDs: []string{everyone.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ordered) != 2 || ordered[0].ID != everyone.ID || ordered[0].Position != 0 || ordered[1].Position != 1 {
+		t.Errorf("reordered = %+v, %+v, want %s first", ordered[0], ordered[1], everyone.ID)
+	}
+
+	if err := env.stream.DeleteFeatured(everyone.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.stream.DeleteFeatured(everyone.ID); statusCode(err) != http.StatusNotFound {
+		t.Errorf("deleting a deleted slot = %v, want a 404 error", err)
+	}
+	slots, err := env.stream.ListFeatured()
+	if err != nil || len(slots) != 1 || slots[0].ID != french.ID {
+		t.Errorf("ListFeatured() = %v, %v, want only %s", slots, err, french.ID)
+	}
+}
+
+func TestFeaturedWindow(t *testing.T) {
+	env := newTestEnv(t)
+
+	ch1 := "ch1"
+	past, future := time.Now().Add(-time.Hour).Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339)
+	slot, err := env.stream.CreateFeatured(&model.FeaturedRequest{ChannelID: &ch1, StartsAt: &future})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot.Active {
+		t.Error("a slot starting in an hour is active")
+	}
+	if resp, _ := env.stream.GetFeaturedChannels(""); len(resp) != 0 {
+		t.Errorf("featured = %v, want none before the slot starts", channelNames(resp))
+	}
+
+	slot, err = env.stream.UpdateFeatured(slot.ID, &model.FeaturedRequest{StartsAt: &past, EndsAt: &future})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slot.Active || slot.ChannelID != "ch1" {
+		t.Errorf("got %+v, want ch1 active", slot)
+	}
+}
+
+func TestFeaturedInvalidRequests(t *testing.T) {
+	env := newTestEnv(t)
+
+	missing, ch1, negative := "missing", "ch1", -1
+	early, late, invalid := "2025-01-01T00:00:00Z", "2025-01-02T00:00:00Z", "tomorrow"
+	atlantis := []string{"Atlantis"}
+
+	tests := []struct {
+		name string
+		req  *model.FeaturedRequest
+	}{
+		{"no channel", &model.FeaturedRequest{}},
+		{"missing channel", &model.FeaturedRequest{ChannelID: &missing}},
+		{"negative position", &model.FeaturedRequest{ChannelID: &ch1, Position: &negative}},
+		{"invalid time", &model.FeaturedRequest{ChannelID: &ch1, StartsAt: &invalid}},
+		{"ends before it starts", &model.FeaturedRequest{ChannelID: &ch1, StartsAt: &late, EndsAt: &early}},
+		{"unknown country", &model.FeaturedRequest{ChannelID: &ch1, Countries: &atlantis}},
+	}
+	for _, tt := range tests {
+		if _, err := env.stream.CreateFeatured(tt.req); statusCode(err) != http.StatusBadRequest {
+			t.Errorf("%s: got %v, want a 400 error", tt.name, err)
+		}
+	}
+
+	if _, err := env.stream.ReorderFeatured(&model.FeaturedOrderRequest{IDs: []string{"missing"}}); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("reordering a missing slot = %v, want a 400 error", err)
+	}
+}
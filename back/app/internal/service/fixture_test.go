@@ -0,0 +1,364 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository/memory"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/token"
+)
+
+var (
+	_ RedisClientI = (*fakeRedis)(nil)
+	_ StatsClientI = (*fakeRedis)(nil)
+)
+
+// fakeRedis keeps in memory what the services keep in Redis
+type fakeRedis struct {
+	mu        sync.Mutex
+	proxyURLs map[string]string
+	uses      map[string]int64
+	revoked   map[string]revocation
+	coWatch   map[string]map[string]float64
+	viewers   map[string]map[string]time.Time
+	sessions  map[string]string
+	hourly    map[time.Time]map[string]*model.ChannelStatsEntity
+	rails     map[string][]string
+
+	// ahead is how far the clock expiring revocations runs ahead of time.Now
+	ahead time.Duration
+}
+
+// revocation is a revocation marker together with when it expires
+type revocation struct {
+	at, expires time.Time
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		proxyURLs: make(map[string]string),
+		uses:      make(map[string]int64),
+		revoked:   make(map[string]revocation),
+		coWatch:   make(map[string]map[string]float64),
+		viewers:   make(map[string]map[string]time.Time),
+		sessions:  make(map[string]string),
+		hourly:    make(map[time.Time]map[string]*model.ChannelStatsEntity),
+		rails:     make(map[string][]string),
+	}
+}
+
+func (r *fakeRedis) StoreProxyURLs(token string, urls []string, ttl time.Duration) (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make(map[string]string, len(urls))
+	for _, url := range urls {
+		if _, ok := keys[url]; !ok {
+			keys[url] = fmt.Sprintf("r%d", len(r.proxyURLs))
+			r.proxyURLs[token+"|"+keys[url]] = url
+		}
+	}
+	return keys, nil
+}
+
+func (r *fakeRedis) GetProxyURL(token, key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, ok := r.proxyURLs[token+"|"+key]
+	if !ok {
+		return "", fmt.Errorf("proxy url not found")
+	}
+	return url, nil
+}
+
+func (r *fakeRedis) UseToken(id string, ttl time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.uses[id]++
+	return r.uses[id], nil
+}
+
+func (r *fakeRedis) RevokeChannelTokens(channelID string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.revoked[channelID] = revocation{at: now, expires: now.Add(r.ahead + ttl)}
+	return nil
+}
+
+func (r *fakeRedis) ChannelTokensRevokedAt(channelID string) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	revoked, ok := r.revoked[channelID]
+	if !ok || time.Now().Add(r.ahead).After(revoked.expires) {
+		return time.Time{}, nil
+	}
+	return revoked.at, nil
+}
+
+func (r *fakeRedis) RecordCoWatch(channel string, others []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range others {
+		if other == channel {
+			continue
+		}
+		for _, pair := range [][2]string{{channel, other}, {other, channel}} {
+			if r.coWatch[pair[0]] == nil {
+				r.coWatch[pair[0]] = make(map[string]float64)
+			}
+			r.coWatch[pair[0]][pair[1]]++
+		}
+	}
+	return nil
+}
+
+func (r *fakeRedis) CoWatched(channel string, limit int) (map[string]float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	coWatched := make(map[string]float64)
+	for other, count := range r.coWatch[channel] {
+		coWatched[other] = count
+	}
+	return coWatched, nil
+}
+
+func (r *fakeRedis) TouchViewer(channelID, session string, at time.Time) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.viewers[channelID] == nil {
+		r.viewers[channelID] = make(map[string]time.Time)
+	}
+	last := r.viewers[channelID][session]
+	r.viewers[channelID][session] = at
+	return last, nil
+}
+
+func (r *fakeRedis) RemoveViewer(channelID, session string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.viewers[channelID], session)
+	return nil
+}
+
+func (r *fakeRedis) CountViewers(channelID string, since time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var count int64
+	for _, at := range r.viewers[channelID] {
+		if !at.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeRedis) LiveViewers(since time.Time) (map[string]int64, error) {
+	viewers := make(map[string]int64)
+	for channelID := range r.viewers {
+		count, _ := r.CountViewers(channelID, since)
+		if count > 0 {
+			viewers[channelID] = count
+		}
+	}
+	return viewers, nil
+}
+
+func (r *fakeRedis) SwapSessionChannel(session, channel string, ttl time.Duration) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.sessions[session]
+	r.sessions[session] = channel
+	return previous, nil
+}
+
+func (r *fakeRedis) AddHourlyStats(hour time.Time, channelID string, plays, seconds, viewers int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.hourly[hour] == nil {
+		r.hourly[hour] = make(map[string]*model.ChannelStatsEntity)
+	}
+	stats, ok := r.hourly[hour][channelID]
+	if !ok {
+		dt, _ := types.ParseDateTime(hour)
+		stats = &model.ChannelStatsEntity{Channel: channelID, Hour: dt}
+		r.hourly[hour][channelID] = stats
+	}
+	stats.Plays += int(plays)
+	stats.WatchSeconds += int(seconds)
+	stats.PeakViewers = max(stats.PeakViewers, int(viewers))
+	return nil
+}
+
+func (r *fakeRedis) PendingStatsHours() ([]time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hours := make([]time.Time, 0, len(r.hourly))
+	for hour := range r.hourly {
+		hours = append(hours, hour)
+	}
+	return hours, nil
+}
+
+func (r *fakeRedis) HourlyStats(hour time.Time) ([]*model.ChannelStatsEntity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]*model.ChannelStatsEntity, 0, len(r.hourly[hour]))
+	for _, s := range r.hourly[hour] {
+		copied := *s
+		stats = append(stats, &copied)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Channel < stats[j].Channel })
+	return stats, nil
+}
+
+func (r *fakeRedis) DeleteHourlyStats(hour time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.hourly, hour)
+	return nil
+}
+
+func (r *fakeRedis) GetRail(kind string) ([]string, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids, ok := r.rails[kind]
+	return ids, ok, nil
+}
+
+func (r *fakeRedis) StoreRail(kind string, ids []string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rails[kind] = ids
+	return nil
+}
+
+// testEnv is a Stream and a Stats service over the in-memory repositories,
+// with the catalog of testChannels
+type testEnv struct {
+	stream     *Stream
+	stats      *Stats
+	channels   *memory.Channel
+	taxonomy   *memory.Taxonomy
+	featured   *memory.Featured
+	programmes *memory.Programme
+	redis      *fakeRedis
+	signer     *token.Signer
+}
+
+func newTestEnv(t testing.TB, programmes ...*model.ProgrammeEntity) *testEnv {
+	t.Helper()
+
+	signer, err := token.NewSigner([]token.Key{token.RandomKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &testEnv{
+		channels:   memory.NewChannel(testChannels()...),
+		taxonomy:   memory.NewTaxonomy(),
+		featured:   memory.NewFeatured(),
+		programmes: memory.NewProgramme(programmes...),
+		redis:      newFakeRedis(),
+		signer:     signer,
+	}
+
+	env.taxonomy.AddQualities(
+		&model.QualityEntity{ID: "q1", Quality: "480p"},
+		&model.QualityEntity{ID: "q2", Quality: "720p"},
+		&model.QualityEntity{ID: "q3", Quality: "1080p"},
+	)
+	env.taxonomy.AddCategories(
+		&model.CategoryEntity{ID: "news", Name1: "news"},
+		&model.CategoryEntity{ID: "sports", Name1: "sports"},
+		&model.CategoryEntity{ID: "kids", Name1: "kids"},
+	)
+	env.taxonomy.AddCountries(
+		&model.CountryEntity{ID: "fr", Name: "France"},
+		&model.CountryEntity{ID: "uk", Name: "United Kingdom"},
+	)
+	env.taxonomy.AddLanguages(
+		&model.LanguageEntity{ID: "fra", Name: "French"},
+		&model.LanguageEntity{ID: "eng", Name: "English"},
+	)
+	env.channels.AddLogos(&model.LogoEntity{ID: "logo1", URL: "https://logos.example/france24.png", Width: 256, Height: 256})
+
+	env.stream = NewStream(env.channels, env.taxonomy, env.featured, memory.NewSearch(env.channels, env.taxonomy), env.programmes, env.redis, signer)
+	env.stats = NewStats(env.stream, env.channels, memory.NewStats(env.channels), env.redis)
+
+	return env
+}
+
+// testChannels is a small catalog: French and British news, sports and kids channels,
+// one of them broken and one retired
+func testChannels() []*model.Channel {
+	heights := map[string]int{"q1": 480, "q2": 720, "q3": 1080}
+	channel := func(id, channel, title, quality, category, country, language string, uptime, popularity float64) *model.Channel {
+		return &model.Channel{
+			ID:            id,
+			Channel:       channel,
+			Title:         title,
+			URL:           "https://upstream.example/" + id + "/index.m3u8",
+			Quality:       quality,
+			QualityHeight: heights[quality],
+			Category:      category,
+			Country:       country,
+			Language:      language,
+			IsWorking:     true,
+			Uptime:        uptime,
+			Popularity:    popularity,
+		}
+	}
+
+	channels := []*model.Channel{
+		channel("ch1", "France24.fr", "France 24", "q3", "news", "fr", "fra", 99, 500),
+		channel("ch2", "BFMTV.fr", "BFM TV", "q2", "news", "fr", "fra", 90, 300),
+		channel("ch3", "LEquipe.fr", "L'Equipe", "q3", "sports", "fr", "fra", 95, 0),
+		channel("ch4", "BBCNews.uk", "BBC News", "q3", "news", "uk", "eng", 98, 800),
+		channel("ch5", "SkySports.uk", "Sky Sports", "q2", "sports", "uk", "eng", 80, 100),
+		channel("ch6", "CBeebies.uk", "CBeebies", "q1", "kids", "uk", "eng", 60, 0),
+		channel("ch7", "Gulli.fr", "Gulli", "q1", "kids", "fr", "fra", 70, 0),
+		channel("ch8", "Old.fr", "Old Channel", "q2", "news", "fr", "fra", 0, 0),
+	}
+	// Channels were added a day apart, in order
+	for i, channel := range channels {
+		channel.Created, _ = types.ParseDateTime(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i))
+	}
+	channels[0].Logo = "logo1"
+	channels[5].IsWorking = false
+	channels[7].IsRetired = true
+
+	return channels
+}
+
+// withConfig changes the config for the duration of a test
+func withConfig(t testing.TB, fn func(cfg *config.Config)) {
+	t.Helper()
+
+	cfg := config.GetConfig()
+	saved := *cfg
+	fn(cfg)
+	t.Cleanup(func() { *cfg = saved })
+}
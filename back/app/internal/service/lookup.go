@@ -0,0 +1,136 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
+)
+
+// LookupCollections are the small collections channels relate to, cached in memory.
+// Record hooks invalidate the cache when one of them changes.
+var LookupCollections = []string{"qualities", "categories", "countries", "languages"}
+
+// lookupTTL bounds how stale the cache gets when the collections are changed
+// by another process, e.g. an import run from the command line
+const lookupTTL = 5 * time.Minute
+
+// lookups caches the records of the lookup collections by id
+type lookups struct {
+	taxonomy repository.TaxonomyRepository
+
+	mu          sync.RWMutex
+	collections map[string]*lookupCollection
+}
+
+type lookupCollection struct {
+	records map[string]any
+	loaded  time.Time
+}
+
+func newLookups(taxonomy repository.TaxonomyRepository) *lookups {
+	return &lookups{
+		taxonomy:    taxonomy,
+		collections: make(map[string]*lookupCollection),
+	}
+}
+
+func (l *lookups) quality(id string) *model.QualityEntity {
+	quality, _ := l.get("qualities", id).(*model.QualityEntity)
+	return quality
+}
+
+func (l *lookups) category(id string) *model.CategoryEntity {
+	category, _ := l.get("categories", id).(*model.CategoryEntity)
+	return category
+}
+
+func (l *lookups) country(id string) *model.CountryEntity {
+	country, _ := l.get("countries", id).(*model.CountryEntity)
+	return country
+}
+
+func (l *lookups) language(id string) *model.LanguageEntity {
+	language, _ := l.get("languages", id).(*model.LanguageEntity)
+	return language
+}
+
+// get returns a record of a lookup collection, loading the whole collection on first use
+func (l *lookups) get(collection, id string) any {
+	if id == "" {
+		return nil
+	}
+
+	l.mu.RLock()
+	cached, ok := l.collections[collection]
+	l.mu.RUnlock()
+
+	if !ok || time.Since(cached.loaded) > lookupTTL {
+		cached = l.load(collection)
+		if cached == nil {
+			return nil
+		}
+	}
+
+	return cached.records[id]
+}
+
+func (l *lookups) load(collection string) *lookupCollection {
+	records := make(map[string]any)
+
+	switch collection {
+	case "qualities":
+		qualities, err := l.taxonomy.Qualities()
+		if err != nil {
+			return nil
+		}
+		for _, quality := range qualities {
+			records[quality.ID] = quality
+		}
+	case "categories":
+		categories, err := l.taxonomy.Categories()
+		if err != nil {
+			return nil
+		}
+		for _, category := range categories {
+			records[category.ID] = category
+		}
+	case "countries":
+		countries, err := l.taxonomy.Countries()
+		if err != nil {
+			return nil
+		}
+		for _, country := range countries {
+			records[country.ID] = country
+		}
+	case "languages":
+		languages, err := l.taxonomy.Languages()
+		if err != nil {
+			return nil
+		}
+		for _, language := range languages {
+			records[language.ID] = language
+		}
+	default:
+		return nil
+	}
+
+	cached := &lookupCollection{
+		records: records,
+		loaded:  time.Now(),
+	}
+
+	l.mu.Lock()
+	l.collections[collection] = cached
+	l.mu.Unlock()
+
+	return cached
+}
+
+// invalidate drops the cached records of a collection
+func (l *lookups) invalidate(collection string) {
+	l.mu.Lock()
+	delete(l.collections, collection)
+	l.mu.Unlock()
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/apperror"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+const (
+	defaultPerPage = 24
+	maxPerPage     = 100
+	defaultSort    = "quality"
+
+	defaultSearchPerPage = 20
+)
+
+// streamSorts are the sort options of the catalog listing. Ties are broken by id,
+// which keeps the order stable for keyset pagination.
+var streamSorts = map[string]model.ChannelSort{
+	"quality": {Field: "quality", Desc: true},
+	"title":   {Field: "title"},
+	"newest":  {Field: "created", Desc: true},
+	"uptime":  {Field: "uptime", Desc: true},
+	"popular": {Field: "popularity", Desc: true},
+}
+
+// streamCursor points after the last channel of a page
+type streamCursor struct {
+	Sort  string `json:"s"`
+	Value any    `json:"v"`
+	ID    string `json:"id"`
+}
+
+// key returns the position of the cursor in the order
+func (c *streamCursor) key() *model.ChannelKey {
+	return &model.ChannelKey{Value: c.Value, ID: c.ID}
+}
+
+func encodeCursor(sortName string, option model.ChannelSort, channel *model.Channel) string {
+	data, err := json.Marshal(streamCursor{
+		Sort:  sortName,
+		Value: channel.SortValue(option.Field),
+		ID:    channel.ID,
+	})
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor, sortName string) (*streamCursor, error) {
+	invalid := apperror.ClientError(fmt.Errorf("invalid cursor"), http.StatusBadRequest)
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalid
+	}
+
+	var c streamCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, invalid
+	}
+	switch c.Value.(type) {
+	case string, float64:
+	default:
+		return nil, invalid
+	}
+	if c.Sort != sortName {
+		return nil, apperror.ClientError(fmt.Errorf("cursor was issued for sort %q", c.Sort), http.StatusBadRequest)
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestProxyContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{"video/MP2T", "video/mp2t"},
+		{"application/vnd.apple.mpegurl; charset=utf-8", "application/vnd.apple.mpegurl"},
+		{"audio/aac", "audio/aac"},
+		{"video/mp4", "video/mp4"},
+		{"text/vtt", "text/vtt"},
+		{"text/html; charset=utf-8", "application/octet-stream"},
+		{"application/javascript", "application/octet-stream"},
+		{"image/svg+xml", "application/octet-stream"},
+		{"text/plain", "application/octet-stream"},
+		{"", "application/octet-stream"},
+		{"not a type", "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		if got := proxyContentType(tt.contentType); got != tt.want {
+			t.Errorf("proxyContentType(%q) = %q, want %q", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestProxyHeader(t *testing.T) {
+	header := proxyHeader()
+	if header["X-Content-Type-Options"] != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", header["X-Content-Type-Options"])
+	}
+	if header["Content-Security-Policy"] != "sandbox" {
+		t.Errorf("Content-Security-Policy = %q, want sandbox", header["Content-Security-Policy"])
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublicAddr(%s) = %t, want %t", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestPublicAddressControl(t *testing.T) {
+	if err := publicAddressControl("tcp4", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("public address refused: %v", err)
+	}
+	for _, address := range []string{"127.0.0.1:80", "[::1]:443", "169.254.169.254:80", "10.1.2.3:8080"} {
+		if err := publicAddressControl("tcp", address, nil); err == nil {
+			t.Errorf("%s was allowed", address)
+		}
+	}
+}
+
+func TestCheckProxyRedirect(t *testing.T) {
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://cdn.example.com/live/index.m3u8", true},
+		{"http://93.184.216.34/seg.ts", true},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://127.0.0.1:8090/_/", false},
+		{"http://[::1]/", false},
+		{"http://localhost:8090/", false},
+		{"http://admin.localhost/", false},
+		{"http://192.168.0.1/", false},
+		{"file:///etc/passwd", false},
+		{"ftp://example.com/x", false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		err := checkProxyRedirect(req, []*http.Request{httptest.NewRequest(http.MethodGet, "https://cdn.example.com/", nil)})
+		if (err == nil) != tt.allowed {
+			t.Errorf("checkProxyRedirect(%s) error = %v, want allowed %t", tt.url, err, tt.allowed)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://cdn.example.com/", nil)
+	if err := checkProxyRedirect(req, make([]*http.Request, 10)); err == nil {
+		t.Error("an 11th redirect was followed")
+	}
+}
+
+func TestProxyClientRefusesLoopback(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer upstream.Close()
+
+	resp, err := newProxyClient().Get(upstream.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("the proxy client connected to a loopback upstream")
+	}
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/apperror"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+const (
+	// railSize is how many channels a rail lists
+	railSize = 12
+
+	// trendingCandidates bounds the channels watched recently that trending weighs
+	trendingCandidates = 200
+
+	// trendingWindow is the recent period trending compares to the days before it
+	trendingWindow = 24 * time.Hour
+
+	// minTrendingPlays keeps channels played only once or twice from trending by chance
+	minTrendingPlays = 3
+
+	defaultRailsRefresh = 10 * time.Minute
+)
+
+// Rail returns the channels of a rail: trending now, most watched this week or new in catalog.
+// The channel ids are cached for RAILS_REFRESH, the responses are built on every call
+// so that their stream tokens are fresh.
+func (s *Stats) Rail(kind string) ([]*model.WatchStreamResponse, error) {
+	var compute func() ([]string, error)
+	switch kind {
+	case model.RailTrending:
+		compute = s.trendingRail
+	case model.RailMostWatched:
+		compute = s.mostWatchedRail
+	case model.RailNew:
+		compute = s.newRail
+	default:
+		return nil, apperror.ClientError(fmt.Errorf("unknown rail %q", kind), http.StatusNotFound)
+	}
+
+	// The cache only saves work, a rail is computed when Redis fails
+	ids, ok, err := s.redisClient.GetRail(kind)
+	if err != nil || !ok {
+		ids, err = compute()
+		if err != nil {
+			return nil, err
+		}
+		_ = s.redisClient.StoreRail(kind, ids, railsRefresh())
+	}
+
+	found, err := s.channels.FindByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*model.Channel, len(found))
+	for _, channel := range found {
+		byID[channel.ID] = channel
+	}
+
+	channels := make([]*model.Channel, 0, len(ids))
+	for _, id := range ids {
+		if channel, ok := byID[id]; ok && !channel.IsRetired {
+			channels = append(channels, channel)
+		}
+	}
+
+	return s.stream.buildChannelResponses(channels), nil
+}
+
+// trendingRail ranks the channels played recently by how much more they are played than
+// on an average day of the rest of the week
+func (s *Stats) trendingRail() ([]string, error) {
+	now := time.Now()
+
+	recent, err := s.stats.Top(&model.StatsQuery{Since: now.Add(-trendingWindow), Limit: trendingCandidates})
+	if err != nil {
+		return nil, err
+	}
+	week, err := s.stats.Top(&model.StatsQuery{Since: now.Add(-model.StatsPeriods["week"])})
+	if err != nil {
+		return nil, err
+	}
+
+	weekPlays := make(map[string]int, len(week))
+	for _, stat := range week {
+		weekPlays[stat.Channel] = stat.Plays
+	}
+
+	baselineDays := float64(model.StatsPeriods["week"]-trendingWindow) / float64(trendingWindow)
+
+	type trend struct {
+		channel string
+		plays   int
+		score   float64
+	}
+	var trends []trend
+	for _, stat := range recent {
+		if stat.Plays < minTrendingPlays {
+			continue
+		}
+		baseline := float64(weekPlays[stat.Channel]-stat.Plays) / baselineDays
+		trends = append(trends, trend{
+			channel: stat.Channel,
+			plays:   stat.Plays,
+			score:   float64(stat.Plays) / (baseline + 1),
+		})
+	}
+
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].score != trends[j].score {
+			return trends[i].score > trends[j].score
+		}
+		if trends[i].plays != trends[j].plays {
+			return trends[i].plays > trends[j].plays
+		}
+		return trends[i].channel < trends[j].channel
+	})
+
+	ids := make([]string, 0, railSize)
+	for _, t := range trends {
+		if len(ids) == railSize {
+			break
+		}
+		ids = append(ids, t.channel)
+	}
+
+	return ids, nil
+}
+
+// mostWatchedRail ranks the channels by their watch time of the last week
+func (s *Stats) mostWatchedRail() ([]string, error) {
+	stats, err := s.stats.Top(&model.StatsQuery{
+		Since: time.Now().Add(-model.StatsPeriods["week"]),
+		Limit: railSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(stats))
+	for i, stat := range stats {
+		ids[i] = stat.Channel
+	}
+
+	return ids, nil
+}
+
+// newRail lists the working channels most recently imported
+func (s *Stats) newRail() ([]string, error) {
+	channels, err := s.channels.Find(&model.ChannelQuery{
+		OnlyWorking: true,
+		Sort:        model.ChannelSort{Field: "created", Desc: true},
+		Limit:       railSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find new channels: %w", err)
+	}
+
+	ids := make([]string, len(channels))
+	for i, channel := range channels {
+		ids[i] = channel.ID
+	}
+
+	return ids, nil
+}
+
+func railsRefresh() time.Duration {
+	if refresh := config.GetConfig().RailsRefresh; refresh > 0 {
+		return refresh
+	}
+	return defaultRailsRefresh
+}
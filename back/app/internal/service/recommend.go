@@ -0,0 +1,234 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+const (
+	defaultRecommendLimit = 4
+	maxRecommendLimit     = 24
+
+	// recommendPool is how many candidates each similarity query contributes
+	recommendPool = 50
+)
+
+// Recommendation weights. A channel sharing the language and category of the watched one
+// outranks one sharing only the language, healthy, popular and co-watched channels rise among equals.
+const (
+	languageWeight = 3.0
+	categoryWeight = 2.0
+	countryWeight  = 1.0
+	// uptimeWeight is earned in full by a channel that worked in every health check
+	uptimeWeight = 1.5
+	// coWatchWeight is earned in full by the channel most often watched along with the watched one
+	coWatchWeight = 2.5
+	// popularityWeight is earned in full by the most watched candidate
+	popularityWeight = 1.0
+	// brokenPenalty sinks channels failing their latest health check
+	brokenPenalty = 3.0
+)
+
+// recommendTarget is what recommended channels are compared to
+type recommendTarget struct {
+	channel  string
+	category string
+	country  string
+	language string
+	coWatch  map[string]float64
+}
+
+// GetRecommendedChannels ranks the channels like the one being watched. Channels score for
+// sharing its language, category and country, for their uptime and popularity and for being
+// watched along with it, so that every candidate is weighed at once rather than query by query.
+// Co-watch is counted from play events, recommending only reads.
+func (s *Stream) GetRecommendedChannels(req *model.RecommendStreamRequest) ([]*model.WatchStreamResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultRecommendLimit
+	}
+	if limit > maxRecommendLimit {
+		limit = maxRecommendLimit
+	}
+
+	target := s.recommendTarget(req)
+
+	candidates, err := s.recommendCandidates(target)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude := map[string]bool{req.Channel: true}
+	if req.ExcludeWatched {
+		for _, channel := range req.Watched {
+			exclude[channel] = true
+		}
+	}
+
+	ranked := rankRecommendations(target, candidates, exclude)
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	return s.buildChannelResponses(ranked), nil
+}
+
+// recommendTarget resolves the names of the request, falling back to the classification
+// of the watched channel
+func (s *Stream) recommendTarget(req *model.RecommendStreamRequest) *recommendTarget {
+	target := &recommendTarget{channel: req.Channel}
+
+	if channel, err := s.channels.FindByChannel(req.Channel); err == nil && channel != nil {
+		target.category = channel.Category
+		target.country = channel.Country
+		target.language = channel.Language
+	}
+
+	if req.CategoryName != "" {
+		if category, err := s.taxonomy.CategoryByName(req.CategoryName); err == nil && category != nil {
+			target.category = category.ID
+		}
+	}
+	if req.CountryName != "" {
+		if country, err := s.taxonomy.CountryByName(req.CountryName); err == nil && country != nil {
+			target.country = country.ID
+		}
+	}
+	if req.LanguageName != "" {
+		if language, err := s.taxonomy.LanguageByName(req.LanguageName); err == nil && language != nil {
+			target.language = language.ID
+		}
+	}
+
+	if coWatch, err := s.redisClient.CoWatched(req.Channel, recommendPool); err == nil {
+		target.coWatch = coWatch
+	}
+
+	return target
+}
+
+// recommendCandidates gathers the best quality channels sharing each trait of the target,
+// the channels co-watched with it and the best quality and most popular channels overall
+func (s *Stream) recommendCandidates(target *recommendTarget) ([]*model.Channel, error) {
+	queries := []*model.ChannelQuery{{}, {Sort: model.ChannelSort{Field: "popularity", Desc: true}}}
+	if target.language != "" {
+		queries = append(queries, &model.ChannelQuery{Language: target.language})
+	}
+	if target.category != "" {
+		queries = append(queries, &model.ChannelQuery{Category: target.category})
+	}
+	if target.country != "" {
+		queries = append(queries, &model.ChannelQuery{Country: target.country})
+	}
+	if len(target.coWatch) > 0 {
+		channels := make([]string, 0, len(target.coWatch))
+		for channel := range target.coWatch {
+			channels = append(channels, channel)
+		}
+		sort.Strings(channels)
+		queries = append(queries, &model.ChannelQuery{Channels: channels})
+	}
+
+	var candidates []*model.Channel
+	for _, query := range queries {
+		query.ExcludeChannel = target.channel
+		if query.Sort.Field == "" {
+			query.Sort = model.ChannelSort{Field: "quality", Desc: true}
+		}
+		query.Limit = recommendPool
+
+		channels, err := s.channels.Find(query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find recommendation candidates: %w", err)
+		}
+		candidates = append(candidates, channels...)
+	}
+
+	return candidates, nil
+}
+
+// rankRecommendations scores the candidates against the target, best first. Each channel
+// identifier is kept once, as its best scoring record. Ties go to the better quality,
+// then to the lower id, so the ranking is deterministic.
+func rankRecommendations(target *recommendTarget, candidates []*model.Channel, exclude map[string]bool) []*model.Channel {
+	type scored struct {
+		channel *model.Channel
+		score   float64
+	}
+
+	maxCoWatch := 0.0
+	for _, count := range target.coWatch {
+		maxCoWatch = max(maxCoWatch, count)
+	}
+	maxPopularity := 0.0
+	for _, channel := range candidates {
+		maxPopularity = max(maxPopularity, channel.Popularity)
+	}
+
+	best := make(map[string]*scored)
+	for _, channel := range candidates {
+		if exclude[channel.Channel] {
+			continue
+		}
+
+		candidate := &scored{channel: channel, score: recommendScore(target, channel, maxCoWatch, maxPopularity)}
+		if current, ok := best[channel.Channel]; !ok || recommendedBefore(candidate.channel, candidate.score, current.channel, current.score) {
+			best[channel.Channel] = candidate
+		}
+	}
+
+	ranked := make([]*scored, 0, len(best))
+	for _, candidate := range best {
+		ranked = append(ranked, candidate)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		return recommendedBefore(ranked[i].channel, ranked[i].score, ranked[j].channel, ranked[j].score)
+	})
+
+	channels := make([]*model.Channel, len(ranked))
+	for i, candidate := range ranked {
+		channels[i] = candidate.channel
+	}
+
+	return channels
+}
+
+func recommendScore(target *recommendTarget, channel *model.Channel, maxCoWatch, maxPopularity float64) float64 {
+	score := 0.0
+	if target.language != "" && channel.Language == target.language {
+		score += languageWeight
+	}
+	if target.category != "" && channel.Category == target.category {
+		score += categoryWeight
+	}
+	if target.country != "" && channel.Country == target.country {
+		score += countryWeight
+	}
+
+	score += uptimeWeight * channel.Uptime / 100
+	if !channel.IsWorking {
+		score -= brokenPenalty
+	}
+
+	if maxCoWatch > 0 {
+		score += coWatchWeight * target.coWatch[channel.Channel] / maxCoWatch
+	}
+	if maxPopularity > 0 {
+		score += popularityWeight * channel.Popularity / maxPopularity
+	}
+
+	return score
+}
+
+// recommendedBefore reports whether channel a with score sa ranks before channel b with score sb
+func recommendedBefore(a *model.Channel, sa float64, b *model.Channel, sb float64) bool {
+	if sa != sb {
+		return sa > sb
+	}
+	if a.QualityHeight != b.QualityHeight {
+		return a.QualityHeight > b.QualityHeight
+	}
+	return a.ID < b.ID
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+func TestGetRecommendedChannels(t *testing.T) {
+	env := newTestEnv(t)
+
+	tests := []struct {
+		name string
+		req  *model.RecommendStreamRequest
+		want []string
+	}{
+		// Same language first, then same category, healthy and popular channels rise among equals
+		{"all", &model.RecommendStreamRequest{Channel: "BFMTV.fr", Limit: 24},
+			[]string{"France24.fr", "LEquipe.fr", "Gulli.fr", "BBCNews.uk", "SkySports.uk", "CBeebies.uk"}},
+		{"default limit", &model.RecommendStreamRequest{Channel: "BFMTV.fr"},
+			[]string{"France24.fr", "LEquipe.fr", "Gulli.fr", "BBCNews.uk"}},
+		{"limit over the max", &model.RecommendStreamRequest{Channel: "BFMTV.fr", Limit: 1000},
+			[]string{"France24.fr", "LEquipe.fr", "Gulli.fr", "BBCNews.uk", "SkySports.uk", "CBeebies.uk"}},
+		{"country override", &model.RecommendStreamRequest{Channel: "BFMTV.fr", CountryName: "United Kingdom", Limit: 24},
+			[]string{"France24.fr", "BBCNews.uk", "LEquipe.fr", "Gulli.fr", "SkySports.uk", "CBeebies.uk"}},
+		{"watched kept", &model.RecommendStreamRequest{Channel: "BFMTV.fr", Watched: []string{"France24.fr"}},
+			[]string{"France24.fr", "LEquipe.fr", "Gulli.fr", "BBCNews.uk"}},
+		{"watched excluded", &model.RecommendStreamRequest{Channel: "BFMTV.fr", Watched: []string{"France24.fr"}, ExcludeWatched: true},
+			[]string{"LEquipe.fr", "Gulli.fr", "BBCNews.uk", "SkySports.uk"}},
+		// Without a known channel only uptime and popularity count
+		{"unknown channel", &model.RecommendStreamRequest{Channel: "Missing.fr", Limit: 24},
+			[]string{"BBCNews.uk", "France24.fr", "BFMTV.fr", "LEquipe.fr", "SkySports.uk", "Gulli.fr", "CBeebies.uk"}},
+	}
+	for _, tt := range tests {
+		resp, err := env.stream.GetRecommendedChannels(tt.req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := channelNames(resp); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Recommending only reads, co-watch is counted from play events
+	if len(env.redis.coWatch) != 0 {
+		t.Errorf("co-watch = %v after recommending, want none recorded", env.redis.coWatch)
+	}
+}
+
+func TestGetRecommendedChannelsCoWatch(t *testing.T) {
+	env := newTestEnv(t)
+
+	req := &model.RecommendStreamRequest{Channel: "Gulli.fr", Limit: 24}
+	resp, err := env.stream.GetRecommendedChannels(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := channelNames(resp), []string{"France24.fr", "BFMTV.fr", "LEquipe.fr", "BBCNews.uk", "SkySports.uk", "CBeebies.uk"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// Sessions switching from Gulli.fr to SkySports.uk raise it above BBCNews.uk
+	for _, session := range []string{"session-0001", "session-0002"} {
+		for _, channel := range []string{"Gulli.fr", "SkySports.uk"} {
+			if err := env.stats.RecordPlayEvent(&model.PlayEventRequest{Event: model.PlayEventStart, Session: session, Channel: channel}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	resp, err = env.stream.GetRecommendedChannels(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := channelNames(resp), []string{"France24.fr", "BFMTV.fr", "LEquipe.fr", "SkySports.uk", "BBCNews.uk", "CBeebies.uk"}; !slices.Equal(got, want) {
+		t.Errorf("with co-watch got %v, want %v", got, want)
+	}
+}
+
+func TestRankRecommendationsDeduplicates(t *testing.T) {
+	env := newTestEnv(t)
+
+	// A second, worse record of France24.fr is recommended once, as the better record
+	env.channels.Add(&model.Channel{ID: "ch9", Channel: "France24.fr", Title: "France 24", URL: "https://upstream.example/ch9/index.m3u8",
+		Quality: "q1", QualityHeight: 480, Category: "news", Country: "fr", Language: "fra", Uptime: 50, IsWorking: true})
+
+	resp, err := env.stream.GetRecommendedChannels(&model.RecommendStreamRequest{Channel: "BFMTV.fr", Limit: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := channelNames(resp); slices.Index(got, "France24.fr") != 0 || slices.Index(got[1:], "France24.fr") != -1 {
+		t.Errorf("got %v, want France24.fr first and once", got)
+	}
+	if resp[0].Quality != "1080p" {
+		t.Errorf("France24.fr recommended in %s, want its 1080p record", resp[0].Quality)
+	}
+}
@@ -1,12 +1,15 @@
 package service
 
 import (
+	"io"
 	"log"
 
 	"github.com/pocketbase/pocketbase"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
 	redisClient "gitlab.yurtal.tech/company/blitz/business-card/back/internal/redis"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/token"
 )
 
 type AuthorizationI interface {
@@ -15,8 +18,9 @@ type AuthorizationI interface {
 
 type StreamI interface {
 	WatchStream(req *model.WatchStreamRequest) (*model.WatchStreamResponse, error)
-	GetFeaturedChannels() ([]*model.WatchStreamResponse, error)
+	GetFeaturedChannels(countryName string) ([]*model.WatchStreamResponse, error)
 	GetChannelByName(channelName string) (*model.WatchStreamResponse, error)
+	GetChannelGuide(req *model.ChannelGuideRequest) (*model.ChannelGuideResponse, error)
 	GetChannelsByCategory(categoryName string) ([]*model.WatchStreamResponse, error)
 	GetRecommendedChannels(req *model.RecommendStreamRequest) ([]*model.WatchStreamResponse, error)
 	GetAllStreams(req *model.AllStreamsRequest) (*model.AllStreamsResponse, error)
@@ -25,16 +29,38 @@ type StreamI interface {
 	GetLanguages() ([]string, error)
 	SearchStreams(req *model.SearchStreamRequest) (*model.SearchStreamResponse, error)
 	PlayStream(req *model.PlayStreamRequest) (*model.PlayStreamResponse, error)
+	GetPlaylistChannels(req *model.PlaylistRequest) ([]*model.WatchStreamResponse, error)
+	GetGuideChannels(req *model.GuideRequest) ([]*model.GuideChannel, error)
+	WriteGuide(w io.Writer, channels []*model.GuideChannel) error
+	ProxyHLS(req *model.HLSProxyRequest) (*model.HLSProxyResponse, error)
+	InvalidateLookups(collection string)
+	RevokeChannelTokens(channelID string) error
+	ListFeatured() ([]*model.FeaturedResponse, error)
+	CreateFeatured(req *model.FeaturedRequest) (*model.FeaturedResponse, error)
+	UpdateFeatured(id string, req *model.FeaturedRequest) (*model.FeaturedResponse, error)
+	DeleteFeatured(id string) error
+	ReorderFeatured(req *model.FeaturedOrderRequest) ([]*model.FeaturedResponse, error)
+}
+
+type StatsI interface {
+	RecordPlayEvent(req *model.PlayEventRequest) error
+	TopChannels(req *model.TopChannelsRequest) ([]*model.ChannelStatsResponse, error)
+	LiveViewers(limit int) (*model.LiveViewersResponse, error)
+	ChannelStats(channelName, period string) (*model.ChannelStatsResponse, error)
+	Rollup() (map[string]int, error)
+	Rail(kind string) ([]*model.WatchStreamResponse, error)
 }
 
 type I interface {
 	Authorization() AuthorizationI
 	Stream() StreamI
+	Stats() StatsI
 }
 
 type service struct {
 	AuthorizationI
 	StreamI
+	StatsI
 }
 
 func (s *service) Authorization() AuthorizationI {
@@ -45,6 +71,10 @@ func (s *service) Stream() StreamI {
 	return s.StreamI
 }
 
+func (s *service) Stats() StatsI {
+	return s.StatsI
+}
+
 func NewService(app *pocketbase.PocketBase) I {
 	// Initialize Redis client
 	cfg := config.GetConfig()
@@ -53,8 +83,25 @@ func NewService(app *pocketbase.PocketBase) I {
 		log.Fatalf("Failed to initialize Redis client: %v", err)
 	}
 
+	keys, err := token.ParseKeys(cfg.StreamTokenKeys)
+	if err != nil {
+		log.Fatalf("Invalid STREAM_TOKEN_KEYS: %v", err)
+	}
+	if len(keys) == 0 {
+		log.Println("STREAM_TOKEN_KEYS is not set, stream tokens are signed with a random key and won't survive a restart")
+		keys = append(keys, token.RandomKey())
+	}
+	signer, err := token.NewSigner(keys)
+	if err != nil {
+		log.Fatalf("Failed to initialize stream token signer: %v", err)
+	}
+
+	repo := repository.NewRepository(app.DB())
+	stream := NewStream(repo.Channel(), repo.Taxonomy(), repo.Featured(), repo.Search(), repo.Programme(), redis, signer)
+
 	return &service{
 		AuthorizationI: NewAuthorizationS(app),
-		StreamI:        NewStream(app, redis),
+		StreamI:        stream,
+		StatsI:         NewStats(stream, repo.Channel(), repo.Stats(), redis),
 	}
 }
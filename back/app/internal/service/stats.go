@@ -0,0 +1,338 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/apperror"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
+)
+
+const (
+	// viewerTimeout is how long a viewer counts as watching after its last event.
+	// Players send a heartbeat every 30 seconds or so.
+	viewerTimeout = 90 * time.Second
+
+	// maxHeartbeatGap caps the watch time a single event adds, so that a player coming
+	// back after a long pause doesn't count the pause as watched
+	maxHeartbeatGap = viewerTimeout
+
+	// sessionTTL is how long the last channel of a session is remembered for co-watch
+	sessionTTL = 6 * time.Hour
+
+	defaultStatsPeriod = "week"
+	defaultStatsLimit  = 10
+	maxStatsLimit      = 100
+)
+
+// sessionRegex accepts the random ids players use for their viewing sessions
+var sessionRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{8,64}$`)
+
+// StatsClientI buffers viewing events in Redis
+type StatsClientI interface {
+	TouchViewer(channelID, session string, at time.Time) (time.Time, error)
+	RemoveViewer(channelID, session string) error
+	CountViewers(channelID string, since time.Time) (int64, error)
+	LiveViewers(since time.Time) (map[string]int64, error)
+	SwapSessionChannel(session, channel string, ttl time.Duration) (string, error)
+	RecordCoWatch(channel string, others []string) error
+	AddHourlyStats(hour time.Time, channelID string, plays, seconds, viewers int64) error
+	PendingStatsHours() ([]time.Time, error)
+	HourlyStats(hour time.Time) ([]*model.ChannelStatsEntity, error)
+	DeleteHourlyStats(hour time.Time) error
+	GetRail(kind string) ([]string, bool, error)
+	StoreRail(kind string, ids []string, ttl time.Duration) error
+}
+
+// Stats records what is watched. Events are counted in Redis per hour and rolled up
+// into the channel_stats collection once the hour is over.
+type Stats struct {
+	stream      *Stream
+	channels    repository.ChannelRepository
+	stats       repository.StatsRepository
+	redisClient StatsClientI
+}
+
+func NewStats(
+	stream *Stream,
+	channels repository.ChannelRepository,
+	stats repository.StatsRepository,
+	redisClient StatsClientI,
+) *Stats {
+	return &Stats{
+		stream:      stream,
+		channels:    channels,
+		stats:       stats,
+		redisClient: redisClient,
+	}
+}
+
+// RecordPlayEvent counts a play event. A start counts a play, every event adds the time
+// since the previous one of the session as watch time and keeps the session a live viewer
+// until it stops or times out.
+func (s *Stats) RecordPlayEvent(req *model.PlayEventRequest) error {
+	if !sessionRegex.MatchString(req.Session) {
+		return apperror.ClientError(fmt.Errorf("invalid session"), http.StatusBadRequest)
+	}
+	switch req.Event {
+	case model.PlayEventStart, model.PlayEventHeartbeat, model.PlayEventStop:
+	default:
+		return apperror.ClientError(fmt.Errorf("invalid event %q", req.Event), http.StatusBadRequest)
+	}
+
+	channel, err := s.channels.FindByChannel(req.Channel)
+	if err != nil || channel == nil || channel.IsRetired {
+		return apperror.ClientError(fmt.Errorf("channel not found"), http.StatusNotFound)
+	}
+
+	now := time.Now()
+	hour := now.UTC().Truncate(time.Hour)
+
+	last, err := s.redisClient.TouchViewer(channel.ID, req.Session, now)
+	if err != nil {
+		return apperror.SystemError(err)
+	}
+
+	var plays, seconds int64
+	if req.Event == model.PlayEventStart {
+		plays = 1
+	}
+	if !last.IsZero() {
+		seconds = int64(min(now.Sub(last), maxHeartbeatGap) / time.Second)
+	}
+
+	if req.Event == model.PlayEventStop {
+		if err := s.redisClient.RemoveViewer(channel.ID, req.Session); err != nil {
+			return apperror.SystemError(err)
+		}
+	}
+
+	viewers, err := s.redisClient.CountViewers(channel.ID, now.Add(-viewerTimeout))
+	if err != nil {
+		return apperror.SystemError(err)
+	}
+
+	if err := s.redisClient.AddHourlyStats(hour, channel.ID, plays, seconds, viewers); err != nil {
+		return apperror.SystemError(err)
+	}
+
+	// Channels a session plays one after another are watched together
+	if req.Event == model.PlayEventStart {
+		previous, err := s.redisClient.SwapSessionChannel(req.Session, channel.Channel, sessionTTL)
+		if err == nil && previous != "" && previous != channel.Channel {
+			_ = s.redisClient.RecordCoWatch(channel.Channel, []string{previous})
+		}
+	}
+
+	return nil
+}
+
+// Rollup moves the stats of the hours that are over from Redis into channel_stats,
+// then refreshes the popularity of the channels from the watch time of the window.
+// The buffer of an hour that is over holds its totals and they replace those stored,
+// so an hour whose buffer failed to be dropped is rolled up again without being counted twice.
+func (s *Stats) Rollup() (map[string]int, error) {
+	hours, err := s.redisClient.PendingStatsHours()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+
+	counts := map[string]int{"hours": 0, "stats": 0}
+	current := time.Now().UTC().Truncate(time.Hour)
+	for _, hour := range hours {
+		if !hour.Before(current) {
+			continue
+		}
+
+		stats, err := s.redisClient.HourlyStats(hour)
+		if err != nil {
+			return counts, err
+		}
+		if err := s.stats.SaveHourly(stats); err != nil {
+			return counts, err
+		}
+		if err := s.redisClient.DeleteHourlyStats(hour); err != nil {
+			return counts, err
+		}
+
+		counts["hours"]++
+		counts["stats"] += len(stats)
+	}
+
+	updated, err := s.stats.UpdatePopularity(time.Now().Add(-popularityWindow()))
+	if err != nil {
+		return counts, err
+	}
+	counts["popularity"] = updated
+
+	return counts, nil
+}
+
+// TopChannels returns the most watched channels of a period, optionally of a category,
+// country and language. Only rolled up hours count.
+func (s *Stats) TopChannels(req *model.TopChannelsRequest) ([]*model.ChannelStatsResponse, error) {
+	since, err := statsSince(req.Period)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &model.StatsQuery{
+		Since: since,
+		Limit: statsLimit(req.Limit),
+	}
+
+	catalog := s.stream.catalogQuery(req.Category, req.Country, req.Language)
+	query.Category = catalog.Category
+	query.Country = catalog.Country
+	query.Language = catalog.Language
+
+	stats, err := s.stats.Top(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Live viewers only complement the ranking, it is returned without them if Redis fails
+	viewers, _ := s.redisClient.LiveViewers(time.Now().Add(-viewerTimeout))
+
+	return s.statsResponses(stats, viewers)
+}
+
+// LiveViewers counts the viewers watching right now, listing the channels with the most
+func (s *Stats) LiveViewers(limit int) (*model.LiveViewersResponse, error) {
+	viewers, err := s.redisClient.LiveViewers(time.Now().Add(-viewerTimeout))
+	if err != nil {
+		return nil, apperror.SystemError(err)
+	}
+
+	response := &model.LiveViewersResponse{}
+	stats := make([]*model.ChannelStatsEntity, 0, len(viewers))
+	for channelID, count := range viewers {
+		response.Viewers += int(count)
+		stats = append(stats, &model.ChannelStatsEntity{Channel: channelID})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if viewers[stats[i].Channel] != viewers[stats[j].Channel] {
+			return viewers[stats[i].Channel] > viewers[stats[j].Channel]
+		}
+		return stats[i].Channel < stats[j].Channel
+	})
+	if limit = statsLimit(limit); len(stats) > limit {
+		stats = stats[:limit]
+	}
+
+	response.Channels, err = s.statsResponses(stats, viewers)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// ChannelStats returns the viewing of a channel over a period and its live viewers
+func (s *Stats) ChannelStats(channelName, period string) (*model.ChannelStatsResponse, error) {
+	since, err := statsSince(period)
+	if err != nil {
+		return nil, err
+	}
+
+	channel, err := s.channels.FindByChannel(channelName)
+	if err != nil || channel == nil || channel.IsRetired {
+		return nil, apperror.ClientError(fmt.Errorf("channel not found"), http.StatusNotFound)
+	}
+
+	stats, err := s.stats.Top(&model.StatsQuery{Since: since, ChannelID: channel.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	viewers, err := s.redisClient.CountViewers(channel.ID, time.Now().Add(-viewerTimeout))
+	if err != nil {
+		return nil, apperror.SystemError(err)
+	}
+
+	response := &model.ChannelStatsResponse{
+		Channel: s.stream.buildChannelResponse(channel),
+		Viewers: int(viewers),
+	}
+	if len(stats) > 0 {
+		response.Plays = stats[0].Plays
+		response.WatchSeconds = stats[0].WatchSeconds
+		response.PeakViewers = stats[0].PeakViewers
+	}
+
+	return response, nil
+}
+
+// statsResponses pairs the stats with their channels and live viewers, keeping their order.
+// Stats of channels that no longer exist are left out.
+func (s *Stats) statsResponses(stats []*model.ChannelStatsEntity, viewers map[string]int64) ([]*model.ChannelStatsResponse, error) {
+	ids := make([]string, len(stats))
+	for i, stat := range stats {
+		ids[i] = stat.Channel
+	}
+
+	found, err := s.channels.FindByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*model.Channel, len(found))
+	for _, channel := range found {
+		byID[channel.ID] = channel
+	}
+
+	var channels []*model.Channel
+	var kept []*model.ChannelStatsEntity
+	for _, stat := range stats {
+		if channel, ok := byID[stat.Channel]; ok && !channel.IsRetired {
+			channels = append(channels, channel)
+			kept = append(kept, stat)
+		}
+	}
+
+	responses := make([]*model.ChannelStatsResponse, len(kept))
+	for i, channel := range s.stream.buildChannelResponses(channels) {
+		responses[i] = &model.ChannelStatsResponse{
+			Channel:      channel,
+			Plays:        kept[i].Plays,
+			WatchSeconds: kept[i].WatchSeconds,
+			PeakViewers:  kept[i].PeakViewers,
+			Viewers:      int(viewers[kept[i].Channel]),
+		}
+	}
+
+	return responses, nil
+}
+
+func statsSince(period string) (time.Time, error) {
+	if period == "" {
+		period = defaultStatsPeriod
+	}
+
+	length, ok := model.StatsPeriods[period]
+	if !ok {
+		return time.Time{}, apperror.ClientError(fmt.Errorf("invalid period %q", period), http.StatusBadRequest)
+	}
+
+	return time.Now().Add(-length), nil
+}
+
+func statsLimit(limit int) int {
+	if limit <= 0 {
+		return defaultStatsLimit
+	}
+	return min(limit, maxStatsLimit)
+}
+
+// popularityWindow is the watch time period channel popularity is computed over
+func popularityWindow() time.Duration {
+	if window := config.GetConfig().PopularityWindow; window > 0 {
+		return window
+	}
+	return model.StatsPeriods[defaultStatsPeriod]
+}
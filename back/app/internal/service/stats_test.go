@@ -0,0 +1,135 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+)
+
+func TestRecordPlayEvent(t *testing.T) {
+	env := newTestEnv(t)
+
+	tests := []struct {
+		name string
+		req  *model.PlayEventRequest
+		want int
+	}{
+		{"invalid session", &model.PlayEventRequest{Event: model.PlayEventStart, Session: "short", Channel: "France24.fr"}, http.StatusBadRequest},
+		{"invalid event", &model.PlayEventRequest{Event: "pause", Session: "session-0001", Channel: "France24.fr"}, http.StatusBadRequest},
+		{"missing channel", &model.PlayEventRequest{Event: model.PlayEventStart, Session: "session-0001", Channel: "Missing.fr"}, http.StatusNotFound},
+		{"retired channel", &model.PlayEventRequest{Event: model.PlayEventStart, Session: "session-0001", Channel: "Old.fr"}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if err := env.stats.RecordPlayEvent(tt.req); statusCode(err) != tt.want {
+			t.Errorf("%s: got %v, want a %d error", tt.name, err, tt.want)
+		}
+	}
+
+	for _, req := range []*model.PlayEventRequest{
+		{Event: model.PlayEventStart, Session: "session-0001", Channel: "France24.fr"},
+		{Event: model.PlayEventStart, Session: "session-0002", Channel: "France24.fr"},
+		{Event: model.PlayEventStart, Session: "session-0001", Channel: "BBCNews.uk"},
+	} {
+		if err := env.stats.RecordPlayEvent(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hour := time.Now().UTC().Truncate(time.Hour)
+	stats, _ := env.redis.HourlyStats(hour)
+	plays := make(map[string]int)
+	for _, s := range stats {
+		plays[s.Channel] = s.Plays
+	}
+	if plays["ch1"] != 2 || plays["ch4"] != 1 {
+		t.Errorf("plays = %v, want 2 of ch1 and 1 of ch4", plays)
+	}
+
+	// The session played BBCNews.uk after France24.fr
+	coWatched, _ := env.redis.CoWatched("BBCNews.uk", 10)
+	if coWatched["France24.fr"] != 1 {
+		t.Errorf("co-watched with BBCNews.uk = %v, want France24.fr once", coWatched)
+	}
+
+	live, err := env.stats.LiveViewers(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live.Viewers != 3 || len(live.Channels) != 2 || live.Channels[0].Channel.Channel != "France24.fr" {
+		t.Errorf("live viewers = %d on %d channels, want 3 on 2, France24.fr first", live.Viewers, len(live.Channels))
+	}
+
+	if err := env.stats.RecordPlayEvent(&model.PlayEventRequest{Event: model.PlayEventStop, Session: "session-0002", Channel: "France24.fr"}); err != nil {
+		t.Fatal(err)
+	}
+	if viewers, _ := env.redis.CountViewers("ch1", time.Now().Add(-viewerTimeout)); viewers != 1 {
+		t.Errorf("viewers of ch1 after a stop = %d, want 1", viewers)
+	}
+}
+
+func TestRollup(t *testing.T) {
+	env := newTestEnv(t)
+
+	current := time.Now().UTC().Truncate(time.Hour)
+	previous := current.Add(-time.Hour)
+	for _, hour := range []time.Time{previous, current} {
+		if err := env.redis.AddHourlyStats(hour, "ch2", 2, 600, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := env.redis.AddHourlyStats(previous, "ch5", 1, 1200, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := env.stats.Rollup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["hours"] != 1 || counts["stats"] != 2 {
+		t.Errorf("rolled up %v, want the 2 stats of the hour that is over", counts)
+	}
+	if hours, _ := env.redis.PendingStatsHours(); len(hours) != 1 || !hours[0].Equal(current) {
+		t.Errorf("pending hours = %v, want only the current hour", hours)
+	}
+
+	// An hour rolled up again, as when its buffer failed to be dropped, isn't counted twice
+	if err := env.redis.AddHourlyStats(previous, "ch2", 2, 600, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.redis.AddHourlyStats(previous, "ch5", 1, 1200, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.stats.Rollup(); err != nil {
+		t.Fatal(err)
+	}
+
+	top, err := env.stats.TopChannels(&model.TopChannelsRequest{Period: "day"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0].Channel.Channel != "SkySports.uk" || top[0].WatchSeconds != 1200 || top[1].Plays != 2 {
+		t.Errorf("top channels = %+v, want SkySports.uk then BFMTV.fr", top)
+	}
+
+	// Popularity is the watch time of the window, the channels no longer watched drop to 0
+	for id, want := range map[string]float64{"ch2": 600, "ch5": 1200, "ch4": 0} {
+		channel, _ := env.channels.FindByID(id)
+		if channel.Popularity != want {
+			t.Errorf("popularity of %s = %v, want %v", id, channel.Popularity, want)
+		}
+	}
+
+	stats, err := env.stats.ChannelStats("BFMTV.fr", "week")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Plays != 2 || stats.WatchSeconds != 600 || stats.PeakViewers != 2 {
+		t.Errorf("stats of BFMTV.fr = %+v, want 2 plays, 600 seconds, 2 viewers", stats)
+	}
+
+	if _, err := env.stats.TopChannels(&model.TopChannelsRequest{Period: "year"}); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("unknown period = %v, want a 400 error", err)
+	}
+}
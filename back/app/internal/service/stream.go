@@ -1,529 +1,568 @@
 package service
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"path"
+	"regexp"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/pocketbase/pocketbase"
-	"github.com/pocketbase/pocketbase/core"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/apperror"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
 	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/token"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/pkg/hls"
 )
 
-// Note: strings, core, and config are used in GetFeaturedChannels and buildChannelResponse methods
+const (
+	// hlsIndexResource is the proxy resource name of the playlist a token points to
+	hlsIndexResource = "index"
+
+	// defaultStreamTokenTTL is how long stream tokens stay valid when STREAM_TOKEN_TTL isn't set
+	defaultStreamTokenTTL = 2 * time.Hour
+
+	// defaultPlaylistTokenTTL is how long playlist URLs stay valid when PLAYLIST_TOKEN_TTL isn't set
+	defaultPlaylistTokenTTL = 24 * time.Hour
+
+	// maxPlaylistSize caps how much of an upstream playlist the proxy reads
+	maxPlaylistSize = 4 * 1024 * 1024
+
+	// defaultUserAgent is sent upstream for channels without a user_agent of their own
+	defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64)"
+)
+
+// proxyMediaTypes are the content types the proxy passes through from upstream. Anything else,
+// HTML or scripts above all, is served as application/octet-stream, as the proxy shares its
+// origin with the admin UI.
+var proxyMediaTypes = map[string]bool{
+	"application/vnd.apple.mpegurl": true,
+	"application/x-mpegurl":         true,
+	"audio/mpegurl":                 true,
+	"audio/x-mpegurl":               true,
+	"video/mp2t":                    true,
+	"video/mpeg":                    true,
+	"video/mp4":                     true,
+	"video/iso.segment":             true,
+	"audio/mp4":                     true,
+	"audio/aac":                     true,
+	"audio/mpeg":                    true,
+	"application/mp4":               true,
+	"text/vtt":                      true,
+	"application/octet-stream":      true,
+}
+
+// proxyExtRegex limits the extensions copied from upstream URLs into proxy URLs
+var proxyExtRegex = regexp.MustCompile(`^\.[A-Za-z0-9]{1,5}$`)
 
 // RedisClientI interface for Redis operations
 type RedisClientI interface {
-	GenerateURLToken(url string) (string, error)
-	GetURLByToken(token string) (string, error)
-	DeleteToken(token string) error
+	StoreProxyURLs(token string, urls []string, ttl time.Duration) (map[string]string, error)
+	GetProxyURL(token, key string) (string, error)
+	UseToken(id string, ttl time.Duration) (int64, error)
+	RevokeChannelTokens(channelID string, ttl time.Duration) error
+	ChannelTokensRevokedAt(channelID string) (time.Time, error)
+	CoWatched(channel string, limit int) (map[string]float64, error)
 }
 
 type Stream struct {
-	app         *pocketbase.PocketBase
+	channels    repository.ChannelRepository
+	taxonomy    repository.TaxonomyRepository
+	featured    repository.FeaturedRepository
+	search      repository.SearchRepository
+	programmes  repository.ProgrammeRepository
 	redisClient RedisClientI
+	signer      *token.Signer
+	httpClient  *http.Client
+	lookups     *lookups
 }
 
-func NewStream(app *pocketbase.PocketBase, redisClient RedisClientI) *Stream {
+func NewStream(
+	channels repository.ChannelRepository,
+	taxonomy repository.TaxonomyRepository,
+	featured repository.FeaturedRepository,
+	search repository.SearchRepository,
+	programmes repository.ProgrammeRepository,
+	redisClient RedisClientI,
+	signer *token.Signer,
+) *Stream {
 	return &Stream{
-		app:         app,
+		channels:    channels,
+		taxonomy:    taxonomy,
+		featured:    featured,
+		search:      search,
+		programmes:  programmes,
 		redisClient: redisClient,
+		signer:      signer,
+		lookups:     newLookups(taxonomy),
+		httpClient:  newProxyClient(),
 	}
 }
 
-func (s *Stream) WatchStream(req *model.WatchStreamRequest) (*model.WatchStreamResponse, error) {
-	filter := fmt.Sprintf("id = '%s'", req.ChannelID)
+// newProxyClient builds the client of the HLS proxy. Upstream playlists can point anywhere,
+// so the client only connects to public addresses, checked after DNS resolution,
+// and only follows redirects to http(s) URLs. Environment proxies are not used, the checks
+// must apply to the upstream itself.
+func newProxyClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: publicAddressControl,
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   10,
+			IdleConnTimeout:       30 * time.Second,
+			ResponseHeaderTimeout: 15 * time.Second,
+		},
+		CheckRedirect: checkProxyRedirect,
+	}
+}
 
-	record, err := s.app.FindFirstRecordByFilter("channels", filter)
+// publicAddressControl refuses connections to loopback, private, link-local and other
+// non-public addresses, like the cloud metadata service at 169.254.169.254
+func publicAddressControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find channel: %w", err)
+		return err
 	}
 
-	if record == nil {
-		return nil, fmt.Errorf("channel not found")
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("invalid upstream address %q", address)
+	}
+	if !isPublicAddr(addr) {
+		return fmt.Errorf("upstream address %s is not public", addr)
 	}
 
-	actualURL := record.GetString("url")
-	if actualURL == "" {
-		return nil, fmt.Errorf("channel url is empty")
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, private in practice
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// checkProxyRedirect checks redirect targets again: only http(s) URLs to hosts that are not
+// literally non-public addresses. Hostnames are checked when the connection is dialed.
+func checkProxyRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
 	}
 
-	// Generate token for the URL
-	token, err := s.redisClient.GenerateURLToken(actualURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate URL token: %w", err)
+	host := req.URL.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("redirect to %s is not allowed", host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !isPublicAddr(addr) {
+		return fmt.Errorf("redirect to %s is not allowed", host)
 	}
 
-	title := record.GetString("title")
-	if title == "" {
-		return nil, fmt.Errorf("channel title is empty")
+	return nil
+}
+
+// streamTokenTTL is how long a stream token and its proxied URLs stay valid
+func streamTokenTTL() time.Duration {
+	if ttl := config.GetConfig().StreamTokenTTL; ttl > 0 {
+		return ttl
 	}
+	return defaultStreamTokenTTL
+}
 
-	channel := record.GetString("channel")
+func playlistTokenTTL() time.Duration {
+	if ttl := config.GetConfig().PlaylistTokenTTL; ttl > 0 {
+		return ttl
+	}
+	return defaultPlaylistTokenTTL
+}
 
-	// Get the quality value from the relation field
-	qualityValue := ""
-	qualityID := record.GetString("quality")
-	if qualityID != "" {
-		qualityRecord, err := s.app.FindRecordById("qualities", qualityID)
-		if err == nil && qualityRecord != nil {
-			qualityValue = qualityRecord.GetString("quality")
-		}
+// streamSource builds the upstream stream description of a channel
+func streamSource(channel *model.Channel) *model.StreamSource {
+	return &model.StreamSource{
+		ChannelID: channel.ID,
+		URL:       channel.URL,
+		UserAgent: channel.UserAgent,
+		Referrer:  channel.Referrer,
 	}
+}
 
-	// Get logo data
-	var logo *model.Logo
-	logoID := record.GetString("logo")
-	if logoID != "" {
-		logoRecord, err := s.app.FindRecordById("logos", logoID)
-		if err == nil && logoRecord != nil {
-			logo = &model.Logo{
-				URL:    logoRecord.GetString("logo_url"),
-				Width:  logoRecord.GetFloat("width"),
-				Height: logoRecord.GetFloat("height"),
-			}
-		}
+func (s *Stream) WatchStream(req *model.WatchStreamRequest) (*model.WatchStreamResponse, error) {
+	channel, err := s.channels.FindByID(req.ChannelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find channel: %w", err)
 	}
 
-	// Get category data
-	var category *model.Category
-	categoryID := record.GetString("category")
-	if categoryID != "" {
-		categoryRecord, err := s.app.FindRecordById("categories", categoryID)
-		if err == nil && categoryRecord != nil {
-			category = &model.Category{
-				Name1: categoryRecord.GetString("name_1"),
-				Name2: categoryRecord.GetString("name_2"),
-				Name3: categoryRecord.GetString("name_3"),
-			}
-		}
+	if channel == nil {
+		return nil, fmt.Errorf("channel not found")
 	}
 
-	// Get country data
-	var country *model.Country
-	countryID := record.GetString("country")
-	if countryID != "" {
-		countryRecord, err := s.app.FindRecordById("countries", countryID)
-		if err == nil && countryRecord != nil {
-			country = &model.Country{
-				Name: countryRecord.GetString("name"),
-			}
-		}
+	if channel.URL == "" {
+		return nil, fmt.Errorf("channel url is empty")
 	}
 
-	// Get language data
-	var language *model.Language
-	languageID := record.GetString("language")
-	if languageID != "" {
-		languageRecord, err := s.app.FindRecordById("languages", languageID)
-		if err == nil && languageRecord != nil {
-			language = &model.Language{
-				Name: languageRecord.GetString("name"),
-			}
-		}
+	if channel.Title == "" {
+		return nil, fmt.Errorf("channel title is empty")
 	}
 
-	return &model.WatchStreamResponse{
-		Channel:  channel,
-		URL:      token,
-		Quality:  qualityValue,
-		Title:    title,
-		Logo:     logo,
-		Category: category,
-		Country:  country,
-		Language: language,
-	}, nil
+	// Described like in every listing, with a stream token as URL
+	response := s.buildChannelResponse(channel)
+	if response.URL == "" {
+		return nil, fmt.Errorf("failed to generate URL token")
+	}
+
+	return response, nil
 }
 
-// buildChannelResponse is a helper method to build a WatchStreamResponse from a channel record
-func (s *Stream) buildChannelResponse(record *core.Record) *model.WatchStreamResponse {
-	channel := record.GetString("channel")
-	actualURL := record.GetString("url")
-	title := record.GetString("title")
+// buildChannelResponse is a helper method to build a WatchStreamResponse from a channel
+func (s *Stream) buildChannelResponse(channel *model.Channel) *model.WatchStreamResponse {
+	return s.buildChannelResponses([]*model.Channel{channel})[0]
+}
 
-	// Generate token for the URL
-	token, err := s.redisClient.GenerateURLToken(actualURL)
-	if err != nil {
-		// If Redis fails, we need to handle this - don't return empty token
-		// Log the error and return the actual URL as fallback
-		// This ensures playback works even if Redis is temporarily unavailable
-		token = actualURL
-	}
-
-	// Return token instead of actual URL
-	url := token
-
-	// Get the quality value from the relation field
-	qualityValue := ""
-	qualityID := record.GetString("quality")
-	if qualityID != "" {
-		qualityRecord, err := s.app.FindRecordById("qualities", qualityID)
-		if err == nil && qualityRecord != nil {
-			qualityValue = qualityRecord.GetString("quality")
-		}
-	}
+// buildChannelResponses builds the responses of a page of channels, with signed stream
+// tokens as URLs
+func (s *Stream) buildChannelResponses(channels []*model.Channel) []*model.WatchStreamResponse {
+	return s.buildResponses(channels, func(channel *model.Channel) (string, error) {
+		return s.signer.Sign(channel.ID, token.ScopeList, streamTokenTTL(), nil)
+	})
+}
 
-	// Get logo data
-	var logo *model.Logo
-	logoID := record.GetString("logo")
-	if logoID != "" {
-		logoRecord, err := s.app.FindRecordById("logos", logoID)
-		if err == nil && logoRecord != nil {
-			logo = &model.Logo{
-				URL:    logoRecord.GetString("logo_url"),
-				Width:  logoRecord.GetFloat("width"),
-				Height: logoRecord.GetFloat("height"),
-			}
-		}
+// buildResponses builds the responses of a page of channels. Logos and now/next are
+// loaded with one query each, the other relations come from the lookup cache, and the URLs
+// are made by channelURL. A channel whose URL can't be made gets an empty URL,
+// the upstream URL is never exposed.
+func (s *Stream) buildResponses(channels []*model.Channel, channelURL func(channel *model.Channel) (string, error)) []*model.WatchStreamResponse {
+	if len(channels) == 0 {
+		return nil
 	}
 
-	// Get category data
-	var category *model.Category
-	categoryID := record.GetString("category")
-	if categoryID != "" {
-		categoryRecord, err := s.app.FindRecordById("categories", categoryID)
-		if err == nil && categoryRecord != nil {
-			category = &model.Category{
-				Name1: categoryRecord.GetString("name_1"),
-				Name2: categoryRecord.GetString("name_2"),
-				Name3: categoryRecord.GetString("name_3"),
-			}
+	logos := s.findLogos(channels)
+
+	responses := make([]*model.WatchStreamResponse, len(channels))
+	for i, channel := range channels {
+		url, err := channelURL(channel)
+		if err != nil {
+			url = ""
 		}
+		responses[i] = s.channelResponse(channel, url, logos[channel.Logo])
 	}
 
-	// Get country data
-	var country *model.Country
-	countryID := record.GetString("country")
-	if countryID != "" {
-		countryRecord, err := s.app.FindRecordById("countries", countryID)
-		if err == nil && countryRecord != nil {
-			country = &model.Country{
-				Name: countryRecord.GetString("name"),
-			}
+	s.attachNowNext(responses)
+
+	return responses
+}
+
+// findLogos loads the logos of the channels, indexed by id
+func (s *Stream) findLogos(channels []*model.Channel) map[string]*model.LogoEntity {
+	var ids []string
+	for _, channel := range channels {
+		if channel.Logo != "" {
+			ids = append(ids, channel.Logo)
 		}
 	}
 
-	// Get language data
-	var language *model.Language
-	languageID := record.GetString("language")
-	if languageID != "" {
-		languageRecord, err := s.app.FindRecordById("languages", languageID)
-		if err == nil && languageRecord != nil {
-			language = &model.Language{
-				Name: languageRecord.GetString("name"),
-			}
-		}
+	logos := make(map[string]*model.LogoEntity, len(ids))
+	if len(ids) == 0 {
+		return logos
 	}
 
-	return &model.WatchStreamResponse{
-		Channel:  channel,
-		URL:      url,
-		Quality:  qualityValue,
-		Title:    title,
-		Logo:     logo,
-		Category: category,
-		Country:  country,
-		Language: language,
-	}
-}
-
-// GetFeaturedChannels retrieves featured channels from the database
-func (s *Stream) GetFeaturedChannels() ([]*model.WatchStreamResponse, error) {
-	// Query the featured table to get all featured records
-	featuredRecords, err := s.app.FindRecordsByFilter(
-		"featured",
-		"",         // empty filter to get all records
-		"-created", // sort by created date, newest first
-		0,          // limit (0 = no limit)
-		0,          // offset
-	)
+	logoEntities, err := s.channels.FindLogos(ids)
 	if err != nil {
-		return nil, err
+		return logos
+	}
+	for _, logo := range logoEntities {
+		logos[logo.ID] = logo
 	}
 
-	var responses []*model.WatchStreamResponse
+	return logos
+}
+
+// channelResponse maps a channel and its relations to the API response
+func (s *Stream) channelResponse(channel *model.Channel, url string, logo *model.LogoEntity) *model.WatchStreamResponse {
+	response := &model.WatchStreamResponse{
+		Channel: channel.Channel,
+		URL:     url,
+		Title:   channel.Title,
+	}
+
+	if quality := s.lookups.quality(channel.Quality); quality != nil {
+		response.Quality = quality.Quality
+	}
 
-	for _, featuredRecord := range featuredRecords {
-		// Get the channel ID from the relation field
-		channelID := featuredRecord.GetString("channel")
-		if channelID == "" {
-			continue
+	if logo != nil {
+		response.Logo = &model.Logo{
+			URL:    logo.URL,
+			Width:  logo.Width,
+			Height: logo.Height,
 		}
+	}
 
-		// Fetch the actual channel record
-		channelRecord, err := s.app.FindRecordById("channels", channelID)
-		if err != nil || channelRecord == nil {
-			continue
+	if category := s.lookups.category(channel.Category); category != nil {
+		response.Category = &model.Category{
+			Name1: category.Name1,
+			Name2: category.Name2,
+			Name3: category.Name3,
 		}
+	}
 
-		response := s.buildChannelResponse(channelRecord)
-		responses = append(responses, response)
+	if country := s.lookups.country(channel.Country); country != nil {
+		response.Country = &model.Country{
+			Name: country.Name,
+		}
 	}
 
-	return responses, nil
+	if language := s.lookups.language(channel.Language); language != nil {
+		response.Language = &model.Language{
+			Name: language.Name,
+		}
+	}
+
+	return response
+}
+
+// InvalidateLookups drops the cached records of a lookup collection after it changed
+func (s *Stream) InvalidateLookups(collection string) {
+	s.lookups.invalidate(collection)
 }
 
 // GetChannelByName retrieves a single channel by its name
 func (s *Stream) GetChannelByName(channelName string) (*model.WatchStreamResponse, error) {
-	record, err := s.app.FindFirstRecordByFilter("channels", fmt.Sprintf("channel = '%s'", channelName))
-	if err != nil || record == nil {
+	channel, err := s.channels.FindByChannel(channelName)
+	if err != nil || channel == nil {
 		return nil, nil
 	}
 
-	response := s.buildChannelResponse(record)
+	response := s.buildChannelResponse(channel)
 	return response, nil
 }
 
 // GetChannelsByCategory retrieves 12 channels from a specific category with good quality
-// Excludes featured channels. If category is "All", returns best quality channels from any category.
+// Excludes the channels featured right now. If category is "All", returns the most popular channels from any
+// category, topped up with the best quality ones while too few have been watched.
 func (s *Stream) GetChannelsByCategory(categoryName string) ([]*model.WatchStreamResponse, error) {
-	cfg := config.GetConfig()
-	featuredIDs := strings.Split(cfg.FeaturedChannels, ",")
-
-	// Build filter to exclude featured channels
-	var excludeFilters []string
-	for _, id := range featuredIDs {
-		id = strings.TrimSpace(id)
-		if id != "" {
-			excludeFilters = append(excludeFilters, fmt.Sprintf("id != '%s'", id))
-		}
-	}
+	all := strings.ToLower(categoryName) == "all" || categoryName == ""
 
-	var filter string
+	query := &model.ChannelQuery{
+		Sort:  model.ChannelSort{Field: "quality", Desc: true}, // prioritize higher quality
+		Limit: 12,
+	}
 
-	// If category is "All" or "all", just get all channels
-	if strings.ToLower(categoryName) == "all" || categoryName == "" {
-		if len(excludeFilters) > 0 {
-			filter = strings.Join(excludeFilters, " && ")
-		} else {
-			filter = "" // No filter needed
-		}
-	} else {
+	// If category isn't "All" or "all", only get channels of the category
+	if !all {
 		// Get category ID by name
-		categoryRecord, err := s.app.FindFirstRecordByFilter("categories", fmt.Sprintf("name_1 = '%s'", categoryName))
-		if err != nil || categoryRecord == nil {
+		category, err := s.taxonomy.CategoryByName(categoryName)
+		if err != nil || category == nil {
 			return []*model.WatchStreamResponse{}, nil
 		}
 
-		categoryID := categoryRecord.Id
-
-		// Build the filter
-		filter = fmt.Sprintf("category = '%s'", categoryID)
-		if len(excludeFilters) > 0 {
-			filter = fmt.Sprintf("%s && (%s)", filter, strings.Join(excludeFilters, " && "))
-		}
+		query.Category = category.ID
 	}
 
-	// Get channels with good quality (prioritize higher quality)
-	records, err := s.app.FindRecordsByFilter(
-		"channels",
-		filter,
-		"-quality", // Sort by quality descending
-		12,
-		0,
-		nil,
-	)
-
+	// Exclude featured channels, wherever they are featured
+	featured, err := s.featured.Active(time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("failed to find channels by category: %w", err)
+		return nil, fmt.Errorf("failed to find featured channels: %w", err)
 	}
-
-	var responses []*model.WatchStreamResponse
-	for _, record := range records {
-		response := s.buildChannelResponse(record)
-		responses = append(responses, response)
+	for _, slot := range featured {
+		query.ExcludeIDs = append(query.ExcludeIDs, slot.Channel)
 	}
 
-	return responses, nil
-}
-
-// GetRecommendedChannels retrieves 4 similar channels based on the current watching channel
-// Priority: 1) Same language + same category, 2) Same language (any category), 3) Same category (any language)
-// Always prioritizes best quality and excludes the watching channel itself.
-func (s *Stream) GetRecommendedChannels(req *model.RecommendStreamRequest) ([]*model.WatchStreamResponse, error) {
-	var allResponses []*model.WatchStreamResponse
-
-	// Get language and category IDs
-	var languageID, categoryID string
+	var channels []*model.Channel
+	if all {
+		popularQuery := *query
+		popularQuery.Sort = model.ChannelSort{Field: "popularity", Desc: true}
+		popular, err := s.channels.Find(&popularQuery)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find popular channels: %w", err)
+		}
 
-	if req.LanguageName != "" {
-		languageRecord, err := s.app.FindFirstRecordByFilter("languages", fmt.Sprintf("name = '%s'", req.LanguageName))
-		if err == nil && languageRecord != nil {
-			languageID = languageRecord.Id
+		for _, channel := range popular {
+			if channel.Popularity > 0 {
+				channels = append(channels, channel)
+				query.ExcludeIDs = append(query.ExcludeIDs, channel.ID)
+			}
 		}
+		query.Limit -= len(channels)
 	}
 
-	if req.CategoryName != "" {
-		categoryRecord, err := s.app.FindFirstRecordByFilter("categories", fmt.Sprintf("name_1 = '%s'", req.CategoryName))
-		if err == nil && categoryRecord != nil {
-			categoryID = categoryRecord.Id
+	if query.Limit > 0 {
+		found, err := s.channels.Find(query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find channels by category: %w", err)
 		}
+		channels = append(channels, found...)
 	}
 
-	// Strategy 1: Same language + same category
-	if languageID != "" && categoryID != "" {
-		filter := fmt.Sprintf("channel != '%s' && language = '%s' && category = '%s'", req.Channel, languageID, categoryID)
-		records, err := s.app.FindRecordsByFilter("channels", filter, "-quality", 4, 0, nil)
-		if err == nil {
-			for _, record := range records {
-				allResponses = append(allResponses, s.buildChannelResponse(record))
-			}
-		}
+	return s.buildChannelResponses(channels), nil
+}
+
+// GetAllStreams retrieves all streams with filtering by category, country, language.
+// Results are paginated by page number, or after a cursor for infinite scroll,
+// 24 per page and sorted by quality unless requested otherwise.
+func (s *Stream) GetAllStreams(req *model.AllStreamsRequest) (*model.AllStreamsResponse, error) {
+	perPage := req.PerPage
+	if perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
 	}
 
-	// If we have 4 channels, return them
-	if len(allResponses) >= 4 {
-		return allResponses[:4], nil
+	sortName := strings.ToLower(req.Sort)
+	if sortName == "" {
+		sortName = defaultSort
+	}
+	sortOption, ok := streamSorts[sortName]
+	if !ok {
+		return nil, apperror.ClientError(fmt.Errorf("unknown sort %q", req.Sort), http.StatusBadRequest)
 	}
 
-	// Strategy 2: Same language (any category) - if we need more channels
-	if languageID != "" && len(allResponses) < 4 {
-		filter := fmt.Sprintf("channel != '%s' && language = '%s'", req.Channel, languageID)
-		needed := 4 - len(allResponses)
-		records, err := s.app.FindRecordsByFilter("channels", filter, "-quality", needed+10, 0, nil)
-		if err == nil {
-			// Add channels that we don't already have
-			existingChannels := make(map[string]bool)
-			for _, resp := range allResponses {
-				existingChannels[resp.Channel] = true
-			}
+	query := s.catalogQuery(req.Category, req.Country, req.Language)
+	query.Sort = sortOption
 
-			for _, record := range records {
-				channelName := record.GetString("channel")
-				if !existingChannels[channelName] && len(allResponses) < 4 {
-					allResponses = append(allResponses, s.buildChannelResponse(record))
-					existingChannels[channelName] = true
-				}
-			}
-		}
+	// First, get total count
+	total, err := s.channels.Count(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count channels: %w", err)
 	}
 
-	// If we still need more, Strategy 3: Same category (any language)
-	if categoryID != "" && len(allResponses) < 4 {
-		filter := fmt.Sprintf("channel != '%s' && category = '%s'", req.Channel, categoryID)
-		needed := 4 - len(allResponses)
-		records, err := s.app.FindRecordsByFilter("channels", filter, "-quality", needed+10, 0, nil)
-		if err == nil {
-			// Add channels that we don't already have
-			existingChannels := make(map[string]bool)
-			for _, resp := range allResponses {
-				existingChannels[resp.Channel] = true
-			}
+	// Calculate pagination
+	totalPages := (total + perPage - 1) / perPage
 
-			for _, record := range records {
-				channelName := record.GetString("channel")
-				if !existingChannels[channelName] && len(allResponses) < 4 {
-					allResponses = append(allResponses, s.buildChannelResponse(record))
-					existingChannels[channelName] = true
-				}
-			}
+	if req.Cursor != "" {
+		cursor, err := decodeCursor(req.Cursor, sortName)
+		if err != nil {
+			return nil, err
+		}
+		query.After = cursor.key()
+		req.Page = 0
+	} else {
+		if req.Page < 1 {
+			req.Page = 1
+		}
+		if req.Page > totalPages && totalPages > 0 {
+			req.Page = totalPages
 		}
+		query.Offset = (req.Page - 1) * perPage
 	}
 
-	// If we still don't have enough, get any high-quality channels
-	if len(allResponses) < 4 {
-		filter := fmt.Sprintf("channel != '%s'", req.Channel)
-		needed := 4 - len(allResponses)
-		records, err := s.app.FindRecordsByFilter("channels", filter, "-quality", needed+10, 0, nil)
-		if err == nil {
-			existingChannels := make(map[string]bool)
-			for _, resp := range allResponses {
-				existingChannels[resp.Channel] = true
-			}
+	// One extra channel tells whether there is a next page
+	query.Limit = perPage + 1
 
-			for _, record := range records {
-				channelName := record.GetString("channel")
-				if !existingChannels[channelName] && len(allResponses) < 4 {
-					allResponses = append(allResponses, s.buildChannelResponse(record))
-					existingChannels[channelName] = true
-				}
-			}
-		}
+	channels, err := s.channels.Find(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find channels: %w", err)
 	}
 
-	return allResponses, nil
-}
+	var nextCursor string
+	if len(channels) > perPage {
+		channels = channels[:perPage]
+		nextCursor = encodeCursor(sortName, sortOption, channels[len(channels)-1])
+	}
 
-// GetAllStreams retrieves all streams with filtering by category, country, language
-// Returns paginated results (24 per page) sorted by quality
-func (s *Stream) GetAllStreams(req *model.AllStreamsRequest) (*model.AllStreamsResponse, error) {
-	const perPage = 24
+	return &model.AllStreamsResponse{
+		Channels:   s.buildChannelResponses(channels),
+		Total:      total,
+		Page:       req.Page,
+		PerPage:    perPage,
+		TotalPages: totalPages,
+		Sort:       sortName,
+		NextCursor: nextCursor,
+	}, nil
+}
 
-	var filters []string
+// catalogQuery builds the channels query for the category, country and language names
+// shared by the catalog listings. Empty names and "all" don't filter.
+func (s *Stream) catalogQuery(categoryName, countryName, languageName string) *model.ChannelQuery {
+	query := &model.ChannelQuery{}
 
 	// Filter by category if not "all"
-	if req.Category != "" && strings.ToLower(req.Category) != "all" {
-		categoryRecord, err := s.app.FindFirstRecordByFilter("categories", fmt.Sprintf("name_1 = '%s'", strings.ToLower(req.Category)))
-		if err == nil && categoryRecord != nil {
-			filters = append(filters, fmt.Sprintf("category = '%s'", categoryRecord.Id))
+	if categoryName != "" && strings.ToLower(categoryName) != "all" {
+		category, err := s.taxonomy.CategoryByName(strings.ToLower(categoryName))
+		if err == nil && category != nil {
+			query.Category = category.ID
 		}
 	}
 
 	// Filter by country if not "all"
-	if req.Country != "" && strings.ToLower(req.Country) != "all" {
-		countryRecord, err := s.app.FindFirstRecordByFilter("countries", fmt.Sprintf("name = '%s'", req.Country))
-		if err == nil && countryRecord != nil {
-			filters = append(filters, fmt.Sprintf("country = '%s'", countryRecord.Id))
+	if countryName != "" && strings.ToLower(countryName) != "all" {
+		country, err := s.taxonomy.CountryByName(countryName)
+		if err == nil && country != nil {
+			query.Country = country.ID
 		}
 	}
 
 	// Filter by language if not "all"
-	if req.Language != "" && strings.ToLower(req.Language) != "all" {
-		languageRecord, err := s.app.FindFirstRecordByFilter("languages", fmt.Sprintf("name = '%s'", req.Language))
-		if err == nil && languageRecord != nil {
-			filters = append(filters, fmt.Sprintf("language = '%s'", languageRecord.Id))
+	if languageName != "" && strings.ToLower(languageName) != "all" {
+		language, err := s.taxonomy.LanguageByName(languageName)
+		if err == nil && language != nil {
+			query.Language = language.ID
 		}
 	}
 
-	// Build the filter
-	filter := strings.Join(filters, " && ")
-
-	// First, get total count
-	totalRecords, err := s.app.FindRecordsByFilter("channels", filter, "", 0, 0, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to count channels: %w", err)
-	}
-	total := len(totalRecords)
-
-	// Calculate pagination
-	totalPages := (total + perPage - 1) / perPage
-	if req.Page > totalPages && totalPages > 0 {
-		req.Page = totalPages
-	}
-	offset := (req.Page - 1) * perPage
+	return query
+}
 
-	// Get paginated channels sorted by quality (highest to lowest)
-	records, err := s.app.FindRecordsByFilter(
-		"channels",
-		filter,
-		"-quality", // Sort by quality descending
-		perPage,
-		offset,
-		nil,
-	)
+// GetPlaylistChannels retrieves every working channel matching the catalog filters for playlist exports.
+// URLs are absolute HLS proxy URLs with playback tokens, as players open them directly.
+// Channels whose token can't be issued are left out rather than exposing their upstream URL.
+func (s *Stream) GetPlaylistChannels(req *model.PlaylistRequest) ([]*model.WatchStreamResponse, error) {
+	query := s.catalogQuery(req.Category, req.Country, req.Language)
+	query.OnlyWorking = true
+	query.Sort = model.ChannelSort{Field: "title"}
 
+	found, err := s.channels.Find(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find channels: %w", err)
 	}
 
-	var channels []*model.WatchStreamResponse
-	for _, record := range records {
-		response := s.buildChannelResponse(record)
-		channels = append(channels, response)
+	// Players load a playlist once and play from it for long, its URLs are playback tokens
+	// of the proxy with a lifetime of their own
+	responses := s.buildResponses(found, func(channel *model.Channel) (string, error) {
+		playToken, err := s.signer.Sign(channel.ID, token.ScopePlay, playlistTokenTTL(), nil)
+		if err != nil {
+			return "", err
+		}
+		return req.BaseURL + hlsProxyPath(playToken, hlsIndexResource, channel.URL), nil
+	})
+
+	channels := make([]*model.WatchStreamResponse, 0, len(responses))
+	for _, response := range responses {
+		if response.URL != "" {
+			channels = append(channels, response)
+		}
 	}
 
-	return &model.AllStreamsResponse{
-		Channels:   channels,
-		Total:      total,
-		Page:       req.Page,
-		PerPage:    perPage,
-		TotalPages: totalPages,
-	}, nil
+	return channels, nil
 }
 
 // GetCategories retrieves all unique categories from database
 func (s *Stream) GetCategories() ([]string, error) {
-	records, err := s.app.FindRecordsByFilter("categories", "", "name_1", 0, 0, nil)
+	records, err := s.taxonomy.Categories()
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch categories: %w", err)
 	}
@@ -533,7 +572,7 @@ func (s *Stream) GetCategories() ([]string, error) {
 	var categories []string
 
 	for _, record := range records {
-		name := record.GetString("name_1")
+		name := record.Name1
 		if name != "" && !uniqueMap[name] {
 			uniqueMap[name] = true
 			categories = append(categories, name)
@@ -545,7 +584,7 @@ func (s *Stream) GetCategories() ([]string, error) {
 
 // GetCountries retrieves all unique countries from database
 func (s *Stream) GetCountries() ([]string, error) {
-	records, err := s.app.FindRecordsByFilter("countries", "", "name", 0, 0, nil)
+	records, err := s.taxonomy.Countries()
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch countries: %w", err)
 	}
@@ -555,7 +594,7 @@ func (s *Stream) GetCountries() ([]string, error) {
 	var countries []string
 
 	for _, record := range records {
-		name := record.GetString("name")
+		name := record.Name
 		if name != "" && !uniqueMap[name] {
 			uniqueMap[name] = true
 			countries = append(countries, name)
@@ -567,7 +606,7 @@ func (s *Stream) GetCountries() ([]string, error) {
 
 // GetLanguages retrieves all unique languages from database
 func (s *Stream) GetLanguages() ([]string, error) {
-	records, err := s.app.FindRecordsByFilter("languages", "", "name", 0, 0, nil)
+	records, err := s.taxonomy.Languages()
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch languages: %w", err)
 	}
@@ -577,7 +616,7 @@ func (s *Stream) GetLanguages() ([]string, error) {
 	var languages []string
 
 	for _, record := range records {
-		name := record.GetString("name")
+		name := record.Name
 		if name != "" && !uniqueMap[name] {
 			uniqueMap[name] = true
 			languages = append(languages, name)
@@ -587,91 +626,112 @@ func (s *Stream) GetLanguages() ([]string, error) {
 	return languages, nil
 }
 
-// SearchStreams searches for channels by title (case-insensitive)
+// SearchStreams searches channels by title, channel id, category, country and language,
+// ranked by relevance. Words match as prefixes, and with typos when nothing matches as typed.
 func (s *Stream) SearchStreams(req *model.SearchStreamRequest) (*model.SearchStreamResponse, error) {
-	if req.Query == "" {
+	perPage := req.PerPage
+	if perPage < 1 {
+		perPage = defaultSearchPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
 		return &model.SearchStreamResponse{
 			Channels: []*model.WatchStreamResponse{},
 			Total:    0,
+			Page:     req.Page,
+			PerPage:  perPage,
+			Facets:   &model.SearchFacets{},
 		}, nil
 	}
 
-	// Search by title field with case-insensitive partial matching
-	// Using ?~ for case-insensitive regex matching in PocketBase
-	escapedQuery := strings.ReplaceAll(req.Query, "'", "\\'")
-	filter := fmt.Sprintf("(title ?~ '%s' || id ?~ '%s')",
-		escapedQuery,
-		escapedQuery)
+	filter := s.catalogQuery(req.Category, req.Country, req.Language)
 
-	// Parameters: collection, filter, sort, limit, offset, params
-	records, err := s.app.FindRecordsByFilter("channels", filter, "-quality", 20, 0, nil)
+	result, err := s.search.Search(&model.SearchQuery{
+		Text:     req.Query,
+		Category: filter.Category,
+		Country:  filter.Country,
+		Language: filter.Language,
+		Limit:    perPage,
+		Offset:   (req.Page - 1) * perPage,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to search channels: %w", err)
 	}
 
-	var channels []*model.WatchStreamResponse
-	for _, record := range records {
-		response := &model.WatchStreamResponse{
-			Channel: record.GetString("id"),
-			Title:   record.GetString("title"),
-			URL:     record.GetString("url"),
-		}
+	channels := s.buildChannelResponses(result.Channels)
+	if channels == nil {
+		channels = []*model.WatchStreamResponse{}
+	}
 
-		// Expand quality
-		if qualityID := record.GetString("quality"); qualityID != "" {
-			if qualityRecord, err := s.app.FindRecordById("qualities", qualityID); err == nil {
-				response.Quality = qualityRecord.GetString("name")
-			}
-		}
+	return &model.SearchStreamResponse{
+		Channels:   channels,
+		Total:      result.Total,
+		Page:       req.Page,
+		PerPage:    perPage,
+		TotalPages: (result.Total + perPage - 1) / perPage,
+		Fuzzy:      result.Fuzzy,
+		Facets:     s.searchFacets(result.Facets),
+	}, nil
+}
 
-		// Expand logo
-		if logoID := record.GetString("logo"); logoID != "" {
-			if logoRecord, err := s.app.FindRecordById("logos", logoID); err == nil {
-				response.Logo = &model.Logo{
-					URL: logoRecord.GetString("logo_url"),
-				}
+// searchFacets names the facet counts of a search, most results first
+func (s *Stream) searchFacets(counts map[string]map[string]int) *model.SearchFacets {
+	facets := func(field string, name func(id string) string) []*model.Facet {
+		result := []*model.Facet{}
+		for id, count := range counts[field] {
+			if n := name(id); n != "" {
+				result = append(result, &model.Facet{Name: n, Count: count})
 			}
 		}
-
-		// Expand category
-		if categoryID := record.GetString("category"); categoryID != "" {
-			if categoryRecord, err := s.app.FindRecordById("categories", categoryID); err == nil {
-				response.Category = &model.Category{
-					Name1: categoryRecord.GetString("name_1"),
-					Name2: categoryRecord.GetString("name_2"),
-				}
+		sort.Slice(result, func(i, j int) bool {
+			if result[i].Count != result[j].Count {
+				return result[i].Count > result[j].Count
 			}
-		}
+			return result[i].Name < result[j].Name
+		})
+		return result
+	}
 
-		// Expand country
-		if countryID := record.GetString("country"); countryID != "" {
-			if countryRecord, err := s.app.FindRecordById("countries", countryID); err == nil {
-				response.Country = &model.Country{
-					Name: countryRecord.GetString("name"),
-				}
+	return &model.SearchFacets{
+		Categories: facets("category", func(id string) string {
+			if category := s.lookups.category(id); category != nil {
+				return category.Name1
 			}
-		}
-
-		// Expand language
-		if languageID := record.GetString("language"); languageID != "" {
-			if languageRecord, err := s.app.FindRecordById("languages", languageID); err == nil {
-				response.Language = &model.Language{
-					Name: languageRecord.GetString("name"),
-				}
+			return ""
+		}),
+		Countries: facets("country", func(id string) string {
+			if country := s.lookups.country(id); country != nil {
+				return country.Name
 			}
-		}
-
-		channels = append(channels, response)
+			return ""
+		}),
+		Languages: facets("language", func(id string) string {
+			if language := s.lookups.language(id); language != nil {
+				return language.Name
+			}
+			return ""
+		}),
 	}
-
-	return &model.SearchStreamResponse{
-		Channels: channels,
-		Total:    len(channels),
-	}, nil
 }
 
-// PlayStream resolves a token to the actual stream URL, or fetches URL by channel_id, or returns direct URL
+// PlayStream exchanges a stream token for the HLS proxy URL of its channel. Unless
+// STREAM_PLAY_STRICT is off, that is all it does; legacy clients can then still have a
+// direct URL echoed back or the upstream URL of a channel id resolved.
 func (s *Stream) PlayStream(req *model.PlayStreamRequest) (*model.PlayStreamResponse, error) {
+	if req.Token != "" {
+		return s.playToken(req)
+	}
+
+	if config.GetConfig().StreamPlayStrict {
+		return nil, apperror.ClientError(fmt.Errorf("token is required"), http.StatusBadRequest)
+	}
+
 	// If URL is provided directly, return it
 	if req.URL != "" {
 		return &model.PlayStreamResponse{
@@ -681,44 +741,258 @@ func (s *Stream) PlayStream(req *model.PlayStreamRequest) (*model.PlayStreamResp
 
 	// If channel_id is provided, fetch the URL from database
 	if req.ChannelID != "" {
-		filter := fmt.Sprintf("id = '%s'", req.ChannelID)
-		record, err := s.app.FindFirstRecordByFilter("channels", filter)
-		if err != nil || record == nil {
-			return nil, fmt.Errorf("channel not found")
+		channel, err := s.channels.FindByID(req.ChannelID)
+		if err != nil || channel == nil {
+			return nil, apperror.ClientError(fmt.Errorf("channel not found"), http.StatusNotFound)
 		}
 
-		actualURL := record.GetString("url")
-		if actualURL == "" {
-			return nil, fmt.Errorf("channel url is empty")
+		if channel.URL == "" {
+			return nil, apperror.ClientError(fmt.Errorf("channel url is empty"), http.StatusNotFound)
 		}
 
 		return &model.PlayStreamResponse{
-			URL: actualURL,
+			URL:       channel.URL,
+			UserAgent: channel.UserAgent,
+			Referrer:  channel.Referrer,
 		}, nil
 	}
 
-	// If token is provided, try to resolve it from Redis
-	if req.Token != "" {
-		// First, try to get the actual URL from Redis using the token
-		actualURL, err := s.redisClient.GetURLByToken(req.Token)
-		if err == nil {
-			// Token found in Redis, return the URL
-			return &model.PlayStreamResponse{
-				URL: actualURL,
-			}, nil
+	return nil, apperror.ClientError(fmt.Errorf("token, channel_id, or url is required"), http.StatusBadRequest)
+}
+
+// playToken verifies a listing token and exchanges it for a playback token in the proxy URL.
+// The proxy sends the channel's User-Agent and Referer itself, so they are not returned.
+func (s *Stream) playToken(req *model.PlayStreamRequest) (*model.PlayStreamResponse, error) {
+	client := token.Client{IP: req.ClientIP, UserAgent: req.UserAgent}
+	claims, err := s.signer.Verify(req.Token, token.ScopeList, client)
+	if err != nil {
+		return nil, apperror.ClientError(fmt.Errorf("invalid or expired token"), http.StatusUnauthorized)
+	}
+	if err := s.checkRevoked(claims); err != nil {
+		return nil, err
+	}
+	if err := s.useToken(claims); err != nil {
+		return nil, err
+	}
+
+	channel, err := s.channels.FindByID(claims.ChannelID)
+	if err != nil || channel == nil || channel.URL == "" {
+		return nil, apperror.ClientError(fmt.Errorf("channel not found"), http.StatusNotFound)
+	}
+
+	// The playback token expires with the token it was exchanged for
+	var bind *token.Client
+	if config.GetConfig().StreamTokenBindClient {
+		bind = &client
+	}
+	playToken, err := s.signer.Sign(channel.ID, token.ScopePlay, time.Until(claims.ExpiresAt()), bind)
+	if err != nil {
+		return nil, apperror.SystemError(fmt.Errorf("failed to generate URL token: %w", err))
+	}
+
+	return &model.PlayStreamResponse{
+		URL: config.GetConfig().PublicBaseURL + hlsProxyPath(playToken, hlsIndexResource, channel.URL),
+	}, nil
+}
+
+// checkRevoked rejects tokens issued before the tokens of their channel were revoked.
+// It fails closed when the revocation can't be read.
+func (s *Stream) checkRevoked(claims *token.Claims) error {
+	revokedAt, err := s.redisClient.ChannelTokensRevokedAt(claims.ChannelID)
+	if err != nil {
+		return apperror.SystemError(err)
+	}
+	if !revokedAt.IsZero() && !claims.IssuedAt().After(revokedAt) {
+		return apperror.ClientError(fmt.Errorf("token was revoked"), http.StatusForbidden)
+	}
+	return nil
+}
+
+// useToken counts an exchange of a token when STREAM_TOKEN_MAX_USES limits them,
+// and rejects it once the limit is exceeded
+func (s *Stream) useToken(claims *token.Claims) error {
+	maxUses := config.GetConfig().StreamTokenMaxUses
+	if maxUses <= 0 {
+		return nil
+	}
+
+	uses, err := s.redisClient.UseToken(claims.ID, time.Until(claims.ExpiresAt()))
+	if err != nil {
+		return apperror.SystemError(err)
+	}
+	if uses > int64(maxUses) {
+		return apperror.ClientError(fmt.Errorf("token was already used"), http.StatusForbidden)
+	}
+	return nil
+}
+
+// RevokeChannelTokens revokes every token issued so far for a channel, listing and
+// playback tokens alike. Tokens issued afterwards are valid.
+func (s *Stream) RevokeChannelTokens(channelID string) error {
+	channel, err := s.channels.FindByID(channelID)
+	if err != nil || channel == nil {
+		return apperror.ClientError(fmt.Errorf("channel not found"), http.StatusNotFound)
+	}
+
+	// The revocation outlives the longest lived token, the playlist play tokens
+	if err := s.redisClient.RevokeChannelTokens(channel.ID, max(streamTokenTTL(), playlistTokenTTL())); err != nil {
+		return apperror.SystemError(err)
+	}
+	return nil
+}
+
+// hlsProxyPath builds the proxy path of an upstream resource, keeping the upstream
+// extension so players can still tell playlists and segments apart
+func hlsProxyPath(token, resource, upstreamURL string) string {
+	return fmt.Sprintf("/api/v1/stream/hls/%s/%s", token, hlsProxyResource(resource, upstreamURL))
+}
+
+// hlsProxyResource appends the extension of the upstream URL to a proxy resource name
+func hlsProxyResource(resource, upstreamURL string) string {
+	ext := ""
+	if i := strings.IndexAny(upstreamURL, "?#"); i >= 0 {
+		upstreamURL = upstreamURL[:i]
+	}
+	if e := path.Ext(upstreamURL); proxyExtRegex.MatchString(e) {
+		ext = e
+	}
+	return resource + ext
+}
+
+// ProxyHLS fetches an upstream resource of a stream token. Playlists are rewritten so that
+// every variant, segment, key and map URI points back at the proxy, anything else is streamed through.
+func (s *Stream) ProxyHLS(req *model.HLSProxyRequest) (*model.HLSProxyResponse, error) {
+	claims, err := s.signer.Verify(req.Token, token.ScopePlay, token.Client{IP: req.ClientIP, UserAgent: req.UserAgent})
+	if errors.Is(err, token.ErrClient) {
+		return nil, apperror.ClientError(err, http.StatusForbidden)
+	}
+	if err != nil {
+		return nil, apperror.ClientError(fmt.Errorf("invalid or expired token"), http.StatusNotFound)
+	}
+	if err := s.checkRevoked(claims); err != nil {
+		return nil, err
+	}
+
+	channel, err := s.channels.FindByID(claims.ChannelID)
+	if err != nil || channel == nil {
+		return nil, apperror.ClientError(fmt.Errorf("channel not found"), http.StatusNotFound)
+	}
+	source := streamSource(channel)
+
+	upstreamURL := source.URL
+	resource := strings.TrimSuffix(req.Resource, path.Ext(req.Resource))
+	if resource != hlsIndexResource {
+		upstreamURL, err = s.redisClient.GetProxyURL(req.Token, resource)
+		if err != nil {
+			return nil, apperror.ClientError(fmt.Errorf("resource not found or expired"), http.StatusNotFound)
 		}
+	}
+
+	upstreamReq, err := http.NewRequest(http.MethodGet, upstreamURL, nil)
+	if err != nil {
+		return nil, apperror.SystemError(err)
+	}
+	setUpstreamHeaders(upstreamReq, source)
+	if req.Range != "" {
+		upstreamReq.Header.Set("Range", req.Range)
+	}
 
-		// If token is not in Redis, check if it's a direct URL (fallback for Redis failures)
-		// Direct URLs typically start with http:// or https://
-		if strings.HasPrefix(req.Token, "http://") || strings.HasPrefix(req.Token, "https://") {
-			return &model.PlayStreamResponse{
-				URL: req.Token,
-			}, nil
+	resp, err := s.httpClient.Do(upstreamReq)
+	if err != nil {
+		return nil, apperror.NewAppError(err, "stream is unavailable", err.Error(), http.StatusBadGateway, false)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		resp.Body.Close()
+		return nil, apperror.NewAppError(nil, "stream is unavailable", fmt.Sprintf("upstream status %d", resp.StatusCode), http.StatusBadGateway, false)
+	}
+
+	body := bufio.NewReader(resp.Body)
+	contentType := resp.Header.Get("Content-Type")
+	head, _ := body.Peek(len("#EXTM3U"))
+
+	if hls.IsPlaylist(contentType, resp.Request.URL.String()) || string(head) == "#EXTM3U" {
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(io.LimitReader(body, maxPlaylistSize))
+		if err != nil {
+			return nil, apperror.NewAppError(err, "stream is unavailable", err.Error(), http.StatusBadGateway, false)
+		}
+
+		// Relative URIs must be resolved against the final URL after redirects
+		playlist := string(data)
+		base := resp.Request.URL
+
+		keys, err := s.redisClient.StoreProxyURLs(req.Token, hls.URIs(playlist, base), time.Until(claims.ExpiresAt()))
+		if err != nil {
+			return nil, apperror.SystemError(err)
 		}
 
-		// Token not found and not a direct URL
-		return nil, fmt.Errorf("invalid or expired token")
+		// The playlist is served from the token directory, so relative proxy URIs are enough
+		rewritten := hls.Rewrite(playlist, base, func(absURL string) string {
+			return hlsProxyResource(keys[absURL], absURL)
+		})
+
+		header := proxyHeader()
+		header["Cache-Control"] = "no-cache"
+
+		return &model.HLSProxyResponse{
+			StatusCode:    http.StatusOK,
+			ContentType:   "application/vnd.apple.mpegurl",
+			ContentLength: int64(len(rewritten)),
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(rewritten)),
+		}, nil
+	}
+
+	header := proxyHeader()
+	for _, name := range []string{"Accept-Ranges", "Content-Range", "Cache-Control"} {
+		if value := resp.Header.Get(name); value != "" {
+			header[name] = value
+		}
+	}
+
+	return &model.HLSProxyResponse{
+		StatusCode:    resp.StatusCode,
+		ContentType:   proxyContentType(contentType),
+		ContentLength: resp.ContentLength,
+		Header:        header,
+		Body: struct {
+			io.Reader
+			io.Closer
+		}{body, resp.Body},
+	}, nil
+}
+
+// proxyHeader returns the headers of every proxy response, which keep browsers from
+// sniffing or running anything an upstream serves
+func proxyHeader() map[string]string {
+	return map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "sandbox",
+	}
+}
+
+// proxyContentType keeps the upstream content type of a media resource,
+// anything else is served as application/octet-stream
+func proxyContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !proxyMediaTypes[strings.ToLower(mediaType)] {
+		return "application/octet-stream"
 	}
+	return strings.ToLower(mediaType)
+}
+
+// setUpstreamHeaders applies the headers a channel requires from players to an upstream request
+func setUpstreamHeaders(req *http.Request, source *model.StreamSource) {
+	userAgent := source.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "*/*")
 
-	return nil, fmt.Errorf("token, channel_id, or url is required")
+	if source.Referrer != "" {
+		req.Header.Set("Referer", source.Referrer)
+	}
 }
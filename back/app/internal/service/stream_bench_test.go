@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository/memory"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/repository/sqlite"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/testutil"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/token"
+)
+
+// benchPerPage is the page size of the listings
+const benchPerPage = 24
+
+// BenchmarkGetAllStreams reports the queries a page of GetAllStreams costs. "per channel"
+// looks the relations of every channel of the page up by id, as the listings used to;
+// "batched" builds the page the way the listings do now.
+func BenchmarkGetAllStreams(b *testing.B) {
+	// A catalog of 100 channels, each with a logo and all its relations
+	db := testutil.NewDB(b)
+	for i := range 5 {
+		id := fmt.Sprint(i)
+		testutil.Insert(b, db, "qualities", dbx.Params{"id": "q" + id, "quality": fmt.Sprintf("%dp", 240*(i+1))})
+		testutil.Insert(b, db, "categories", dbx.Params{"id": "cat" + id, "name_1": "category " + id})
+		testutil.Insert(b, db, "countries", dbx.Params{"id": "co" + id, "name": "country " + id})
+		testutil.Insert(b, db, "languages", dbx.Params{"id": "la" + id, "name": "language " + id})
+	}
+	for i := range 100 {
+		id := fmt.Sprintf("ch%03d", i)
+		testutil.Insert(b, db, "logos", dbx.Params{"id": "logo" + id, "logo_url": "https://logos.example/" + id + ".png", "width": 256, "height": 256})
+		testutil.Insert(b, db, "channels", dbx.Params{
+			"id":       id,
+			"channel":  id + ".example",
+			"title":    "Channel " + id,
+			"url":      "https://upstream.example/" + id + "/index.m3u8",
+			"logo":     "logo" + id,
+			"quality":  fmt.Sprintf("q%d", i%5),
+			"category": fmt.Sprintf("cat%d", i%5),
+			"country":  fmt.Sprintf("co%d", i%5),
+			"language": fmt.Sprintf("la%d", i%5),
+			"uptime":   i,
+			"created":  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i).Format(time.DateTime),
+		})
+	}
+
+	// Count the queries run on the catalog
+	queries := &atomic.Int64{}
+	db.QueryLogFunc = func(ctx context.Context, t time.Duration, sql string, rows *sql.Rows, err error) {
+		queries.Add(1)
+	}
+	db.ExecLogFunc = func(ctx context.Context, t time.Duration, sql string, result sql.Result, err error) {
+		queries.Add(1)
+	}
+
+	signer, err := token.NewSigner([]token.Key{token.RandomKey()})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	channels, taxonomy := sqlite.NewChannel(db), sqlite.NewTaxonomy(db)
+	stream := NewStream(channels, taxonomy, memory.NewFeatured(), sqlite.NewSearch(db), memory.NewProgramme(),
+		newFakeRedis(), signer)
+	req := &model.AllStreamsRequest{Sort: "uptime", PerPage: benchPerPage, Page: 1}
+
+	b.Run("per channel", func(b *testing.B) {
+		queries.Store(0)
+		for range b.N {
+			query := &model.ChannelQuery{Sort: model.ChannelSort{Field: "uptime", Desc: true}, Limit: benchPerPage}
+			if _, err := channels.Count(query); err != nil {
+				b.Fatal(err)
+			}
+			page, err := channels.Find(query)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, channel := range page {
+				for table, id := range map[string]string{
+					"qualities":  channel.Quality,
+					"logos":      channel.Logo,
+					"categories": channel.Category,
+					"countries":  channel.Country,
+					"languages":  channel.Language,
+				} {
+					if err := db.Select().From(table).Where(dbx.HashExp{"id": id}).One(&dbx.NullStringMap{}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		}
+		b.ReportMetric(float64(queries.Load())/float64(b.N), "queries/page")
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		queries.Store(0)
+		for range b.N {
+			resp, err := stream.GetAllStreams(req)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(resp.Channels) != benchPerPage {
+				b.Fatalf("got %d channels, want a page of %d", len(resp.Channels), benchPerPage)
+			}
+		}
+		b.ReportMetric(float64(queries.Load())/float64(b.N), "queries/page")
+	})
+}
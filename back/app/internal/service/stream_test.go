@@ -0,0 +1,347 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/apperror"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/config"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/model"
+	"gitlab.yurtal.tech/company/blitz/business-card/back/internal/token"
+)
+
+// channelNames lists the channel identifiers of responses
+func channelNames(responses []*model.WatchStreamResponse) []string {
+	names := make([]string, len(responses))
+	for i, response := range responses {
+		names[i] = response.Channel
+	}
+	return names
+}
+
+// statusCode returns the status of an application error, 0 for other errors
+func statusCode(err error) int {
+	var appErr *apperror.AppError
+	if errors.As(err, &appErr) {
+		return appErr.StatusCode
+	}
+	return 0
+}
+
+func TestWatchStream(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp, err := env.stream.WatchStream(&model.WatchStreamRequest{ChannelID: "ch1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Channel != "France24.fr" || resp.Title != "France 24" || resp.Quality != "1080p" {
+		t.Errorf("got %s %q %s, want France24.fr \"France 24\" 1080p", resp.Channel, resp.Title, resp.Quality)
+	}
+	if resp.Logo == nil || resp.Logo.URL != "https://logos.example/france24.png" {
+		t.Errorf("logo = %+v, want the logo of the channel", resp.Logo)
+	}
+	if resp.Category == nil || resp.Category.Name1 != "news" ||
+		resp.Country == nil || resp.Country.Name != "France" ||
+		resp.Language == nil || resp.Language.Name != "French" {
+		t.Errorf("relations = %+v %+v %+v, want news, France, French", resp.Category, resp.Country, resp.Language)
+	}
+
+	claims, err := env.signer.Verify(resp.URL, token.ScopeList, token.Client{})
+	if err != nil {
+		t.Fatalf("url %q is not a listing token: %v", resp.URL, err)
+	}
+	if claims.ChannelID != "ch1" {
+		t.Errorf("token channel = %s, want ch1", claims.ChannelID)
+	}
+
+	if _, err := env.stream.WatchStream(&model.WatchStreamRequest{ChannelID: "missing"}); err == nil {
+		t.Error("watching a missing channel didn't fail")
+	}
+}
+
+func TestGetChannelByName(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp, err := env.stream.GetChannelByName("BBCNews.uk")
+	if err != nil || resp == nil {
+		t.Fatalf("got %v, %v, want BBC News", resp, err)
+	}
+	if resp.Title != "BBC News" || resp.Country.Name != "United Kingdom" {
+		t.Errorf("got %q of %+v, want BBC News of United Kingdom", resp.Title, resp.Country)
+	}
+
+	if resp, err := env.stream.GetChannelByName("Missing.fr"); resp != nil || err != nil {
+		t.Errorf("got %v, %v for a missing channel, want nil, nil", resp, err)
+	}
+}
+
+func TestGetChannelsByCategory(t *testing.T) {
+	env := newTestEnv(t)
+
+	tests := []struct {
+		category string
+		want     []string
+	}{
+		// Best quality first, the retired channel is left out
+		{"news", []string{"France24.fr", "BBCNews.uk", "BFMTV.fr"}},
+		{"kids", []string{"CBeebies.uk", "Gulli.fr"}},
+		{"unknown", []string{}},
+		// Watched channels first, most popular first, then the best quality ones
+		{"all", []string{"BBCNews.uk", "France24.fr", "BFMTV.fr", "SkySports.uk", "LEquipe.fr", "CBeebies.uk", "Gulli.fr"}},
+	}
+
+	for _, tt := range tests {
+		resp, err := env.stream.GetChannelsByCategory(tt.category)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := channelNames(resp); !slices.Equal(got, tt.want) {
+			t.Errorf("GetChannelsByCategory(%q) = %v, want %v", tt.category, got, tt.want)
+		}
+	}
+
+	// Featured channels are left out
+	if err := env.featured.Create(&model.FeaturedEntity{Channel: "ch4"}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := env.stream.GetChannelsByCategory("news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := channelNames(resp), []string{"France24.fr", "BFMTV.fr"}; !slices.Equal(got, want) {
+		t.Errorf("GetChannelsByCategory(news) with BBCNews.uk featured = %v, want %v", got, want)
+	}
+}
+
+func TestGetAllStreams(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp, err := env.stream.GetAllStreams(&model.AllStreamsRequest{Country: "France", Sort: "title", PerPage: 3, Page: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 4 || resp.TotalPages != 2 || resp.Sort != "title" {
+		t.Errorf("got total %d, %d pages, sort %s, want 4, 2, title", resp.Total, resp.TotalPages, resp.Sort)
+	}
+	if got, want := channelNames(resp.Channels), []string{"BFMTV.fr", "France24.fr", "Gulli.fr"}; !slices.Equal(got, want) {
+		t.Errorf("first page = %v, want %v", got, want)
+	}
+
+	// Pages past the last one return the last one
+	resp, err = env.stream.GetAllStreams(&model.AllStreamsRequest{Country: "France", Sort: "title", PerPage: 3, Page: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := channelNames(resp.Channels), []string{"LEquipe.fr"}; resp.Page != 2 || !slices.Equal(got, want) {
+		t.Errorf("page 9 = page %d %v, want page 2 %v", resp.Page, got, want)
+	}
+
+	// Names that don't exist don't filter
+	resp, err = env.stream.GetAllStreams(&model.AllStreamsRequest{Category: "all", Language: "Klingon", Page: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 7 {
+		t.Errorf("total = %d, want the 7 active channels", resp.Total)
+	}
+
+	if _, err := env.stream.GetAllStreams(&model.AllStreamsRequest{Sort: "random"}); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("unknown sort = %v, want a 400 error", err)
+	}
+}
+
+func TestGetAllStreamsCursor(t *testing.T) {
+	env := newTestEnv(t)
+
+	for sortName := range streamSorts {
+		var walked []string
+		req := &model.AllStreamsRequest{Sort: sortName, PerPage: 2, Page: 1}
+		for pages := 0; ; pages++ {
+			if pages > 10 {
+				t.Fatalf("sort %s: the cursor never ends", sortName)
+			}
+
+			resp, err := env.stream.GetAllStreams(req)
+			if err != nil {
+				t.Fatalf("sort %s: %v", sortName, err)
+			}
+			walked = append(walked, channelNames(resp.Channels)...)
+			if resp.NextCursor == "" {
+				break
+			}
+			req = &model.AllStreamsRequest{Sort: sortName, PerPage: 2, Cursor: resp.NextCursor}
+		}
+
+		all, err := env.stream.GetAllStreams(&model.AllStreamsRequest{Sort: sortName, PerPage: 100, Page: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := channelNames(all.Channels); !slices.Equal(walked, want) {
+			t.Errorf("sort %s: cursor pages = %v, want %v", sortName, walked, want)
+		}
+	}
+
+	// A cursor of another sort is refused
+	resp, err := env.stream.GetAllStreams(&model.AllStreamsRequest{Sort: "title", PerPage: 2, Page: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.stream.GetAllStreams(&model.AllStreamsRequest{Sort: "uptime", Cursor: resp.NextCursor}); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("cursor of another sort = %v, want a 400 error", err)
+	}
+}
+
+func TestSearchStreams(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp, err := env.stream.SearchStreams(&model.SearchStreamRequest{Query: "news"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := channelNames(resp.Channels)
+	slices.Sort(names)
+	if want := []string{"BBCNews.uk", "BFMTV.fr", "France24.fr"}; !slices.Equal(names, want) {
+		t.Errorf("search news = %v, want %v", names, want)
+	}
+	if resp.Total != 3 || resp.Fuzzy {
+		t.Errorf("got total %d fuzzy %t, want 3 exact", resp.Total, resp.Fuzzy)
+	}
+	if len(resp.Facets.Countries) != 2 || resp.Facets.Countries[0].Name != "France" || resp.Facets.Countries[0].Count != 2 {
+		t.Errorf("country facets = %+v, want France 2 then United Kingdom 1", resp.Facets.Countries)
+	}
+
+	resp, err = env.stream.SearchStreams(&model.SearchStreamRequest{Query: "news", Country: "United Kingdom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := channelNames(resp.Channels); !slices.Equal(got, []string{"BBCNews.uk"}) {
+		t.Errorf("search news in United Kingdom = %v, want BBCNews.uk", got)
+	}
+
+	resp, err = env.stream.SearchStreams(&model.SearchStreamRequest{Query: "  "})
+	if err != nil || len(resp.Channels) != 0 || resp.Channels == nil {
+		t.Errorf("empty search = %+v, %v, want an empty list", resp, err)
+	}
+}
+
+func TestTaxonomyListings(t *testing.T) {
+	env := newTestEnv(t)
+
+	categories, err := env.stream.GetCategories()
+	if err != nil || !slices.Equal(categories, []string{"kids", "news", "sports"}) {
+		t.Errorf("GetCategories() = %v, %v", categories, err)
+	}
+	countries, err := env.stream.GetCountries()
+	if err != nil || !slices.Equal(countries, []string{"France", "United Kingdom"}) {
+		t.Errorf("GetCountries() = %v, %v", countries, err)
+	}
+	languages, err := env.stream.GetLanguages()
+	if err != nil || !slices.Equal(languages, []string{"English", "French"}) {
+		t.Errorf("GetLanguages() = %v, %v", languages, err)
+	}
+}
+
+func TestRevokeChannelTokens(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := env.stream.RevokeChannelTokens("missing"); statusCode(err) != http.StatusNotFound {
+		t.Errorf("revoking a missing channel = %v, want a 404 error", err)
+	}
+	if err := env.stream.RevokeChannelTokens("ch1"); err != nil {
+		t.Fatal(err)
+	}
+	if revokedAt, _ := env.redis.ChannelTokensRevokedAt("ch1"); revokedAt.IsZero() {
+		t.Error("the tokens of ch1 weren't revoked")
+	}
+}
+
+func TestRevokeChannelTokensOutlivesPlayTokens(t *testing.T) {
+	env := newTestEnv(t)
+
+	playToken, err := env.signer.Sign("ch1", token.ScopePlay, playlistTokenTTL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.stream.RevokeChannelTokens("ch1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Past the stream token lifetime the play token is still valid, and still revoked
+	env.redis.ahead = streamTokenTTL() + time.Minute
+	_, err = env.stream.ProxyHLS(&model.HLSProxyRequest{Token: playToken, Resource: hlsIndexResource + ".m3u8"})
+	if statusCode(err) != http.StatusForbidden {
+		t.Errorf("proxying a play token issued before the revocation = %v, want a 403 error", err)
+	}
+}
+
+func TestPlayStream(t *testing.T) {
+	env := newTestEnv(t)
+
+	listed, err := env.signer.Sign("ch1", token.ScopeList, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := env.signer.Sign("ch1", token.ScopeList, -time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := "https://upstream.example/ch1/index.m3u8"
+	tests := []struct {
+		name    string
+		req     *model.PlayStreamRequest
+		strict  int
+		relaxed int
+		// relaxedURL is the URL played in non-strict mode
+		relaxedURL string
+	}{
+		{"raw url", &model.PlayStreamRequest{URL: "https://elsewhere.example/live.m3u8"},
+			http.StatusBadRequest, 0, "https://elsewhere.example/live.m3u8"},
+		{"unsigned channel id", &model.PlayStreamRequest{ChannelID: "ch1"},
+			http.StatusBadRequest, 0, upstream},
+		{"unsigned missing channel id", &model.PlayStreamRequest{ChannelID: "missing"},
+			http.StatusBadRequest, http.StatusNotFound, ""},
+		// A token is never a legacy request, an expired one is refused in both modes
+		{"expired token", &model.PlayStreamRequest{Token: expired},
+			http.StatusUnauthorized, http.StatusUnauthorized, ""},
+		{"expired token with channel id", &model.PlayStreamRequest{Token: expired, ChannelID: "ch1"},
+			http.StatusUnauthorized, http.StatusUnauthorized, ""},
+		{"nothing", &model.PlayStreamRequest{},
+			http.StatusBadRequest, http.StatusBadRequest, ""},
+	}
+
+	for _, strict := range []bool{true, false} {
+		withConfig(t, func(cfg *config.Config) { cfg.StreamPlayStrict = strict })
+
+		for _, tt := range tests {
+			want := tt.relaxed
+			if strict {
+				want = tt.strict
+			}
+
+			resp, err := env.stream.PlayStream(tt.req)
+			if statusCode(err) != want || (want == 0 && err != nil) {
+				t.Errorf("strict %t, %s: got %v, want status %d", strict, tt.name, err, want)
+				continue
+			}
+			if want == 0 && resp.URL != tt.relaxedURL {
+				t.Errorf("strict %t, %s: url = %q, want %q", strict, tt.name, resp.URL, tt.relaxedURL)
+			}
+		}
+
+		// A valid token is exchanged for a playback token in the proxy URL in both modes
+		resp, err := env.stream.PlayStream(&model.PlayStreamRequest{Token: listed})
+		if err != nil {
+			t.Fatalf("strict %t, valid token: %v", strict, err)
+		}
+		if strings.Contains(resp.URL, "upstream.example") || !strings.Contains(resp.URL, "/api/v1/stream/hls/") {
+			t.Errorf("strict %t, valid token: url = %q, want a proxy url", strict, resp.URL)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Package testutil builds the apps and databases tests run against
+package testutil
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// NewApp creates a test app with the collections, saved in order so that relation
+// fields can point at the collections before them. The app is cleaned up with the test.
+func NewApp(t testing.TB, collections ...*core.Collection) *tests.TestApp {
+	t.Helper()
+
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(app.Cleanup)
+
+	for _, collection := range collections {
+		if err := app.Save(collection); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return app
+}
+
+// SaveRecord saves a record of the collection with the fields and returns it
+func SaveRecord(t testing.TB, app core.App, collection *core.Collection, fields map[string]any) *core.Record {
+	t.Helper()
+
+	record := core.NewRecord(collection)
+	record.Load(fields)
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	return record
+}
+
+// CatalogSchema is the part of the catalog schema the repositories read
+var CatalogSchema = []string{
+	`CREATE TABLE channels (
+		id TEXT PRIMARY KEY,
+		channel TEXT DEFAULT '',
+		title TEXT DEFAULT '',
+		url TEXT DEFAULT '',
+		logo TEXT DEFAULT '',
+		quality TEXT DEFAULT '',
+		category TEXT DEFAULT '',
+		country TEXT DEFAULT '',
+		language TEXT DEFAULT '',
+		user_agent TEXT DEFAULT '',
+		referrer TEXT DEFAULT '',
+		is_working BOOLEAN DEFAULT TRUE,
+		is_retired BOOLEAN DEFAULT FALSE,
+		uptime REAL DEFAULT 0,
+		throughput REAL DEFAULT 0,
+		popularity REAL DEFAULT 0,
+		created TEXT DEFAULT ''
+	)`,
+	`CREATE TABLE qualities (id TEXT PRIMARY KEY, quality TEXT DEFAULT '')`,
+	`CREATE TABLE categories (id TEXT PRIMARY KEY, name_1 TEXT DEFAULT '', name_2 TEXT DEFAULT '', name_3 TEXT DEFAULT '')`,
+	`CREATE TABLE countries (id TEXT PRIMARY KEY, name TEXT DEFAULT '')`,
+	`CREATE TABLE languages (id TEXT PRIMARY KEY, name TEXT DEFAULT '')`,
+	`CREATE TABLE logos (id TEXT PRIMARY KEY, logo_url TEXT DEFAULT '', width REAL DEFAULT 0, height REAL DEFAULT 0)`,
+	`CREATE TABLE channel_stats (
+		id TEXT PRIMARY KEY,
+		channel TEXT DEFAULT '',
+		hour TEXT DEFAULT '',
+		plays NUMERIC DEFAULT 0,
+		watch_seconds NUMERIC DEFAULT 0,
+		peak_viewers NUMERIC DEFAULT 0,
+		created TEXT DEFAULT '',
+		updated TEXT DEFAULT ''
+	)`,
+	`CREATE UNIQUE INDEX idx_channel_stats_channel_hour ON channel_stats (channel, hour)`,
+	`CREATE VIRTUAL TABLE channels_fts USING fts5(
+		id UNINDEXED,
+		title,
+		channel,
+		category,
+		country,
+		language,
+		tokenize = 'unicode61 remove_diacritics 2',
+		prefix = '2 3'
+	)`,
+	`CREATE VIRTUAL TABLE channels_fts_vocab USING fts5vocab('channels_fts', 'row')`,
+}
+
+// NewDB opens an empty database with the catalog schema, closed with the test
+func NewDB(t testing.TB) *dbx.DB {
+	t.Helper()
+
+	db, err := core.DefaultDBConnect(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, query := range CatalogSchema {
+		if _, err := db.NewQuery(query).Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
+
+// Insert inserts a row into a table
+func Insert(t testing.TB, db dbx.Builder, table string, columns dbx.Params) {
+	t.Helper()
+
+	if _, err := db.Insert(table, columns).Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
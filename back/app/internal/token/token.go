@@ -0,0 +1,206 @@
+// Package token signs and verifies stream tokens. A token carries everything needed to
+// check it, so verifying one takes no lookup: the channel it grants, what for, when it
+// expires, optionally the client it is bound to, and the id of the key that signed it.
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// ScopeList tokens come with channel listings and are exchanged for playback
+	ScopeList = "list"
+	// ScopePlay tokens address the stream of a channel in the HLS proxy
+	ScopePlay = "play"
+)
+
+var (
+	ErrInvalid = errors.New("invalid token")
+	ErrExpired = errors.New("token expired")
+	ErrClient  = errors.New("token is bound to another client")
+)
+
+// Claims are the contents of a token
+type Claims struct {
+	// ID tells tokens apart, e.g. to count their uses
+	ID        string `json:"n"`
+	ChannelID string `json:"c"`
+	Scope     string `json:"s"`
+	Issued    int64  `json:"i"`
+	Expires   int64  `json:"e"`
+	// Client is the keyed hash of the client the token is bound to, empty when it isn't bound
+	Client string `json:"b,omitempty"`
+	KeyID  string `json:"k"`
+}
+
+// IssuedAt returns when the token was signed
+func (c *Claims) IssuedAt() time.Time {
+	return time.Unix(c.Issued, 0)
+}
+
+// ExpiresAt returns when the token expires
+func (c *Claims) ExpiresAt() time.Time {
+	return time.Unix(c.Expires, 0)
+}
+
+// Client identifies the client a token is bound to
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// Key is a signing key. Its id is stored in the tokens it signs, so that they keep
+// verifying while a newer key signs new tokens.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// ParseKeys parses keys written as comma separated id:secret pairs
+func ParseKeys(spec string) ([]Key, error) {
+	var keys []Key
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || strings.ContainsAny(id, ".") {
+			return nil, fmt.Errorf("invalid token key %q, expected id:secret", id)
+		}
+		if len(secret) < 32 {
+			return nil, fmt.Errorf("token key %q is too short, use at least 32 characters", id)
+		}
+
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+
+	return keys, nil
+}
+
+// RandomKey generates a key for when none is configured
+func RandomKey() Key {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("failed to generate token key: %v", err))
+	}
+
+	return Key{ID: "random", Secret: secret}
+}
+
+// Signer signs tokens with its first key and verifies them with any of its keys
+type Signer struct {
+	keys map[string]Key
+	sign Key
+}
+
+func NewSigner(keys []Key) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one token key is required")
+	}
+
+	signer := &Signer{
+		keys: make(map[string]Key, len(keys)),
+		sign: keys[0],
+	}
+	for _, key := range keys {
+		if _, ok := signer.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate token key %q", key.ID)
+		}
+		signer.keys[key.ID] = key
+	}
+
+	return signer, nil
+}
+
+// Sign issues a token of a scope for a channel that expires after ttl.
+// A non-nil client binds the token to it.
+func (s *Signer) Sign(channelID, scope string, ttl time.Duration, client *Client) (string, error) {
+	id := make([]byte, 9)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+
+	now := time.Now()
+	claims := Claims{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		ChannelID: channelID,
+		Scope:     scope,
+		Issued:    now.Unix(),
+		Expires:   now.Add(ttl).Unix(),
+		KeyID:     s.sign.ID,
+	}
+	if client != nil {
+		claims.Client = clientHash(s.sign, *client)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal token claims: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signature(s.sign, encoded)), nil
+}
+
+// Verify checks the signature, scope and expiry of a token and, when it is bound,
+// that it is used by its client
+func (s *Signer) Verify(token, scope string, client Client) (*Claims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ID == "" || claims.ChannelID == "" {
+		return nil, ErrInvalid
+	}
+
+	key, ok := s.keys[claims.KeyID]
+	if !ok || !hmac.Equal(mac, signature(key, encoded)) || claims.Scope != scope {
+		return nil, ErrInvalid
+	}
+
+	if time.Now().After(claims.ExpiresAt()) {
+		return nil, ErrExpired
+	}
+
+	if claims.Client != "" && !hmac.Equal([]byte(claims.Client), []byte(clientHash(key, client))) {
+		return nil, ErrClient
+	}
+
+	return &claims, nil
+}
+
+func signature(key Key, encoded string) []byte {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// clientHash keys the hash of the client, so that the readable claims don't reveal its IP
+func clientHash(key Key, client Client) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte("client\x00" + client.IP + "\x00" + client.UserAgent))
+	return hex.EncodeToString(mac.Sum(nil)[:12])
+}
@@ -0,0 +1,112 @@
+package token
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigner(t *testing.T, keys ...Key) *Signer {
+	t.Helper()
+
+	signer, err := NewSigner(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func testKey(id string) Key {
+	return Key{ID: id, Secret: []byte(strings.Repeat(id, 32))}
+}
+
+func TestVerify(t *testing.T) {
+	signer := newTestSigner(t, testKey("k1"))
+	client := Client{IP: "203.0.113.7", UserAgent: "player/1.0"}
+
+	sign := func(scope string, ttl time.Duration, client *Client) string {
+		tok, err := signer.Sign("ch1", scope, ttl, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	valid := sign(ScopePlay, time.Hour, nil)
+	encoded, sig, _ := strings.Cut(valid, ".")
+
+	// The payload of another channel under the signature of the valid token
+	payload, _ := base64.RawURLEncoding.DecodeString(encoded)
+	forged := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(payload), `"c":"ch1"`, `"c":"ch2"`, 1))) + "." + sig
+
+	// The signature of the valid token with its last byte flipped
+	mac, _ := base64.RawURLEncoding.DecodeString(sig)
+	mac[len(mac)-1] ^= 1
+	flipped := encoded + "." + base64.RawURLEncoding.EncodeToString(mac)
+
+	tests := []struct {
+		name   string
+		token  string
+		scope  string
+		client Client
+		want   error
+	}{
+		{"valid", valid, ScopePlay, Client{}, nil},
+		{"tampered payload", forged, ScopePlay, Client{}, ErrInvalid},
+		{"tampered signature", flipped, ScopePlay, Client{}, ErrInvalid},
+		{"missing signature", encoded, ScopePlay, Client{}, ErrInvalid},
+		{"garbage", "not a token", ScopePlay, Client{}, ErrInvalid},
+		{"wrong scope", valid, ScopeList, Client{}, ErrInvalid},
+		{"expired", sign(ScopePlay, -time.Minute, nil), ScopePlay, Client{}, ErrExpired},
+		{"bound client", sign(ScopePlay, time.Hour, &client), ScopePlay, client, nil},
+		{"another client", sign(ScopePlay, time.Hour, &client), ScopePlay, Client{IP: "198.51.100.1", UserAgent: "player/1.0"}, ErrClient},
+	}
+	for _, tt := range tests {
+		claims, err := signer.Verify(tt.token, tt.scope, tt.client)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify() error = %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		if err == nil && (claims.ChannelID != "ch1" || claims.Scope != tt.scope || claims.KeyID != "k1") {
+			t.Errorf("%s: claims = %+v", tt.name, claims)
+		}
+	}
+}
+
+func TestVerifyKeyRotation(t *testing.T) {
+	old := newTestSigner(t, testKey("k1"))
+	rotated := newTestSigner(t, testKey("k2"), testKey("k1"))
+	retired := newTestSigner(t, testKey("k2"))
+
+	oldToken, err := old.Sign("ch1", ScopeList, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A token of the rotated out key verifies while the key is still listed
+	claims, err := rotated.Verify(oldToken, ScopeList, Client{})
+	if err != nil {
+		t.Fatalf("verifying a token of a rotated out key: %v", err)
+	}
+	if claims.KeyID != "k1" {
+		t.Errorf("key id = %q, want k1", claims.KeyID)
+	}
+
+	// New tokens are signed with the first key
+	newToken, err := rotated.Sign("ch1", ScopeList, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := rotated.Verify(newToken, ScopeList, Client{}); err != nil || claims.KeyID != "k2" {
+		t.Errorf("verifying a new token = %+v, %v, want signed with k2", claims, err)
+	}
+
+	// Once the key is removed its tokens no longer verify, nor do tokens of unknown keys
+	if _, err := retired.Verify(oldToken, ScopeList, Client{}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("verifying a token of a removed key = %v, want %v", err, ErrInvalid)
+	}
+	if _, err := old.Verify(newToken, ScopeList, Client{}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("verifying a token of an unknown key = %v, want %v", err, ErrInvalid)
+	}
+}
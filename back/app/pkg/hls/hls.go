@@ -0,0 +1,102 @@
+package hls
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// uriAttrRegex matches the URI attribute of tags like EXT-X-KEY, EXT-X-MAP and EXT-X-MEDIA
+var uriAttrRegex = regexp.MustCompile(`URI="([^"]*)"`)
+
+// IsPlaylist reports whether a response is an HLS playlist judging by its content type or URL
+func IsPlaylist(contentType, rawURL string) bool {
+	contentType = strings.ToLower(contentType)
+	if strings.Contains(contentType, "mpegurl") {
+		return true
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return strings.Contains(rawURL, ".m3u8")
+	}
+	return strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
+
+// ResolveURI resolves a playlist URI against the URL of the playlist it appears in
+func ResolveURI(base *url.URL, uri string) (string, bool) {
+	ref, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return "", false
+	}
+
+	resolved := base.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return "", false
+	}
+
+	return resolved.String(), true
+}
+
+// URIs returns every http(s) URI referenced by the playlist, resolved against base.
+// That covers variant playlists, media segments and the URI attributes of tags.
+func URIs(playlist string, base *url.URL) []string {
+	seen := make(map[string]bool)
+	var uris []string
+
+	add := func(uri string) {
+		if resolved, ok := ResolveURI(base, uri); ok && !seen[resolved] {
+			seen[resolved] = true
+			uris = append(uris, resolved)
+		}
+	}
+
+	for _, line := range strings.Split(playlist, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			for _, match := range uriAttrRegex.FindAllStringSubmatch(line, -1) {
+				add(match[1])
+			}
+			continue
+		}
+
+		add(line)
+	}
+
+	return uris
+}
+
+// Rewrite replaces every URI of the playlist with the value returned by rewrite.
+// URIs are resolved against base before being passed to rewrite; URIs that are
+// not http(s), such as data: or skd: key URIs, are kept untouched.
+func Rewrite(playlist string, base *url.URL, rewrite func(absURL string) string) string {
+	lines := strings.Split(playlist, "\n")
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "#") {
+			lines[i] = uriAttrRegex.ReplaceAllStringFunc(line, func(attr string) string {
+				uri := uriAttrRegex.FindStringSubmatch(attr)[1]
+				if resolved, ok := ResolveURI(base, uri); ok {
+					return `URI="` + rewrite(resolved) + `"`
+				}
+				return attr
+			})
+			continue
+		}
+
+		if resolved, ok := ResolveURI(base, trimmed); ok {
+			lines[i] = rewrite(resolved)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,130 @@
+package hls
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// attrRegex matches the KEY=VALUE pairs of a tag attribute list, values may be quoted
+var attrRegex = regexp.MustCompile(`([A-Z0-9-]+)=("[^"]*"|[^,]*)`)
+
+var ErrNotPlaylist = errors.New("missing #EXTM3U header")
+
+// Variant is a stream of a master playlist, as announced by EXT-X-STREAM-INF
+type Variant struct {
+	URI        string
+	Bandwidth  int
+	Resolution string
+	Codecs     string
+}
+
+// Key is the encryption of the segments that follow an EXT-X-KEY tag
+type Key struct {
+	Method string
+	URI    string
+}
+
+// Playlist is either a master playlist listing variants or a media playlist listing segments.
+// All URIs are resolved against the URL of the playlist.
+type Playlist struct {
+	Variants []Variant
+	Segments []string
+	Map      string
+	Keys     []Key
+}
+
+// IsMaster reports whether the playlist lists variants rather than segments
+func (p *Playlist) IsMaster() bool {
+	return len(p.Variants) > 0
+}
+
+// Parse reads a master or media playlist
+func Parse(content string, base *url.URL) (*Playlist, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	if !strings.HasPrefix(strings.TrimSpace(content), "#EXTM3U") {
+		return nil, ErrNotPlaylist
+	}
+
+	playlist := &Playlist{}
+	var pending *Variant
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attrs := Attributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			bandwidth, _ := strconv.Atoi(attrs["BANDWIDTH"])
+			pending = &Variant{
+				Bandwidth:  bandwidth,
+				Resolution: attrs["RESOLUTION"],
+				Codecs:     attrs["CODECS"],
+			}
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			if uri, ok := ResolveURI(base, Attributes(strings.TrimPrefix(line, "#EXT-X-MAP:"))["URI"]); ok && playlist.Map == "" {
+				playlist.Map = uri
+			}
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			attrs := Attributes(strings.TrimPrefix(line, "#EXT-X-KEY:"))
+			key := Key{Method: attrs["METHOD"]}
+			if uri, ok := ResolveURI(base, attrs["URI"]); ok {
+				key.URI = uri
+			}
+			playlist.Keys = append(playlist.Keys, key)
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			uri, ok := ResolveURI(base, line)
+			if !ok {
+				pending = nil
+				continue
+			}
+			if pending != nil {
+				pending.URI = uri
+				playlist.Variants = append(playlist.Variants, *pending)
+				pending = nil
+				continue
+			}
+			playlist.Segments = append(playlist.Segments, uri)
+		}
+	}
+
+	return playlist, nil
+}
+
+// Attributes parses the attribute list of a tag, e.g. BANDWIDTH=800000,CODECS="avc1,mp4a"
+func Attributes(list string) map[string]string {
+	attrs := make(map[string]string)
+	for _, match := range attrRegex.FindAllStringSubmatch(list, -1) {
+		attrs[match[1]] = strings.Trim(match[2], `"`)
+	}
+	return attrs
+}
+
+// Height returns the vertical resolution of the variant, or 0 if it isn't announced
+func (v Variant) Height() int {
+	_, height, found := strings.Cut(strings.ToLower(v.Resolution), "x")
+	if !found {
+		return 0
+	}
+	h, err := strconv.Atoi(height)
+	if err != nil {
+		return 0
+	}
+	return h
+}
+
+// Quality returns the quality label of a vertical resolution, e.g. "1080p"
+func Quality(height int) string {
+	if height <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dp", height)
+}
@@ -0,0 +1,43 @@
+package utils
+
+// EditDistance returns how many single rune insertions, deletions, substitutions
+// and swaps of adjacent runes turn one string into the other
+func EditDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// Rows of the distances between the prefixes of a and b, two rows back for swaps
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+
+	return prev[len(rb)]
+}
+
+// MaxTypos returns how many edits a search word of this length tolerates
+func MaxTypos(word string) int {
+	switch n := len([]rune(word)); {
+	case n < 4:
+		return 0
+	case n < 7:
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,55 @@
+package xmltv
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+const doctype = `<!DOCTYPE tv SYSTEM "xmltv.dtd">` + "\n"
+
+// Channel is a channel element
+type Channel struct {
+	ID           string `xml:"id,attr"`
+	DisplayNames []Text `xml:"display-name"`
+	Icon         *Icon  `xml:"icon,omitempty"`
+}
+
+// Writer writes a guide element by element, channels first, so that large guides
+// are never held in memory. Every element is flushed to the underlying writer.
+type Writer struct {
+	encoder *xml.Encoder
+}
+
+// NewWriter starts a guide, naming the generator in its tv element
+func NewWriter(w io.Writer, generator string) (*Writer, error) {
+	if _, err := io.WriteString(w, xml.Header+doctype); err != nil {
+		return nil, err
+	}
+
+	encoder := xml.NewEncoder(w)
+	start := xml.StartElement{
+		Name: xml.Name{Local: "tv"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "generator-info-name"}, Value: generator}},
+	}
+	if err := encoder.EncodeToken(start); err != nil {
+		return nil, err
+	}
+
+	return &Writer{encoder: encoder}, nil
+}
+
+func (w *Writer) WriteChannel(channel *Channel) error {
+	return w.encoder.EncodeElement(channel, xml.StartElement{Name: xml.Name{Local: "channel"}})
+}
+
+func (w *Writer) WriteProgramme(programme *Programme) error {
+	return w.encoder.EncodeElement(programme, xml.StartElement{Name: xml.Name{Local: "programme"}})
+}
+
+// Close ends the guide. It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: "tv"}}); err != nil {
+		return err
+	}
+	return w.encoder.Close()
+}
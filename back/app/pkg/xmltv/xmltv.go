@@ -0,0 +1,137 @@
+package xmltv
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// timeLayouts are the date formats XMLTV guides use, most precise first.
+// Dates without an offset are UTC.
+var timeLayouts = []string{
+	"20060102150405 -0700",
+	"20060102150405-0700",
+	"20060102150405",
+	"200601021504 -0700",
+	"200601021504",
+}
+
+// Text is an element with an optional language, like title or desc
+type Text struct {
+	Lang  string `xml:"lang,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type Icon struct {
+	Src string `xml:"src,attr"`
+}
+
+// Programme is a programme element. Start and Stop are kept as written,
+// Stop is optional in XMLTV.
+type Programme struct {
+	Start      string `xml:"start,attr"`
+	Stop       string `xml:"stop,attr,omitempty"`
+	Channel    string `xml:"channel,attr"`
+	Titles     []Text `xml:"title"`
+	SubTitles  []Text `xml:"sub-title"`
+	Descs      []Text `xml:"desc"`
+	Categories []Text `xml:"category"`
+	Icon       *Icon  `xml:"icon"`
+}
+
+// Title returns the first title of the programme
+func (p *Programme) Title() string {
+	return first(p.Titles)
+}
+
+func (p *Programme) SubTitle() string {
+	return first(p.SubTitles)
+}
+
+func (p *Programme) Desc() string {
+	return first(p.Descs)
+}
+
+func (p *Programme) Category() string {
+	return first(p.Categories)
+}
+
+func first(texts []Text) string {
+	for _, text := range texts {
+		if value := strings.TrimSpace(text.Value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Reader reads the programmes of a guide one at a time, so that large guides
+// are never held in memory
+type Reader struct {
+	decoder *xml.Decoder
+}
+
+// NewReader reads a guide, gunzipping it when it is compressed
+func NewReader(r io.Reader) (*Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(2)
+
+	var input io.Reader = buffered
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzipped guide: %w", err)
+		}
+		input = gz
+	}
+
+	decoder := xml.NewDecoder(input)
+	// Guides are mostly UTF-8, other charsets are read as is rather than rejected
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	decoder.Strict = false
+
+	return &Reader{decoder: decoder}, nil
+}
+
+// Next returns the next programme of the guide, io.EOF once there are no more
+func (r *Reader) Next() (*Programme, error) {
+	for {
+		tok, err := r.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "programme" {
+			continue
+		}
+
+		var programme Programme
+		if err := r.decoder.DecodeElement(&programme, &start); err != nil {
+			return nil, fmt.Errorf("failed to read programme: %w", err)
+		}
+		return &programme, nil
+	}
+}
+
+// ParseTime parses an XMLTV date
+func ParseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid XMLTV date %q", value)
+}
+
+// FormatTime formats a time as an XMLTV date
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(timeLayouts[0])
+}